@@ -0,0 +1,50 @@
+// domainctl 查看和重放消息总线上的消息
+//
+//	domainctl tail -dsn 'kafka://localhost:9092?group=domainctl' -topic events
+//	domainctl publish -dsn 'nsq://localhost:4150' -name main.BookRoom -data '{"RoomId":"1"}'
+//	domainctl replay -dsn 'local://data/bus.db?group=replay' -from events -to events_replay -start 10 -end 20
+//
+// tail 和 replay 会确认收到的消息，dsn 中需要使用单独的消费组，避免影响线上的消费者
+package main
+
+import (
+	"fmt"
+	"os"
+
+	_ "github.com/hnhuaxi/domain/driver/amqp"
+	_ "github.com/hnhuaxi/domain/driver/jetstream"
+	_ "github.com/hnhuaxi/domain/driver/kafka"
+	_ "github.com/hnhuaxi/domain/driver/local"
+	_ "github.com/hnhuaxi/domain/driver/nats"
+	_ "github.com/hnhuaxi/domain/driver/nsq"
+	_ "github.com/hnhuaxi/domain/driver/redisstream"
+)
+
+var commands = map[string]func(args []string) error{
+	"tail":    tailCmd,
+	"publish": publishCmd,
+	"replay":  replayCmd,
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: domainctl <tail|publish|replay> [flags]\n")
+	fmt.Fprintf(os.Stderr, "run domainctl <command> -h for the flags of each command\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "domainctl %s: %s\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
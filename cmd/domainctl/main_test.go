@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hnhuaxi/domain/driver/local"
+	"github.com/hnhuaxi/domain/messagebus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishTailReplay(t *testing.T) {
+	store, err := local.Open(local.Config{Path: filepath.Join(t.TempDir(), "bus.db")})
+	assert.NoError(t, err)
+	defer store.Close()
+
+	publisher := store.NewPublisher()
+
+	for _, room := range []string{"1", "2", "3"} {
+		_, err := publish(publisher, publishOption{
+			Name:     "main.BookRoom",
+			Payload:  []byte(`{"RoomId": "` + room + `"}`),
+			Metadata: map[string]string{"trace_id": "t" + room},
+		})
+		assert.NoError(t, err)
+	}
+
+	_, err = publish(publisher, publishOption{Name: "main.BookRoom", Payload: []byte("room")})
+	assert.Error(t, err)
+
+	subscriber, err := store.NewSubscriber(local.SubscriberConfig{ConsumerGroup: "tail"})
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	assert.NoError(t, tail(context.Background(), subscriber, &out, tailOption{
+		Topic:     "main.BookRoom",
+		Limit:     1,
+		Marshaler: messagebus.DefaultMarshaler,
+	}))
+	assert.NoError(t, subscriber.Close())
+
+	lines := strings.Split(out.String(), "\n")
+	assert.True(t, strings.HasPrefix(lines[0], "#1 "))
+	assert.True(t, strings.HasSuffix(lines[0], " main.BookRoom"))
+	assert.Equal(t, "  metadata: name=main.BookRoom trace_id=t1", lines[1])
+	assert.Equal(t, `  payload: {"RoomId":"1"}`, lines[2])
+
+	// 重放 offset 2 到 3
+	subscriber, err = store.NewSubscriber(local.SubscriberConfig{ConsumerGroup: "replay"})
+	assert.NoError(t, err)
+
+	count, err := replay(context.Background(), subscriber, publisher, replayOption{
+		From:  "main.BookRoom",
+		To:    "replayed",
+		Start: 2,
+		End:   3,
+		Idle:  100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.NoError(t, subscriber.Close())
+
+	subscriber, err = store.NewSubscriber(local.SubscriberConfig{ConsumerGroup: "check"})
+	assert.NoError(t, err)
+	defer subscriber.Close()
+
+	out.Reset()
+	assert.NoError(t, tail(context.Background(), subscriber, &out, tailOption{
+		Topic:     "replayed",
+		Idle:      100 * time.Millisecond,
+		Marshaler: messagebus.DefaultMarshaler,
+	}))
+	assert.Contains(t, out.String(), "trace_id=t2")
+	assert.Contains(t, out.String(), "trace_id=t3")
+	assert.NotContains(t, out.String(), "trace_id=t1")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/driver"
+)
+
+// nameMetadataKey cqrs.JSONMarshaler 保存命令和事件名称的 metadata
+const nameMetadataKey = "name"
+
+type metadataFlag map[string]string
+
+func (m metadataFlag) String() string {
+	var pairs = make([]string, 0, len(m))
+	for key, val := range m {
+		pairs = append(pairs, key+"="+val)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (m metadataFlag) Set(s string) error {
+	key, val, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("invalid metadata %q, want key=value", s)
+	}
+
+	m[key] = val
+	return nil
+}
+
+type publishOption struct {
+	// Topic 为空时使用 Name，MessageBus 的命令 topic 就是命令名称
+	Topic    string
+	Name     string
+	Payload  []byte
+	Metadata map[string]string
+}
+
+func publishCmd(args []string) error {
+	var (
+		fs       = flag.NewFlagSet("publish", flag.ExitOnError)
+		dsn      = fs.String("dsn", "", "消息队列的驱动连接串")
+		data     = fs.String("data", "", "JSON payload，为空时从 -file 读取")
+		file     = fs.String("file", "-", "JSON payload 文件，- 为标准输入")
+		metadata = make(metadataFlag)
+		opt      publishOption
+	)
+
+	fs.StringVar(&opt.Topic, "topic", "", "topic 名称，默认和 -name 相同")
+	fs.StringVar(&opt.Name, "name", "", "命令或事件名称，例如 main.BookRoom")
+	fs.Var(metadata, "meta", "附加的 metadata，key=value，可以重复")
+	fs.Parse(args)
+
+	opt.Metadata = metadata
+	opt.Payload = []byte(*data)
+
+	if len(opt.Payload) == 0 {
+		var (
+			r   io.Reader = os.Stdin
+			err error
+		)
+
+		if *file != "-" {
+			f, err := os.Open(*file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		if opt.Payload, err = io.ReadAll(r); err != nil {
+			return err
+		}
+	}
+
+	publisherMaker, _, err := driver.Open(*dsn)
+	if err != nil {
+		return err
+	}
+
+	publisher, err := publisherMaker()
+	if err != nil {
+		return err
+	}
+	defer publisher.Close()
+
+	msg, err := publish(publisher, opt)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(msg.UUID)
+	return nil
+}
+
+// publish 构造和 cqrs.JSONMarshaler 相同格式的消息并发布
+func publish(publisher domain.Publisher, opt publishOption) (*message.Message, error) {
+	if opt.Name == "" {
+		return nil, errors.New("missing name")
+	}
+
+	if opt.Topic == "" {
+		opt.Topic = opt.Name
+	}
+
+	var payload = []byte(strings.TrimSpace(string(opt.Payload)))
+	if !json.Valid(payload) {
+		return nil, errors.New("payload is not valid JSON")
+	}
+
+	msg := message.NewMessage(watermill.NewUUID(), payload)
+	for key, val := range opt.Metadata {
+		msg.Metadata.Set(key, val)
+	}
+	msg.Metadata.Set(nameMetadataKey, opt.Name)
+
+	if err := publisher.Publish(opt.Topic, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
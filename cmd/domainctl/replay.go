@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/driver"
+)
+
+type replayOption struct {
+	From string
+	To   string
+	// Start/End offset 范围，包含两端，End 小于 0 不限制，
+	// 驱动没有提供 offset 时是订阅之后收到的序号，kafka 是分区内的 offset
+	Start int64
+	End   int64
+	// Since/Until 发布时间范围，零值不限制，需要驱动提供消息的时间戳
+	Since time.Time
+	Until time.Time
+	// Idle 这么长时间没有新消息后结束
+	Idle time.Duration
+}
+
+func replayCmd(args []string) error {
+	var (
+		fs    = flag.NewFlagSet("replay", flag.ExitOnError)
+		dsn   = fs.String("dsn", "", "源消息队列的驱动连接串，需要使用单独的消费组")
+		toDSN = fs.String("to-dsn", "", "目标消息队列的驱动连接串，默认和 -dsn 相同")
+		since = fs.String("since", "", "开始时间，RFC3339 格式")
+		until = fs.String("until", "", "结束时间，RFC3339 格式")
+		opt   replayOption
+	)
+
+	fs.StringVar(&opt.From, "from", "events", "源 topic")
+	fs.StringVar(&opt.To, "to", "", "目标 topic")
+	fs.Int64Var(&opt.Start, "start", 0, "开始 offset")
+	fs.Int64Var(&opt.End, "end", -1, "结束 offset，包含，-1 不限制")
+	fs.DurationVar(&opt.Idle, "idle", 5*time.Second, "这么长时间没有新消息后结束")
+	fs.Parse(args)
+
+	var err error
+	if len(*since) > 0 {
+		if opt.Since, err = time.Parse(time.RFC3339, *since); err != nil {
+			return fmt.Errorf("invalid since: %w", err)
+		}
+	}
+
+	if len(*until) > 0 {
+		if opt.Until, err = time.Parse(time.RFC3339, *until); err != nil {
+			return fmt.Errorf("invalid until: %w", err)
+		}
+	}
+
+	publisherMaker, subscriberMaker, err := driver.Open(*dsn)
+	if err != nil {
+		return err
+	}
+
+	if len(*toDSN) > 0 {
+		if publisherMaker, _, err = driver.Open(*toDSN); err != nil {
+			return err
+		}
+	}
+
+	subscriber, err := subscriberMaker()
+	if err != nil {
+		return err
+	}
+	defer subscriber.Close()
+
+	publisher, err := publisherMaker()
+	if err != nil {
+		return err
+	}
+	defer publisher.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	count, err := replay(ctx, subscriber, publisher, opt)
+	fmt.Printf("replayed %d messages from %s to %s\n", count, opt.From, opt.To)
+
+	return err
+}
+
+// replay 把范围内的消息原样（UUID 和 metadata 不变）发布到目标 topic，
+// 范围之前的消息被确认跳过，遇到范围之后的第一条消息时结束，这条消息不确认
+func replay(ctx context.Context, subscriber domain.Subscriber, publisher domain.Publisher, opt replayOption) (int, error) {
+	if opt.To == "" {
+		return 0, errors.New("missing target topic")
+	}
+
+	if opt.From == opt.To {
+		return 0, errors.New("source and target topic must be different")
+	}
+
+	messages, err := subscriber.Subscribe(ctx, opt.From)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		count        int
+		filterByTime = !opt.Since.IsZero() || !opt.Until.IsZero()
+	)
+
+	for index := int64(0); ; index++ {
+		msg, ok := receive(ctx, messages, opt.Idle)
+		if !ok {
+			return count, nil
+		}
+
+		pos := positionOf(msg, index)
+		if filterByTime && !pos.HasTimestamp {
+			msg.Nack()
+			return count, errors.New("driver does not provide message timestamp, use offset range")
+		}
+
+		if pos.Offset < opt.Start || (!opt.Since.IsZero() && pos.Timestamp.Before(opt.Since)) {
+			msg.Ack()
+			continue
+		}
+
+		if (opt.End >= 0 && pos.Offset > opt.End) || (!opt.Until.IsZero() && pos.Timestamp.After(opt.Until)) {
+			return count, nil
+		}
+
+		if err := publisher.Publish(opt.To, msg.Copy()); err != nil {
+			msg.Nack()
+			return count, fmt.Errorf("publish message %s failed: %w", msg.UUID, err)
+		}
+
+		msg.Ack()
+		count++
+	}
+}
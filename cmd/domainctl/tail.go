@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill-kafka/v2/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/driver"
+	confluent "github.com/hnhuaxi/domain/driver/kafka"
+	"github.com/hnhuaxi/domain/driver/local"
+	"github.com/hnhuaxi/domain/messagebus"
+)
+
+type tailOption struct {
+	Topic string
+	// Limit 收到这么多条消息后退出，0 不限制
+	Limit int
+	// Idle 这么长时间没有新消息后退出，0 一直等待
+	Idle      time.Duration
+	Marshaler domain.CommandEventMarshaler
+}
+
+func tailCmd(args []string) error {
+	var (
+		fs  = flag.NewFlagSet("tail", flag.ExitOnError)
+		dsn = fs.String("dsn", "", "消息队列的驱动连接串，需要使用单独的消费组")
+		opt = tailOption{Marshaler: messagebus.DefaultMarshaler}
+	)
+
+	fs.StringVar(&opt.Topic, "topic", "events", "topic 名称")
+	fs.IntVar(&opt.Limit, "n", 0, "收到这么多条消息后退出，0 不限制")
+	fs.DurationVar(&opt.Idle, "idle", 0, "这么长时间没有新消息后退出，0 一直等待")
+	fs.Parse(args)
+
+	_, subscriberMaker, err := driver.Open(*dsn)
+	if err != nil {
+		return err
+	}
+
+	subscriber, err := subscriberMaker()
+	if err != nil {
+		return err
+	}
+	defer subscriber.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	return tail(ctx, subscriber, os.Stdout, opt)
+}
+
+func tail(ctx context.Context, subscriber domain.Subscriber, w io.Writer, opt tailOption) error {
+	messages, err := subscriber.Subscribe(ctx, opt.Topic)
+	if err != nil {
+		return err
+	}
+
+	for index := int64(0); opt.Limit == 0 || index < int64(opt.Limit); index++ {
+		msg, ok := receive(ctx, messages, opt.Idle)
+		if !ok {
+			return nil
+		}
+
+		if err := printMessage(w, msg, positionOf(msg, index), opt.Marshaler); err != nil {
+			msg.Nack()
+			return err
+		}
+		msg.Ack()
+	}
+
+	return nil
+}
+
+// receive 返回 false 表示订阅已经结束，或者超过 idle 没有新消息
+func receive(ctx context.Context, messages <-chan *message.Message, idle time.Duration) (*message.Message, bool) {
+	var timeout <-chan time.Time
+	if idle > 0 {
+		timeout = time.After(idle)
+	}
+
+	select {
+	case msg, ok := <-messages:
+		return msg, ok
+	case <-timeout:
+		return nil, false
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// position 消息在 topic 中的位置，驱动没有提供 offset 时使用订阅之后收到的序号
+type position struct {
+	Offset       int64
+	Partition    int32
+	HasPartition bool
+	Timestamp    time.Time
+	HasTimestamp bool
+	Key          []byte
+}
+
+func positionOf(msg *message.Message, index int64) position {
+	var (
+		pos = position{Offset: index}
+		ctx = msg.Context()
+	)
+
+	if offset, ok := local.MessageOffsetFromCtx(ctx); ok {
+		pos.Offset = int64(offset)
+	}
+
+	if timestamp, ok := local.MessageTimestampFromCtx(ctx); ok {
+		pos.Timestamp, pos.HasTimestamp = timestamp, true
+	}
+
+	// kafka 的 offset 是分区内的 offset，多个分区时需要结合 partition 查看
+	if offset, ok := kafka.MessagePartitionOffsetFromCtx(ctx); ok {
+		pos.Offset = offset
+	}
+
+	if partition, ok := kafka.MessagePartitionFromCtx(ctx); ok {
+		pos.Partition, pos.HasPartition = partition, true
+	}
+
+	if timestamp, ok := kafka.MessageTimestampFromCtx(ctx); ok {
+		pos.Timestamp, pos.HasTimestamp = timestamp, true
+	}
+
+	// confluent:// 驱动使用自己的 context key
+	if offset, ok := confluent.MessagePartitionOffsetFromCtx(ctx); ok {
+		pos.Offset = offset
+	}
+
+	if partition, ok := confluent.MessagePartitionFromCtx(ctx); ok {
+		pos.Partition, pos.HasPartition = partition, true
+	}
+
+	if timestamp, ok := confluent.MessageTimestampFromCtx(ctx); ok {
+		pos.Timestamp, pos.HasTimestamp = timestamp, true
+	}
+
+	if key, ok := confluent.MessageKeyFromCtx(ctx); ok {
+		pos.Key = key
+	}
+
+	return pos
+}
+
+func printMessage(w io.Writer, msg *message.Message, pos position, marshaler domain.CommandEventMarshaler) error {
+	var header = []string{fmt.Sprintf("#%d", pos.Offset)}
+	if pos.HasPartition {
+		header = append(header, fmt.Sprintf("partition=%d", pos.Partition))
+	}
+
+	if pos.HasTimestamp {
+		header = append(header, pos.Timestamp.Format(time.RFC3339Nano))
+	}
+
+	if len(pos.Key) > 0 {
+		header = append(header, fmt.Sprintf("key=%q", pos.Key))
+	}
+
+	header = append(header, msg.UUID)
+	if name := marshaler.NameFromMessage(msg); len(name) > 0 {
+		header = append(header, name)
+	}
+
+	var keys = make([]string, 0, len(msg.Metadata))
+	for key := range msg.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var metadata = make([]string, 0, len(keys))
+	for _, key := range keys {
+		metadata = append(metadata, key+"="+msg.Metadata[key])
+	}
+
+	_, err := fmt.Fprintf(w, "%s\n  metadata: %s\n  payload: %s\n",
+		strings.Join(header, " "), strings.Join(metadata, " "), formatPayload(msg.Payload))
+	if err != nil {
+		return fmt.Errorf("write message failed: %w", err)
+	}
+
+	return nil
+}
+
+// formatPayload JSON payload 压缩到一行，其他 payload 使用 Go 字符串字面量输出
+func formatPayload(payload []byte) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, payload); err == nil {
+		return buf.String()
+	}
+
+	return fmt.Sprintf("%q", payload)
+}
@@ -1,30 +1,233 @@
 package amqp
 
 import (
+	"crypto/tls"
+	"strings"
+
 	"github.com/ThreeDotsLabs/watermill-amqp/v2/pkg/amqp"
+	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/hnhuaxi/domain"
+	amqp091 "github.com/rabbitmq/amqp091-go"
 )
 
-func SubscriberMaker(addr string) domain.SubscriberMaker {
+// Topology 决定 topic 如何映射到 RabbitMQ 的交换机和队列
+type Topology string
+
+const (
+	// TopologyQueue 每个 topic 一个持久队列，消息在消费者之间分摊，适合命令
+	TopologyQueue Topology = "queue"
+	// TopologyPubSub 每个 topic 一个 fanout 交换机，每个消费组一个队列，适合事件
+	TopologyPubSub Topology = "pubsub"
+	// TopologyTopic 每个 topic 一个 topic 交换机，routing key 取自消息 metadata，
+	// 消费组的队列按 BindingKey 绑定
+	TopologyTopic Topology = "topic"
+)
+
+// DefaultRoutingKeyMetadata cqrs 的 marshaler 会把命令和事件的名称写入 name
+const DefaultRoutingKeyMetadata = "name"
+
+// routingKeySeparator 分隔发布时的交换机名称和 routing key，交换机名称中不允许出现 "#"
+const routingKeySeparator = "#"
+
+type Option struct {
+	Topology Topology
+	// ConsumerGroup 消费组名称，pubsub 和 topic 拓扑下每个消费组一个队列，队列名为 {topic}_{group}
+	ConsumerGroup string
+	// RoutingKeyMetadata topic 拓扑发布消息时 routing key 所在的 metadata
+	RoutingKeyMetadata string
+	// BindingKey topic 拓扑订阅时队列绑定的 key，例如 "order.*"
+	BindingKey string
+	// Quorum 使用 quorum 队列，quorum 队列总是持久化的
+	Quorum bool
+	// Prefetch 未确认消息的数量上限
+	Prefetch        int
+	ConfirmDelivery bool
+	TLS             *tls.Config
+	Logger          domain.LoggerAdapter
+}
+
+type OptionFunc func(opt *Option)
+
+// OptDurablePubSub 使用 fanout 交换机，group 为消费组名称
+func OptDurablePubSub(group string) OptionFunc {
+	return func(opt *Option) {
+		opt.Topology = TopologyPubSub
+		opt.ConsumerGroup = group
+	}
+}
+
+// OptTopicExchange 使用 topic 交换机，订阅时以 bindingKey 绑定消费组的队列
+func OptTopicExchange(group, bindingKey string) OptionFunc {
+	return func(opt *Option) {
+		opt.Topology = TopologyTopic
+		opt.ConsumerGroup = group
+		opt.BindingKey = bindingKey
+	}
+}
+
+// OptRoutingKeyMetadata 设置 topic 交换机发布时 routing key 所在的 metadata
+func OptRoutingKeyMetadata(key string) OptionFunc {
+	return func(opt *Option) {
+		opt.RoutingKeyMetadata = key
+	}
+}
+
+func OptQuorumQueue() OptionFunc {
+	return func(opt *Option) {
+		opt.Quorum = true
+	}
+}
+
+func OptPrefetch(count int) OptionFunc {
+	return func(opt *Option) {
+		opt.Prefetch = count
+	}
+}
+
+// OptConfirmDelivery 发布时等待 broker 的确认
+func OptConfirmDelivery() OptionFunc {
+	return func(opt *Option) {
+		opt.ConfirmDelivery = true
+	}
+}
+
+func OptTLS(config *tls.Config) OptionFunc {
+	return func(opt *Option) {
+		opt.TLS = config
+	}
+}
+
+func OptLogger(logger domain.LoggerAdapter) OptionFunc {
+	return func(opt *Option) {
+		opt.Logger = logger
+	}
+}
+
+func newOption(opts []OptionFunc) *Option {
+	var opt = &Option{
+		Topology:           TopologyQueue,
+		RoutingKeyMetadata: DefaultRoutingKeyMetadata,
+		BindingKey:         "#",
+		Prefetch:           1,
+		Logger:             domain.Logger,
+	}
+
+	for _, o := range opts {
+		o(opt)
+	}
+
+	return opt
+}
+
+// NewConfig 根据选项生成 watermill-amqp 的配置
+func NewConfig(addr string, opts ...OptionFunc) amqp.Config {
+	return newOption(opts).config(addr)
+}
+
+func (opt *Option) config(addr string) amqp.Config {
+	var config amqp.Config
+
+	switch opt.Topology {
+	case TopologyPubSub:
+		config = amqp.NewDurablePubSubConfig(addr, opt.queueName)
+	case TopologyTopic:
+		config = amqp.NewDurablePubSubConfig(addr, opt.queueName)
+		config.Exchange.Type = "topic"
+		config.Exchange.GenerateName = func(topic string) string {
+			exchange, _, _ := strings.Cut(topic, routingKeySeparator)
+			return exchange
+		}
+		config.QueueBind.GenerateRoutingKey = func(topic string) string {
+			return opt.BindingKey
+		}
+		config.Publish.GenerateRoutingKey = func(topic string) string {
+			_, key, _ := strings.Cut(topic, routingKeySeparator)
+			return key
+		}
+	default:
+		config = amqp.NewDurableQueueConfig(addr)
+	}
+
+	if opt.Quorum {
+		config.Queue.Durable = true
+		config.Queue.Arguments = amqp091.Table{"x-queue-type": "quorum"}
+	}
+
+	config.Connection.TLSConfig = opt.TLS
+	config.Consume.Qos.PrefetchCount = opt.Prefetch
+	config.Publish.ConfirmDelivery = opt.ConfirmDelivery
+
+	return config
+}
+
+func (opt *Option) queueName(topic string) string {
+	if opt.ConsumerGroup == "" {
+		return topic
+	}
+
+	return topic + "_" + opt.ConsumerGroup
+}
+
+// SubscriberMaker 默认使用持久队列，通过 OptDurablePubSub、OptTopicExchange 选择其他拓扑
+func SubscriberMaker(addr string, opts ...OptionFunc) domain.SubscriberMaker {
 	return func() (domain.Subscriber, error) {
-		commandsAMQPConfig := amqp.NewDurableQueueConfig(addr)
-		commandsSubscriber, err := amqp.NewSubscriber(commandsAMQPConfig, domain.Logger)
-		if err != nil {
-			return nil, err
+		opt := newOption(opts)
+
+		return amqp.NewSubscriber(opt.config(addr), opt.Logger)
+	}
+}
+
+// HandlerSubscriberMaker 以 handler 名称作为消费组，每个事件处理器有自己的队列，
+// 可以用作 messagebus.BusConfig.EventsSubscriberConstructor
+func HandlerSubscriberMaker(addr string, opts ...OptionFunc) func(handlerName string) (domain.Subscriber, error) {
+	return func(handlerName string) (domain.Subscriber, error) {
+		opt := newOption(opts)
+		if opt.Topology == TopologyQueue {
+			opt.Topology = TopologyPubSub
 		}
+		opt.ConsumerGroup = handlerName
 
-		return commandsSubscriber, nil
+		return amqp.NewSubscriber(opt.config(addr), opt.Logger)
 	}
 }
 
-func PublisherMaker(addr string) domain.PublisherMaker {
+func PublisherMaker(addr string, opts ...OptionFunc) domain.PublisherMaker {
 	return func() (domain.Publisher, error) {
-		commandsAMQPConfig := amqp.NewDurableQueueConfig(addr)
-		commandsPublisher, err := amqp.NewPublisher(commandsAMQPConfig, domain.Logger)
+		opt := newOption(opts)
+
+		publisher, err := amqp.NewPublisher(opt.config(addr), opt.Logger)
 		if err != nil {
 			return nil, err
 		}
 
-		return commandsPublisher, nil
+		if opt.Topology == TopologyTopic {
+			return &routingPublisher{Publisher: publisher, metadata: opt.RoutingKeyMetadata}, nil
+		}
+
+		return publisher, nil
 	}
 }
+
+// routingPublisher 按消息 metadata 中的 routing key 发布到 topic 交换机
+type routingPublisher struct {
+	message.Publisher
+	metadata string
+}
+
+// Publish 相邻且 routing key 相同的消息一起发送，保持消息的顺序
+func (pub *routingPublisher) Publish(topic string, messages ...*message.Message) error {
+	var start int
+	for i := 1; i <= len(messages); i++ {
+		key := messages[start].Metadata.Get(pub.metadata)
+		if i < len(messages) && messages[i].Metadata.Get(pub.metadata) == key {
+			continue
+		}
+
+		if err := pub.Publisher.Publish(topic+routingKeySeparator+key, messages[start:i]...); err != nil {
+			return err
+		}
+		start = i
+	}
+
+	return nil
+}
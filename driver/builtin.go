@@ -0,0 +1,127 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+	"github.com/ThreeDotsLabs/watermill-kafka/v2/pkg/kafka"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/hnhuaxi/domain"
+)
+
+func init() {
+	Register("gochannel", openGochannel)
+	Register("kafka", openKafka)
+}
+
+// gochannel://?buffer=64&persistent=true&block_publish=true
+func openGochannel(dsn *DSN, opt *OpenOption) (domain.PublisherMaker, domain.SubscriberMaker, error) {
+	var cfg gochannel.Config
+
+	buffer, err := dsn.Int("buffer", 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg.OutputChannelBuffer = int64(buffer)
+
+	if cfg.Persistent, err = dsn.Bool("persistent", false); err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.BlockPublishUntilSubscriberAck, err = dsn.Bool("block_publish", false); err != nil {
+		return nil, nil, err
+	}
+
+	pubSub := gochannel.NewGoChannel(cfg, opt.Logger)
+
+	return func() (domain.Publisher, error) {
+			return pubSub, nil
+		}, func() (domain.Subscriber, error) {
+			return pubSub, nil
+		}, nil
+}
+
+// kafka://broker1:9092,broker2:9092?group=x&offset=oldest&rebalance=sticky
+//
+// offset 和 rebalance 默认使用 sarama 的配置(newest、range)，和 NewEvents 一致
+func openKafka(dsn *DSN, opt *OpenOption) (domain.PublisherMaker, domain.SubscriberMaker, error) {
+	var brokers = dsn.Hosts()
+	if len(brokers) == 0 {
+		return nil, nil, errors.New("kafka: dsn must have at least one broker")
+	}
+
+	initialOffset, err := kafkaInitialOffset(dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rebalance, err := kafkaRebalanceStrategy(dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publisherMaker := func() (domain.Publisher, error) {
+		publishConfig := kafka.DefaultSaramaSyncPublisherConfig()
+		publishConfig.Producer.Return.Errors = true
+
+		return kafka.NewPublisher(
+			kafka.PublisherConfig{
+				Brokers:               brokers,
+				Marshaler:             kafka.DefaultMarshaler{},
+				OverwriteSaramaConfig: publishConfig,
+			},
+			opt.Logger,
+		)
+	}
+
+	subscriberMaker := func() (domain.Subscriber, error) {
+		subscribeConfig := kafka.DefaultSaramaSubscriberConfig()
+		if initialOffset != 0 {
+			subscribeConfig.Consumer.Offsets.Initial = initialOffset
+		}
+		if rebalance != nil {
+			subscribeConfig.Consumer.Group.Rebalance.Strategy = rebalance
+		}
+
+		return kafka.NewSubscriber(
+			kafka.SubscriberConfig{
+				Brokers:               brokers,
+				Unmarshaler:           kafka.DefaultMarshaler{},
+				OverwriteSaramaConfig: subscribeConfig,
+				ConsumerGroup:         dsn.Get("group"),
+			},
+			opt.Logger,
+		)
+	}
+
+	return publisherMaker, subscriberMaker, nil
+}
+
+func kafkaInitialOffset(dsn *DSN) (int64, error) {
+	switch val := dsn.Get("offset"); val {
+	case "":
+		return 0, nil
+	case "oldest":
+		return sarama.OffsetOldest, nil
+	case "newest":
+		return sarama.OffsetNewest, nil
+	default:
+		return 0, fmt.Errorf("driver: invalid dsn param offset=%q, must be oldest or newest", val)
+	}
+}
+
+func kafkaRebalanceStrategy(dsn *DSN) (sarama.BalanceStrategy, error) {
+	switch val := dsn.Get("rebalance"); val {
+	case "":
+		return nil, nil
+	case "range":
+		return sarama.BalanceStrategyRange, nil
+	case "roundrobin":
+		return sarama.BalanceStrategyRoundRobin, nil
+	case "sticky":
+		return sarama.BalanceStrategySticky, nil
+	default:
+		return nil, fmt.Errorf("driver: invalid dsn param rebalance=%q, must be range, roundrobin or sticky", val)
+	}
+}
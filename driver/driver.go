@@ -0,0 +1,101 @@
+package driver
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hnhuaxi/domain"
+)
+
+// Factory 根据 DSN 创建一对发布者/订阅者构造器，由各个驱动包在 init 中注册
+type Factory func(dsn *DSN, opt *OpenOption) (domain.PublisherMaker, domain.SubscriberMaker, error)
+
+type OpenOption struct {
+	Logger domain.LoggerAdapter
+}
+
+type OpenOptFunc func(opt *OpenOption)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Factory)
+)
+
+func OptLogger(log domain.LoggerAdapter) OpenOptFunc {
+	return func(opt *OpenOption) {
+		opt.Logger = log
+	}
+}
+
+// Register makes a driver available by the provided scheme.
+// If Register is called twice with the same scheme or if factory is nil, it panics.
+func Register(scheme string, factory Factory) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if factory == nil {
+		panic("driver: Register factory is nil")
+	}
+
+	if _, dup := drivers[scheme]; dup {
+		panic("driver: Register called twice for driver " + scheme)
+	}
+
+	drivers[scheme] = factory
+}
+
+// Drivers returns a sorted list of the schemes of the registered drivers.
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	var list = make([]string, 0, len(drivers))
+	for scheme := range drivers {
+		list = append(list, scheme)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+func Lookup(scheme string) (Factory, bool) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	factory, ok := drivers[scheme]
+	return factory, ok
+}
+
+// Open 解析 dsn，例如 kafka://broker1,broker2?group=x 或 nsq://host:4150?channel=y，
+// 并返回对应驱动的 PublisherMaker/SubscriberMaker
+func Open(dsn string, opts ...OpenOptFunc) (domain.PublisherMaker, domain.SubscriberMaker, error) {
+	var opt = OpenOption{
+		Logger: domain.Logger,
+	}
+
+	for _, op := range opts {
+		op(&opt)
+	}
+
+	if opt.Logger == nil {
+		opt.Logger = domain.Logger
+	}
+
+	parsed, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	factory, ok := Lookup(parsed.Scheme)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: unknown driver %q (forgotten import?)", domain.ErrInvalidDriverType, parsed.Scheme)
+	}
+
+	publisherMaker, subscriberMaker, err := factory(parsed, &opt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("driver: open %s failed: %w", parsed.Scheme, err)
+	}
+
+	return publisherMaker, subscriberMaker, nil
+}
@@ -0,0 +1,101 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/hnhuaxi/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDSN(t *testing.T) {
+	dsn, err := ParseDSN("kafka://broker1:9092,broker2:9092?group=x&workers=4&ack_wait=30s&sync=true")
+	assert.NoError(t, err)
+	assert.Equal(t, "kafka", dsn.Scheme)
+	assert.Equal(t, []string{"broker1:9092", "broker2:9092"}, dsn.Hosts())
+	assert.Equal(t, "x", dsn.Get("group"))
+	assert.Equal(t, "def", dsn.Get("missing", "def"))
+
+	workers, err := dsn.Int("workers", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, workers)
+
+	ackWait, err := dsn.Duration("ack_wait", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, ackWait)
+
+	sync, err := dsn.Bool("sync", false)
+	assert.NoError(t, err)
+	assert.True(t, sync)
+
+	_, err = dsn.Int("group", 0)
+	assert.Error(t, err)
+
+	_, err = ParseDSN("//localhost:4150")
+	assert.Error(t, err)
+}
+
+func TestOpenUnknown(t *testing.T) {
+	_, _, err := Open("unknown://localhost")
+	assert.True(t, errors.Is(err, domain.ErrInvalidDriverType))
+}
+
+func TestOpenGochannel(t *testing.T) {
+	assert.Contains(t, Drivers(), "gochannel")
+
+	publisherMaker, subscriberMaker, err := Open("gochannel://?buffer=1")
+	assert.NoError(t, err)
+
+	subscriber, err := subscriberMaker()
+	assert.NoError(t, err)
+
+	publisher, err := publisherMaker()
+	assert.NoError(t, err)
+	defer publisher.Close()
+
+	messages, err := subscriber.Subscribe(context.Background(), "test")
+	assert.NoError(t, err)
+
+	assert.NoError(t, publisher.Publish("test", message.NewMessage("1", []byte("hello"))))
+
+	select {
+	case msg := <-messages:
+		assert.Equal(t, "hello", string(msg.Payload))
+		msg.Ack()
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting message")
+	}
+}
+
+func TestKafkaDSNOptions(t *testing.T) {
+	dsn, err := ParseDSN("kafka://localhost:9092?offset=oldest&rebalance=sticky")
+	assert.NoError(t, err)
+
+	offset, err := kafkaInitialOffset(dsn)
+	assert.NoError(t, err)
+	assert.Equal(t, sarama.OffsetOldest, offset)
+
+	rebalance, err := kafkaRebalanceStrategy(dsn)
+	assert.NoError(t, err)
+	assert.Equal(t, sarama.BalanceStrategySticky, rebalance)
+
+	// 默认不覆盖 sarama 的配置
+	dsn, _ = ParseDSN("kafka://localhost:9092")
+	offset, err = kafkaInitialOffset(dsn)
+	assert.NoError(t, err)
+	assert.Zero(t, offset)
+
+	rebalance, err = kafkaRebalanceStrategy(dsn)
+	assert.NoError(t, err)
+	assert.Nil(t, rebalance)
+
+	dsn, _ = ParseDSN("kafka://localhost:9092?offset=first&rebalance=random")
+	_, err = kafkaInitialOffset(dsn)
+	assert.Error(t, err)
+	_, err = kafkaRebalanceStrategy(dsn)
+	assert.Error(t, err)
+}
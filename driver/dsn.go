@@ -0,0 +1,117 @@
+package driver
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DSN is a parsed driver connection string, the host part may hold
+// several comma separated addresses, e.g. kafka://broker1:9092,broker2:9092?group=x
+type DSN struct {
+	*url.URL
+
+	query url.Values
+}
+
+func ParseDSN(dsn string) (*DSN, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("driver: invalid dsn: %w", err)
+	}
+
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("driver: invalid dsn %q, missing scheme", dsn)
+	}
+
+	return &DSN{
+		URL:   u,
+		query: u.Query(),
+	}, nil
+}
+
+// Hosts returns all addresses of the host part
+func (dsn *DSN) Hosts() []string {
+	var hosts = make([]string, 0)
+	for _, host := range strings.Split(dsn.Host, ",") {
+		if host = strings.TrimSpace(host); len(host) > 0 {
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts
+}
+
+func (dsn *DSN) Has(key string) bool {
+	return dsn.query.Has(key)
+}
+
+func (dsn *DSN) Get(key string, def ...string) string {
+	if val := dsn.query.Get(key); len(val) > 0 {
+		return val
+	}
+
+	if len(def) > 0 {
+		return def[0]
+	}
+
+	return ""
+}
+
+// Values returns all values of key, comma separated values are split
+func (dsn *DSN) Values(key string) []string {
+	var vals []string
+	for _, val := range dsn.query[key] {
+		for _, v := range strings.Split(val, ",") {
+			if v = strings.TrimSpace(v); len(v) > 0 {
+				vals = append(vals, v)
+			}
+		}
+	}
+
+	return vals
+}
+
+func (dsn *DSN) Int(key string, def int) (int, error) {
+	val := dsn.query.Get(key)
+	if val == "" {
+		return def, nil
+	}
+
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		return def, fmt.Errorf("driver: invalid dsn param %s=%q: %w", key, val, err)
+	}
+
+	return i, nil
+}
+
+func (dsn *DSN) Bool(key string, def bool) (bool, error) {
+	val := dsn.query.Get(key)
+	if val == "" {
+		return def, nil
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return def, fmt.Errorf("driver: invalid dsn param %s=%q: %w", key, val, err)
+	}
+
+	return b, nil
+}
+
+func (dsn *DSN) Duration(key string, def time.Duration) (time.Duration, error) {
+	val := dsn.query.Get(key)
+	if val == "" {
+		return def, nil
+	}
+
+	dt, err := time.ParseDuration(val)
+	if err != nil {
+		return def, fmt.Errorf("driver: invalid dsn param %s=%q: %w", key, val, err)
+	}
+
+	return dt, nil
+}
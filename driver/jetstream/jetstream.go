@@ -0,0 +1,251 @@
+package jetstream
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexCuse/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/creasty/defaults"
+	"github.com/hnhuaxi/domain"
+	"github.com/nats-io/nats.go"
+)
+
+type (
+	Marshaler            = jetstream.Marshaler
+	Unmarshaler          = jetstream.Unmarshaler
+	MarshalerUnmarshaler = jetstream.MarshalerUnmarshaler
+	GobMarshaler         = jetstream.GobMarshaler
+	JSONMarshaler        = jetstream.JSONMarshaler
+	NATSMarshaler        = jetstream.NATSMarshaler
+)
+
+// StreamConfig 自动创建 stream 时使用的配置，stream 的名称和 subject 由 topic 决定
+type StreamConfig struct {
+	Storage   nats.StorageType
+	Retention nats.RetentionPolicy
+	// MaxAge 消息保留时间，0 为不限制
+	MaxAge time.Duration
+	// Duplicates 按 Nats-Msg-Id 去重的时间窗口，配合 PublisherConfig.TrackMsgID 使用
+	Duplicates time.Duration
+	Replicas   int `default:"1"`
+}
+
+type PublisherConfig struct {
+	URL         string `default:"nats://127.0.0.1:4222"`
+	NatsOptions []nats.Option
+	// AutoProvision 发布前确保 topic 对应的 stream 存在
+	AutoProvision bool
+	Stream        StreamConfig
+	// TrackMsgID 使用消息 UUID 作为 Nats-Msg-Id，在 Stream.Duplicates 窗口内去重
+	TrackMsgID bool
+	Marshaler  Marshaler
+	Logger     domain.LoggerAdapter
+}
+
+type SubscriberConfig struct {
+	URL         string `default:"nats://127.0.0.1:4222"`
+	NatsOptions []nats.Option
+	// DurableName 持久化消费者的名称，重启后从上次确认的位置继续消费
+	DurableName string
+	// QueueGroup 同一个 queue group 的订阅者分担消息，Subscribers 大于 1 时必须设置
+	QueueGroup string
+	// Subscribers 每个 topic 的订阅数量
+	Subscribers int `default:"1"`
+	// AckWait 等待 Ack 的时间，超时后消息会重新投递
+	AckWait time.Duration `default:"30s"`
+	// MaxDeliver 消息最多投递的次数，0 为不限制
+	MaxDeliver int
+	// CloseTimeout Close 时等待处理中消息的时间
+	CloseTimeout time.Duration `default:"30s"`
+	// AutoProvision 订阅前确保 topic 对应的 stream 存在
+	AutoProvision    bool
+	Stream           StreamConfig
+	SubscribeOptions []nats.SubOpt
+	Unmarshaler      Unmarshaler
+	Logger           domain.LoggerAdapter
+}
+
+func PublisherMaker(cfg PublisherConfig) domain.PublisherMaker {
+	return func() (domain.Publisher, error) {
+		if err := defaults.Set(&cfg); err != nil {
+			return nil, err
+		}
+
+		if cfg.Marshaler == nil {
+			cfg.Marshaler = JSONMarshaler{}
+		}
+
+		if cfg.Logger == nil {
+			cfg.Logger = domain.Logger
+		}
+
+		conn, err := nats.Connect(cfg.URL, cfg.NatsOptions...)
+		if err != nil {
+			return nil, err
+		}
+
+		pub, err := jetstream.NewPublisherWithNatsConn(conn, jetstream.PublisherPublishConfig{
+			Marshaler:  cfg.Marshaler,
+			TrackMsgId: cfg.TrackMsgID,
+		}, cfg.Logger)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		js, err := conn.JetStream()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return &publisher{
+			Publisher:   pub,
+			provisioner: newProvisioner(js, cfg.Stream, cfg.AutoProvision),
+		}, nil
+	}
+}
+
+type publisher struct {
+	*jetstream.Publisher
+	provisioner *provisioner
+}
+
+// Publish waits for the JetStream ack of every message
+func (pub *publisher) Publish(topic string, messages ...*message.Message) error {
+	if err := pub.provisioner.ensure(topic); err != nil {
+		return err
+	}
+
+	return pub.Publisher.Publish(topic, messages...)
+}
+
+func SubscriberMaker(cfg SubscriberConfig) domain.SubscriberMaker {
+	return func() (domain.Subscriber, error) {
+		if err := defaults.Set(&cfg); err != nil {
+			return nil, err
+		}
+
+		if cfg.Unmarshaler == nil {
+			cfg.Unmarshaler = JSONMarshaler{}
+		}
+
+		if cfg.Logger == nil {
+			cfg.Logger = domain.Logger
+		}
+
+		var opts = []nats.SubOpt{
+			nats.ManualAck(),
+			nats.AckExplicit(),
+			nats.AckWait(cfg.AckWait),
+		}
+
+		if cfg.MaxDeliver > 0 {
+			opts = append(opts, nats.MaxDeliver(cfg.MaxDeliver))
+		}
+
+		conn, err := nats.Connect(cfg.URL, cfg.NatsOptions...)
+		if err != nil {
+			return nil, err
+		}
+
+		sub, err := jetstream.NewSubscriberWithNatsConn(conn, jetstream.SubscriberSubscriptionConfig{
+			Unmarshaler:      cfg.Unmarshaler,
+			QueueGroup:       cfg.QueueGroup,
+			DurableName:      cfg.DurableName,
+			SubscribersCount: cfg.Subscribers,
+			AckWaitTimeout:   cfg.AckWait,
+			CloseTimeout:     cfg.CloseTimeout,
+			SubscribeOptions: append(opts, cfg.SubscribeOptions...),
+		}, cfg.Logger)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		js, err := conn.JetStream()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return &subscriber{
+			Subscriber:  sub,
+			provisioner: newProvisioner(js, cfg.Stream, cfg.AutoProvision),
+		}, nil
+	}
+}
+
+type subscriber struct {
+	*jetstream.Subscriber
+	provisioner *provisioner
+}
+
+func (sub *subscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	if err := sub.provisioner.ensure(topic); err != nil {
+		return nil, err
+	}
+
+	return sub.Subscriber.Subscribe(ctx, topic)
+}
+
+// StreamName 返回 topic 对应的 stream 名称，stream 名称中不能包含 "."
+func StreamName(topic string) string {
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_").Replace(topic)
+}
+
+// provisioner 创建 topic 对应的 stream，消息发送到 "{topic}.{uuid}"，所以 stream 的 subject 是 "{topic}.*"
+type provisioner struct {
+	js      nats.JetStreamManager
+	config  StreamConfig
+	enabled bool
+	streams sync.Map
+}
+
+func newProvisioner(js nats.JetStreamManager, config StreamConfig, enabled bool) *provisioner {
+	return &provisioner{
+		js:      js,
+		config:  config,
+		enabled: enabled,
+	}
+}
+
+func (p *provisioner) ensure(topic string) error {
+	if !p.enabled {
+		return nil
+	}
+
+	if _, ok := p.streams.Load(topic); ok {
+		return nil
+	}
+
+	var name = StreamName(topic)
+
+	_, err := p.js.StreamInfo(name)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = p.js.AddStream(&nats.StreamConfig{
+			Name:       name,
+			Subjects:   []string{topic + ".*"},
+			Storage:    p.config.Storage,
+			Retention:  p.config.Retention,
+			MaxAge:     p.config.MaxAge,
+			Duplicates: p.config.Duplicates,
+			Replicas:   p.config.Replicas,
+		})
+
+		if errors.Is(err, nats.ErrStreamNameAlreadyInUse) {
+			err = nil
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	p.streams.Store(topic, struct{}{})
+	return nil
+}
@@ -0,0 +1,122 @@
+package jetstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/hnhuaxi/domain/driver"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func runServer(t *testing.T) *server.Server {
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Start()
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server is not ready")
+	}
+	t.Cleanup(s.Shutdown)
+
+	return s
+}
+
+func receive(t *testing.T, messages <-chan *message.Message) *message.Message {
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting message")
+		return nil
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	var s = runServer(t)
+
+	pub, err := PublisherMaker(PublisherConfig{
+		URL:           s.ClientURL(),
+		AutoProvision: true,
+	})()
+	assert.NoError(t, err)
+	defer pub.Close()
+
+	sub, err := SubscriberMaker(SubscriberConfig{
+		URL:           s.ClientURL(),
+		DurableName:   "test",
+		QueueGroup:    "test",
+		Subscribers:   2,
+		AckWait:       time.Second,
+		MaxDeliver:    3,
+		AutoProvision: true,
+	})()
+	assert.NoError(t, err)
+	defer sub.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := sub.Subscribe(ctx, "messagebus.BookRoom")
+	assert.NoError(t, err)
+
+	msg := message.NewMessage("uuid-1", []byte(`{"room":1}`))
+	msg.Metadata.Set("name", "BookRoom")
+	assert.NoError(t, pub.Publish("messagebus.BookRoom", msg))
+
+	received := receive(t, messages)
+	assert.Equal(t, msg.UUID, received.UUID)
+	assert.Equal(t, msg.Payload, received.Payload)
+	assert.Equal(t, "BookRoom", received.Metadata.Get("name"))
+
+	// Nack 之后消息会重新投递
+	received.Nack()
+
+	received = receive(t, messages)
+	assert.Equal(t, msg.UUID, received.UUID)
+	received.Ack()
+}
+
+func TestOpen(t *testing.T) {
+	var s = runServer(t)
+
+	pm, sm, err := driver.Open(s.ClientURL() + "?durable_name=orders&max_deliver=5&marshaler=nats")
+	assert.NoError(t, err)
+
+	pub, err := pm()
+	assert.NoError(t, err)
+	defer pub.Close()
+
+	sub, err := sm()
+	assert.NoError(t, err)
+	defer sub.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, err := sub.Subscribe(ctx, "orders")
+	assert.NoError(t, err)
+
+	assert.NoError(t, pub.Publish("orders", message.NewMessage("uuid-2", []byte("beer"))))
+
+	received := receive(t, messages)
+	assert.Equal(t, "uuid-2", received.UUID)
+	received.Ack()
+
+	_, _, err = driver.Open(s.ClientURL() + "?marshaler=xml")
+	assert.Error(t, err)
+
+	_, _, err = driver.Open(s.ClientURL() + "?subscribers=2")
+	assert.Error(t, err)
+}
@@ -0,0 +1,390 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/creasty/defaults"
+	"go.uber.org/multierr"
+)
+
+type AdminConfig struct {
+	Brokers []string
+	// Timeout 每个管理操作在 broker 上的最长执行时间
+	Timeout time.Duration `default:"1m"`
+	// ConfigMap 额外的 librdkafka 配置，会覆盖默认值
+	ConfigMap kafka.ConfigMap
+}
+
+// Admin 提供 topic 创建和消费组 lag 查询、offset 重置等运维操作
+type Admin struct {
+	config AdminConfig
+	client *kafka.AdminClient
+}
+
+// TopicSpec 描述一个需要存在的 topic
+type TopicSpec struct {
+	Topic             string
+	Partitions        int `default:"1"`
+	ReplicationFactor int `default:"1"`
+	Config            map[string]string
+}
+
+// PartitionLag 消费组在一个分区上的进度
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	// Committed 已提交的 offset，没有提交过时为 -1
+	Committed int64
+	// High 分区的最新 offset (high watermark)
+	High int64
+	Lag  int64
+}
+
+type GroupLag struct {
+	Group      string
+	State      string
+	Partitions []PartitionLag
+	Total      int64
+}
+
+func NewAdmin(cfg AdminConfig) (*Admin, error) {
+	if err := defaults.Set(&cfg); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Brokers) == 0 {
+		return nil, errors.New("kafka: missing brokers")
+	}
+
+	var cm = kafka.ConfigMap{
+		"bootstrap.servers": strings.Join(cfg.Brokers, ","),
+	}
+
+	for key, val := range cfg.ConfigMap {
+		cm[key] = val
+	}
+
+	client, err := kafka.NewAdminClient(&cm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Admin{
+		config: cfg,
+		client: client,
+	}, nil
+}
+
+func (admin *Admin) Close() {
+	admin.client.Close()
+}
+
+// For 以当前 spec 为模板生成多个 topic 的 spec，例如 MessageBus.Topics() 返回的所有 topic
+func (spec TopicSpec) For(topics ...string) []TopicSpec {
+	var specs = make([]TopicSpec, 0, len(topics))
+	for _, topic := range topics {
+		s := spec
+		s.Topic = topic
+		specs = append(specs, s)
+	}
+
+	return specs
+}
+
+// EnsureTopics 创建不存在的 topic，已存在但分区数不足的 topic 会增加分区，可以重复调用
+func (admin *Admin) EnsureTopics(ctx context.Context, specs ...TopicSpec) error {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	var topicSpecs = make([]kafka.TopicSpecification, 0, len(specs))
+	for _, spec := range specs {
+		if err := defaults.Set(&spec); err != nil {
+			return err
+		}
+
+		topicSpecs = append(topicSpecs, kafka.TopicSpecification{
+			Topic:             spec.Topic,
+			NumPartitions:     spec.Partitions,
+			ReplicationFactor: spec.ReplicationFactor,
+			Config:            spec.Config,
+		})
+	}
+
+	results, err := admin.client.CreateTopics(ctx, topicSpecs, kafka.SetAdminOperationTimeout(admin.config.Timeout))
+	if err != nil {
+		return err
+	}
+
+	var (
+		errs   error
+		exists = make([]kafka.TopicSpecification, 0)
+	)
+
+	for i, result := range results {
+		switch result.Error.Code() {
+		case kafka.ErrNoError:
+		case kafka.ErrTopicAlreadyExists:
+			exists = append(exists, topicSpecs[i])
+		default:
+			errs = multierr.Append(errs, fmt.Errorf("kafka: create topic %s failed: %w", result.Topic, result.Error))
+		}
+	}
+
+	if len(exists) > 0 {
+		errs = multierr.Append(errs, admin.ensurePartitions(ctx, exists))
+	}
+
+	return errs
+}
+
+func (admin *Admin) ensurePartitions(ctx context.Context, specs []kafka.TopicSpecification) error {
+	var names = make([]string, 0, len(specs))
+	for _, spec := range specs {
+		names = append(names, spec.Topic)
+	}
+
+	described, err := admin.client.DescribeTopics(ctx, kafka.NewTopicCollectionOfTopicNames(names))
+	if err != nil {
+		return err
+	}
+
+	var current = make(map[string]int)
+	for _, desc := range described.TopicDescriptions {
+		if desc.Error.Code() != kafka.ErrNoError {
+			return fmt.Errorf("kafka: describe topic %s failed: %w", desc.Name, desc.Error)
+		}
+		current[desc.Name] = len(desc.Partitions)
+	}
+
+	var increase []kafka.PartitionsSpecification
+	for _, spec := range specs {
+		if count, ok := current[spec.Topic]; ok && count < spec.NumPartitions {
+			increase = append(increase, kafka.PartitionsSpecification{
+				Topic:      spec.Topic,
+				IncreaseTo: spec.NumPartitions,
+			})
+		}
+	}
+
+	if len(increase) == 0 {
+		return nil
+	}
+
+	results, err := admin.client.CreatePartitions(ctx, increase, kafka.SetAdminOperationTimeout(admin.config.Timeout))
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, result := range results {
+		if result.Error.Code() != kafka.ErrNoError {
+			errs = multierr.Append(errs, fmt.Errorf("kafka: create partitions of %s failed: %w", result.Topic, result.Error))
+		}
+	}
+
+	return errs
+}
+
+// ListGroups 返回所有消费组的名称
+func (admin *Admin) ListGroups(ctx context.Context) ([]string, error) {
+	result, err := admin.client.ListConsumerGroups(ctx, kafka.SetAdminRequestTimeout(admin.config.Timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	var groups = make([]string, 0, len(result.Valid))
+	for _, listing := range result.Valid {
+		groups = append(groups, listing.GroupID)
+	}
+	sort.Strings(groups)
+
+	return groups, multierr.Combine(result.Errors...)
+}
+
+// ConsumerLags 返回所有消费组在每个分区上的 lag
+func (admin *Admin) ConsumerLags(ctx context.Context) ([]GroupLag, error) {
+	groups, err := admin.ListGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var lags = make([]GroupLag, 0, len(groups))
+	for _, group := range groups {
+		lag, err := admin.GroupLag(ctx, group)
+		if err != nil {
+			return nil, err
+		}
+		lags = append(lags, *lag)
+	}
+
+	return lags, nil
+}
+
+// GroupLag 返回消费组在已提交过 offset 的每个分区上的 lag
+func (admin *Admin) GroupLag(ctx context.Context, group string) (*GroupLag, error) {
+	var lag = &GroupLag{Group: group}
+
+	described, err := admin.client.DescribeConsumerGroups(ctx, []string{group})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, desc := range described.ConsumerGroupDescriptions {
+		if desc.Error.Code() != kafka.ErrNoError {
+			return nil, fmt.Errorf("kafka: describe group %s failed: %w", group, desc.Error)
+		}
+		lag.State = desc.State.String()
+	}
+
+	committed, err := admin.client.ListConsumerGroupOffsets(ctx, []kafka.ConsumerGroupTopicPartitions{{
+		Group: group,
+	}}, kafka.SetAdminRequireStableOffsets(true))
+	if err != nil {
+		return nil, err
+	}
+
+	var specs = make(map[kafka.TopicPartition]kafka.OffsetSpec)
+	for _, gtp := range committed.ConsumerGroupsTopicPartitions {
+		for _, tp := range gtp.Partitions {
+			if tp.Error != nil {
+				return nil, fmt.Errorf("kafka: list offsets of group %s failed: %w", group, tp.Error)
+			}
+			specs[kafka.TopicPartition{Topic: tp.Topic, Partition: tp.Partition}] = kafka.LatestOffsetSpec
+			lag.Partitions = append(lag.Partitions, PartitionLag{
+				Topic:     *tp.Topic,
+				Partition: tp.Partition,
+				Committed: int64(tp.Offset),
+			})
+		}
+	}
+
+	if len(specs) == 0 {
+		return lag, nil
+	}
+
+	highs, err := admin.client.ListOffsets(ctx, specs)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest = make(map[string]int64)
+	for tp, info := range highs.ResultInfos {
+		if info.Error.Code() != kafka.ErrNoError {
+			return nil, fmt.Errorf("kafka: list latest offset of %s failed: %w", tp, info.Error)
+		}
+		latest[partitionKey(*tp.Topic, tp.Partition)] = int64(info.Offset)
+	}
+
+	for i := range lag.Partitions {
+		p := &lag.Partitions[i]
+		p.High = latest[partitionKey(p.Topic, p.Partition)]
+		if p.Committed >= 0 {
+			p.Lag = p.High - p.Committed
+		} else {
+			p.Lag = p.High
+		}
+		lag.Total += p.Lag
+	}
+
+	sort.Slice(lag.Partitions, func(i, j int) bool {
+		if lag.Partitions[i].Topic != lag.Partitions[j].Topic {
+			return lag.Partitions[i].Topic < lag.Partitions[j].Topic
+		}
+		return lag.Partitions[i].Partition < lag.Partitions[j].Partition
+	})
+
+	return lag, nil
+}
+
+// ResetOffsetsToTime 将消费组在 topic 所有分区上的 offset 重置到 ts 之后的第一条消息，用于重放。
+// 消费组必须没有活跃的成员，ts 之后没有消息的分区重置到最新 offset
+func (admin *Admin) ResetOffsetsToTime(ctx context.Context, group, topic string, ts time.Time) ([]kafka.TopicPartition, error) {
+	described, err := admin.client.DescribeTopics(ctx, kafka.NewTopicCollectionOfTopicNames([]string{topic}))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		byTime = make(map[kafka.TopicPartition]kafka.OffsetSpec)
+		byHigh = make(map[kafka.TopicPartition]kafka.OffsetSpec)
+	)
+
+	for _, desc := range described.TopicDescriptions {
+		if desc.Error.Code() != kafka.ErrNoError {
+			return nil, fmt.Errorf("kafka: describe topic %s failed: %w", desc.Name, desc.Error)
+		}
+
+		for _, p := range desc.Partitions {
+			tp := kafka.TopicPartition{Topic: &topic, Partition: int32(p.Partition)}
+			byTime[tp] = kafka.NewOffsetSpecForTimestamp(ts.UnixMilli())
+			byHigh[tp] = kafka.LatestOffsetSpec
+		}
+	}
+
+	timeOffsets, err := admin.client.ListOffsets(ctx, byTime)
+	if err != nil {
+		return nil, err
+	}
+
+	highOffsets, err := admin.client.ListOffsets(ctx, byHigh)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest = make(map[int32]kafka.Offset)
+	for tp, info := range highOffsets.ResultInfos {
+		latest[tp.Partition] = info.Offset
+	}
+
+	var partitions = make([]kafka.TopicPartition, 0, len(timeOffsets.ResultInfos))
+	for tp, info := range timeOffsets.ResultInfos {
+		if info.Error.Code() != kafka.ErrNoError {
+			return nil, fmt.Errorf("kafka: list offset of %s at %s failed: %w", tp, ts, info.Error)
+		}
+
+		offset := info.Offset
+		if offset < 0 {
+			offset = latest[tp.Partition]
+		}
+
+		partitions = append(partitions, kafka.TopicPartition{
+			Topic:     &topic,
+			Partition: tp.Partition,
+			Offset:    offset,
+		})
+	}
+
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].Partition < partitions[j].Partition
+	})
+
+	result, err := admin.client.AlterConsumerGroupOffsets(ctx, []kafka.ConsumerGroupTopicPartitions{{
+		Group:      group,
+		Partitions: partitions,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	var errs error
+	for _, gtp := range result.ConsumerGroupsTopicPartitions {
+		for _, tp := range gtp.Partitions {
+			if tp.Error != nil {
+				errs = multierr.Append(errs, fmt.Errorf("kafka: reset offset of %s failed: %w", tp, tp.Error))
+			}
+		}
+	}
+
+	return partitions, errs
+}
+
+func partitionKey(topic string, partition int32) string {
+	return fmt.Sprintf("%s/%d", topic, partition)
+}
@@ -0,0 +1,40 @@
+package kafka
+
+import (
+	"context"
+	"time"
+)
+
+type contextKey int
+
+const (
+	_ contextKey = iota
+	keyContextKey
+	partitionContextKey
+	partitionOffsetContextKey
+	timestampContextKey
+)
+
+// MessageKeyFromCtx returns Kafka key of the consumed message
+func MessageKeyFromCtx(ctx context.Context) ([]byte, bool) {
+	key, ok := ctx.Value(keyContextKey).([]byte)
+	return key, ok
+}
+
+// MessagePartitionFromCtx returns Kafka partition of the consumed message
+func MessagePartitionFromCtx(ctx context.Context) (int32, bool) {
+	partition, ok := ctx.Value(partitionContextKey).(int32)
+	return partition, ok
+}
+
+// MessagePartitionOffsetFromCtx returns Kafka partition offset of the consumed message
+func MessagePartitionOffsetFromCtx(ctx context.Context) (int64, bool) {
+	offset, ok := ctx.Value(partitionOffsetContextKey).(int64)
+	return offset, ok
+}
+
+// MessageTimestampFromCtx returns Kafka internal timestamp of the consumed message
+func MessageTimestampFromCtx(ctx context.Context) (time.Time, bool) {
+	timestamp, ok := ctx.Value(timestampContextKey).(time.Time)
+	return timestamp, ok
+}
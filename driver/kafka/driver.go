@@ -0,0 +1,47 @@
+package kafka
+
+import (
+	"errors"
+
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/driver"
+)
+
+func init() {
+	// "kafka" is taken by the watermill (sarama) driver, this one is backed by librdkafka
+	driver.Register("confluent", open)
+}
+
+// confluent://broker1:9092,broker2:9092?group=x&offset_reset=earliest&sync=true&idempotent=true&transactional_id=t
+func open(dsn *driver.DSN, opt *driver.OpenOption) (domain.PublisherMaker, domain.SubscriberMaker, error) {
+	var brokers = dsn.Hosts()
+	if len(brokers) == 0 {
+		return nil, nil, errors.New("kafka: dsn must have at least one broker")
+	}
+
+	syncDelivery, err := dsn.Bool("sync", false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	idempotent, err := dsn.Bool("idempotent", false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publisherMaker := PublisherMaker(PublisherConfig{
+		Brokers:         brokers,
+		SyncDelivery:    syncDelivery,
+		KeyMetadata:     dsn.Get("key_metadata"),
+		Idempotent:      idempotent,
+		TransactionalID: dsn.Get("transactional_id"),
+	})
+
+	subscriberMaker := SubscriberMaker(SubscribeConfig{
+		Brokers:     brokers,
+		Group:       dsn.Get("group"),
+		OffsetReset: dsn.Get("offset_reset"),
+	})
+
+	return publisherMaker, subscriberMaker, nil
+}
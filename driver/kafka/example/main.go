@@ -28,5 +28,6 @@ func main() {
 	log.Printf("waiting messages")
 	for msg := range chmsg {
 		log.Printf("msg %s", string(msg.Payload))
+		msg.Ack()
 	}
 }
@@ -2,7 +2,9 @@ package kafka
 
 import (
 	"context"
+	"errors"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ThreeDotsLabs/watermill"
@@ -18,23 +20,25 @@ type SubscribeConfig struct {
 	Brokers     []string
 	Group       string
 	OffsetReset string `default:"earliest"`
-	Logger      *logger.Logger
+	// PollTimeout 每次 Poll 等待的时间，也决定了关闭时最长的等待时间
+	PollTimeout time.Duration `default:"100ms"`
+	// NackResendSleep Nack 之后等待多久再重新投递
+	NackResendSleep time.Duration `default:"100ms"`
+	// ConfigMap 额外的 librdkafka 配置，会覆盖默认值
+	ConfigMap kafka.ConfigMap
+	Logger    *logger.Logger
 }
 
 func SubscriberMaker(cfg SubscribeConfig) domain.SubscriberMaker {
 	return func() (domain.Subscriber, error) {
-		defaults.Set(&cfg)
-
-		c, err := kafka.NewConsumer(&kafka.ConfigMap{
-			"bootstrap.servers": strings.Join(cfg.Brokers, ","),
-			"group.id":          cfg.Group,
-			"auto.offset.reset": cfg.OffsetReset,
-		})
-
-		if err != nil {
+		if err := defaults.Set(&cfg); err != nil {
 			return nil, err
 		}
 
+		if len(cfg.Brokers) == 0 {
+			return nil, errors.New("kafka: missing brokers")
+		}
+
 		var log watermill.LoggerAdapter
 
 		if cfg.Logger != nil {
@@ -44,74 +48,193 @@ func SubscriberMaker(cfg SubscribeConfig) domain.SubscriberMaker {
 		}
 
 		return &kafkaSubscribe{
-			log: log,
-			c:   c,
+			config:  cfg,
+			log:     log,
+			closing: make(chan struct{}),
 		}, nil
 	}
 }
 
 type kafkaSubscribe struct {
-	log domain.LoggerAdapter
-	c   *kafka.Consumer
+	config SubscribeConfig
+	log    domain.LoggerAdapter
+
+	closing       chan struct{}
+	closed        bool
+	mu            sync.Mutex
+	subscribersWg sync.WaitGroup
 }
 
+func (sub *kafkaSubscribe) configMap() *kafka.ConfigMap {
+	var cm = kafka.ConfigMap{
+		"bootstrap.servers": strings.Join(sub.config.Brokers, ","),
+		"group.id":          sub.config.Group,
+		"auto.offset.reset": sub.config.OffsetReset,
+		// offset 只在消息 Ack 之后提交
+		"enable.auto.commit": false,
+	}
+
+	for key, val := range sub.config.ConfigMap {
+		cm[key] = val
+	}
+
+	return &cm
+}
+
+// Subscribe returns output channel with messages from provided topic.
+// Channel is closed, when Close() was called on the subscriber or ctx is done.
+//
+// To receive the next message, `Ack()` must be called on the received message,
+// the offset is committed only after the message is acked.
+// If message processing failed and message should be redelivered `Nack()` should be called,
+// the consumer seeks back to the message and it will be delivered again.
 func (sub *kafkaSubscribe) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
-	var ch = make(chan *message.Message, 1)
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.closed {
+		return nil, errors.New("kafka: subscriber closed")
+	}
 
+	c, err := kafka.NewConsumer(sub.configMap())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.SubscribeTopics([]string{topic}, nil); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	var output = make(chan *message.Message)
+
+	sub.subscribersWg.Add(1)
 	go func() {
-		for {
-			msg, err := sub.c.ReadMessage(-1)
-			if err != nil {
-				sub.log.Error("read message error", err, nil)
-				continue
-				// return
-			} else {
-				// The client will automatically try to recover from all errors.
-				sub.c.CommitOffsets([]kafka.TopicPartition{msg.TopicPartition})
-				ch <- message.NewMessage(watermill.NewUUID(), msg.Value)
+		defer sub.subscribersWg.Done()
+		defer close(output)
 
-			}
+		sub.consume(ctx, c, topic, output)
+
+		if err := c.Close(); err != nil {
+			sub.log.Error("close consumer error", err, watermill.LogFields{"topic": topic})
 		}
 	}()
 
-	if err := sub.c.SubscribeTopics([]string{topic}, nil); err != nil {
-		return nil, err
+	return output, nil
+}
+
+func (sub *kafkaSubscribe) consume(ctx context.Context, c *kafka.Consumer, topic string, output chan *message.Message) {
+	var (
+		pollTimeout = int(sub.config.PollTimeout / time.Millisecond)
+		fields      = watermill.LogFields{"topic": topic, "group": sub.config.Group}
+	)
+
+	for {
+		select {
+		case <-sub.closing:
+			sub.log.Trace("subscriber closed, stop consuming", fields)
+			return
+		case <-ctx.Done():
+			sub.log.Trace("context done, stop consuming", fields)
+			return
+		default:
+		}
+
+		switch ev := c.Poll(pollTimeout).(type) {
+		case *kafka.Message:
+			if !sub.processMessage(ctx, c, ev, output, fields) {
+				return
+			}
+		case kafka.Error:
+			if ev.IsFatal() {
+				sub.log.Error("fatal consumer error", ev, fields)
+				return
+			}
+			// The client will automatically try to recover from all other errors.
+			sub.log.Error("consumer error", ev, fields)
+		case nil:
+		default:
+			sub.log.Trace("ignored event", fields.Add(watermill.LogFields{"event": ev.String()}))
+		}
 	}
+}
 
-	return ch, nil
+// processMessage 投递消息并等待 Ack/Nack，返回 false 表示需要停止消费
+func (sub *kafkaSubscribe) processMessage(ctx context.Context, c *kafka.Consumer, kmsg *kafka.Message, output chan *message.Message, fields watermill.LogFields) bool {
+	var (
+		msgCtx, cancel = context.WithCancel(ctx)
+		msg            = unmarshalMessage(msgCtx, kmsg)
+	)
+	defer cancel()
+
+	fields = fields.Add(watermill.LogFields{
+		"message_uuid": msg.UUID,
+		"partition":    kmsg.TopicPartition.Partition,
+		"offset":       kmsg.TopicPartition.Offset,
+	})
+
+	select {
+	case output <- msg:
+		sub.log.Trace("message sent to consumer", fields)
+	case <-sub.closing:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+
+	select {
+	case <-msg.Acked():
+		if _, err := c.CommitMessage(kmsg); err != nil {
+			sub.log.Error("commit offset error", err, fields)
+		}
+		sub.log.Trace("message acked", fields)
+		return true
+	case <-msg.Nacked():
+		sub.log.Trace("message nacked, seek back for redelivery", fields)
+
+		select {
+		case <-time.After(sub.config.NackResendSleep):
+		case <-sub.closing:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+
+		if err := c.Seek(kmsg.TopicPartition, 0); err != nil {
+			sub.log.Error("seek back error", err, fields)
+			return false
+		}
+		return true
+	case <-sub.closing:
+		return false
+	case <-ctx.Done():
+		return false
+	}
 }
 
+// Close closes all subscriptions with their output channels,
+// un-acked messages are not committed and will be redelivered.
 func (sub *kafkaSubscribe) Close() error {
-	return sub.c.Close()
+	sub.mu.Lock()
+	if sub.closed {
+		sub.mu.Unlock()
+		return nil
+	}
+	sub.closed = true
+	close(sub.closing)
+	sub.mu.Unlock()
+
+	sub.subscribersWg.Wait()
+	return nil
 }
 
+// CreateTopic 创建单分区的 topic，已存在时不报错，更多选项见 Admin.EnsureTopics
 func CreateTopic(cfg SubscribeConfig, topic string) error {
-	defaults.Set(&cfg)
-	a, err := kafka.NewAdminClient(&kafka.ConfigMap{"bootstrap.servers": cfg.Brokers[0]})
+	admin, err := NewAdmin(AdminConfig{Brokers: cfg.Brokers})
 	if err != nil {
 		return err
 	}
+	defer admin.Close()
 
-	// Contexts are used to abort or limit the amount of time
-	// the Admin call blocks waiting for a result.
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Create topics on cluster.
-	// Set Admin options to wait for the operation to finish (or at most 60s)
-
-	_, err = a.CreateTopics(
-		ctx,
-		// Multiple topics can be created simultaneously
-		// by providing more TopicSpecification structs here.
-		[]kafka.TopicSpecification{{
-			Topic:         topic,
-			NumPartitions: 1,
-		}},
-		// Admin options
-		kafka.SetAdminOperationTimeout(time.Minute))
-	if err != nil {
-		return err
-	}
-	return nil
+	return admin.EnsureTopics(context.Background(), TopicSpec{Topic: topic})
 }
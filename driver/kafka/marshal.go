@@ -0,0 +1,44 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// UUIDHeaderKey is the same header watermill-kafka uses, so both drivers can read each other's messages
+const UUIDHeaderKey = "_watermill_message_uuid"
+
+// unmarshalMessage converts a consumed kafka message to watermill message,
+// headers are mapped to metadata and key, partition, offset and timestamp are put into the context
+func unmarshalMessage(ctx context.Context, kmsg *kafka.Message) *message.Message {
+	var (
+		uuid     string
+		metadata = make(message.Metadata, len(kmsg.Headers))
+	)
+
+	for _, header := range kmsg.Headers {
+		if header.Key == UUIDHeaderKey {
+			uuid = string(header.Value)
+		} else {
+			metadata.Set(header.Key, string(header.Value))
+		}
+	}
+
+	if uuid == "" {
+		uuid = watermill.NewUUID()
+	}
+
+	msg := message.NewMessage(uuid, kmsg.Value)
+	msg.Metadata = metadata
+
+	ctx = context.WithValue(ctx, keyContextKey, kmsg.Key)
+	ctx = context.WithValue(ctx, partitionContextKey, kmsg.TopicPartition.Partition)
+	ctx = context.WithValue(ctx, partitionOffsetContextKey, int64(kmsg.TopicPartition.Offset))
+	ctx = context.WithValue(ctx, timestampContextKey, kmsg.Timestamp)
+	msg.SetContext(ctx)
+
+	return msg
+}
@@ -0,0 +1,80 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalMessage(t *testing.T) {
+	var (
+		topic     = "orders"
+		timestamp = time.Date(2023, 5, 1, 8, 0, 0, 0, time.UTC)
+		kmsg      = &kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 3, Offset: 42},
+			Key:            []byte("order-1"),
+			Value:          []byte(`{"id":1}`),
+			Timestamp:      timestamp,
+			Headers: []kafka.Header{
+				{Key: UUIDHeaderKey, Value: []byte("uuid-1")},
+				{Key: "trace_id", Value: []byte("abc")},
+			},
+		}
+	)
+
+	msg := unmarshalMessage(context.Background(), kmsg)
+	assert.Equal(t, "uuid-1", msg.UUID)
+	assert.Equal(t, `{"id":1}`, string(msg.Payload))
+	assert.Equal(t, "abc", msg.Metadata.Get("trace_id"))
+	// uuid 头不出现在 metadata 中
+	assert.Len(t, msg.Metadata, 1)
+
+	key, ok := MessageKeyFromCtx(msg.Context())
+	assert.True(t, ok)
+	assert.Equal(t, []byte("order-1"), key)
+
+	partition, ok := MessagePartitionFromCtx(msg.Context())
+	assert.True(t, ok)
+	assert.Equal(t, int32(3), partition)
+
+	offset, ok := MessagePartitionOffsetFromCtx(msg.Context())
+	assert.True(t, ok)
+	assert.Equal(t, int64(42), offset)
+
+	ts, ok := MessageTimestampFromCtx(msg.Context())
+	assert.True(t, ok)
+	assert.Equal(t, timestamp, ts)
+}
+
+func TestUnmarshalMessageWithoutUUID(t *testing.T) {
+	var topic = "orders"
+
+	msg := unmarshalMessage(context.Background(), &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic},
+		Value:          []byte("hello"),
+	})
+	assert.NotEmpty(t, msg.UUID)
+	assert.Empty(t, msg.Metadata)
+
+	_, ok := MessageKeyFromCtx(context.Background())
+	assert.False(t, ok)
+}
+
+func TestSubscribeConfigMap(t *testing.T) {
+	sub := &kafkaSubscribe{config: SubscribeConfig{
+		Brokers:     []string{"broker1:9092", "broker2:9092"},
+		Group:       "g",
+		OffsetReset: "earliest",
+		ConfigMap:   kafka.ConfigMap{"auto.offset.reset": "latest", "session.timeout.ms": 6000},
+	}}
+
+	cm := *sub.configMap()
+	assert.Equal(t, "broker1:9092,broker2:9092", cm["bootstrap.servers"])
+	assert.Equal(t, "g", cm["group.id"])
+	assert.Equal(t, false, cm["enable.auto.commit"])
+	assert.Equal(t, "latest", cm["auto.offset.reset"])
+	assert.Equal(t, 6000, cm["session.timeout.ms"])
+}
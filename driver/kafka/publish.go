@@ -1,82 +1,249 @@
 package kafka
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"go.uber.org/atomic"
+	"go.uber.org/multierr"
 
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/creasty/defaults"
 	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/platform/logger"
 )
 
+var ErrPublisherClosed = errors.New("kafka: publisher closed")
+
 type PublisherConfig struct {
 	Brokers []string
+	// SyncDelivery 同步等待每条消息的投递报告，失败时 Publish 返回错误
+	SyncDelivery bool
+	// KeyMetadata 分区 key 取自 msg.Metadata 中的这个字段，同一个聚合的事件使用相同的 key 以保证顺序
+	KeyMetadata string `default:"partition_key"`
+	// Idempotent 开启幂等生产者 (enable.idempotence)
+	Idempotent bool
+	// TransactionalID 设置后每次 Publish 的消息在一个事务内提交，隐含 Idempotent 和 SyncDelivery
+	TransactionalID string
+	// TransactionTimeout 事务初始化、提交和回滚的超时时间
+	TransactionTimeout time.Duration `default:"30s"`
+	// FlushTimeout Close 时等待未发送消息的时间
+	FlushTimeout time.Duration `default:"10s"`
+	// ConfigMap 额外的 librdkafka 配置，会覆盖默认值
+	ConfigMap kafka.ConfigMap
+	Logger    *logger.Logger
+}
+
+func (cfg *PublisherConfig) configMap() *kafka.ConfigMap {
+	var cm = kafka.ConfigMap{
+		"bootstrap.servers": strings.Join(cfg.Brokers, ","),
+	}
+
+	if cfg.Idempotent || cfg.TransactionalID != "" {
+		cm["enable.idempotence"] = true
+	}
+
+	if cfg.TransactionalID != "" {
+		cm["transactional.id"] = cfg.TransactionalID
+	}
+
+	for key, val := range cfg.ConfigMap {
+		cm[key] = val
+	}
+
+	return &cm
 }
 
 func PublisherMaker(cfg PublisherConfig) domain.PublisherMaker {
 	return func() (domain.Publisher, error) {
-		p, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": strings.Join(cfg.Brokers, ",")})
-		if err != nil {
-			panic(err)
+		if err := defaults.Set(&cfg); err != nil {
+			return nil, err
 		}
 
+		if len(cfg.Brokers) == 0 {
+			return nil, errors.New("kafka: missing brokers")
+		}
+
+		p, err := kafka.NewProducer(cfg.configMap())
 		if err != nil {
 			return nil, err
 		}
 
-		return &kafkaPublisher{
-			log: domain.Logger,
-			p:   p,
-		}, nil
+		var log watermill.LoggerAdapter
+
+		if cfg.Logger != nil {
+			log = domain.StdLogger(cfg.Logger)
+		} else {
+			log = domain.Logger
+		}
+
+		if cfg.TransactionalID != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.TransactionTimeout)
+			defer cancel()
+
+			if err := p.InitTransactions(ctx); err != nil {
+				p.Close()
+				return nil, fmt.Errorf("kafka: init transactions failed: %w", err)
+			}
+		}
+
+		pub := &kafkaPublisher{
+			config: cfg,
+			log:    log,
+			p:      p,
+			done:   make(chan struct{}),
+		}
+
+		go pub.handleEvents()
+
+		return pub, nil
 	}
 }
 
 type kafkaPublisher struct {
-	p     *kafka.Producer
-	log   domain.LoggerAdapter
-	start atomic.Bool
+	config PublisherConfig
+	p      *kafka.Producer
+	log    domain.LoggerAdapter
+	closed atomic.Bool
+	done   chan struct{}
+	// 事务生产者同一时间只能有一个事务
+	txMu sync.Mutex
 }
 
-func (pub *kafkaPublisher) init() {
-	if pub.start.Load() {
-		return
-	}
-
-	pub.start.Store(true)
+// handleEvents 处理异步发送的投递报告
+func (pub *kafkaPublisher) handleEvents() {
+	defer close(pub.done)
 
-	go func() {
-		for e := range pub.p.Events() {
-			switch ev := e.(type) {
-			case *kafka.Message:
-				if ev.TopicPartition.Error != nil {
-					pub.log.Debug("Delivery failed:", watermill.LogFields{"Partition": ev.TopicPartition})
-				} else {
-					pub.log.Debug("Delivered message to:", watermill.LogFields{"Partition": ev.TopicPartition})
-				}
+	for e := range pub.p.Events() {
+		switch ev := e.(type) {
+		case *kafka.Message:
+			if ev.TopicPartition.Error != nil {
+				pub.log.Error("Delivery failed", ev.TopicPartition.Error, watermill.LogFields{"Partition": ev.TopicPartition.String()})
+			} else {
+				pub.log.Trace("Delivered message", watermill.LogFields{"Partition": ev.TopicPartition.String()})
 			}
+		case kafka.Error:
+			pub.log.Error("Producer error", ev, watermill.LogFields{"fatal": ev.IsFatal()})
 		}
-	}()
+	}
+}
+
+func (pub *kafkaPublisher) marshal(topic string, msg *message.Message) *kafka.Message {
+	var headers = make([]kafka.Header, 0, len(msg.Metadata)+1)
+
+	headers = append(headers, kafka.Header{Key: UUIDHeaderKey, Value: []byte(msg.UUID)})
+	for key, val := range msg.Metadata {
+		headers = append(headers, kafka.Header{Key: key, Value: []byte(val)})
+	}
+
+	var kmsg = &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Value:          msg.Payload,
+		Headers:        headers,
+	}
+
+	if key := msg.Metadata.Get(pub.config.KeyMetadata); key != "" {
+		kmsg.Key = []byte(key)
+	}
+
+	return kmsg
 }
 
 // Publish must be thread safe.
 func (pub *kafkaPublisher) Publish(topic string, messages ...*message.Message) error {
-	pub.init()
+	if pub.closed.Load() {
+		return ErrPublisherClosed
+	}
+
+	if pub.config.TransactionalID != "" {
+		return pub.publishTransaction(topic, messages)
+	}
+
+	if pub.config.SyncDelivery {
+		return pub.publishSync(topic, messages)
+	}
+
+	for _, msg := range messages {
+		if err := pub.p.Produce(pub.marshal(topic, msg), nil); err != nil {
+			return fmt.Errorf("kafka: produce message %s failed: %w", msg.UUID, err)
+		}
+	}
+
+	return nil
+}
+
+// publishSync 发送所有消息后等待它们的投递报告
+func (pub *kafkaPublisher) publishSync(topic string, messages []*message.Message) error {
+	var (
+		deliveryChan = make(chan kafka.Event, len(messages))
+		produced     int
+		errs         error
+	)
 
 	for _, msg := range messages {
-		if err := pub.p.Produce(&kafka.Message{
-			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
-			Value:          []byte(msg.Payload),
-		}, nil); err != nil {
-			return err
+		if err := pub.p.Produce(pub.marshal(topic, msg), deliveryChan); err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("kafka: produce message %s failed: %w", msg.UUID, err))
+			break
+		}
+		produced++
+	}
+
+	for i := 0; i < produced; i++ {
+		if ev, ok := (<-deliveryChan).(*kafka.Message); ok && ev.TopicPartition.Error != nil {
+			errs = multierr.Append(errs, fmt.Errorf("kafka: delivery failed: %w", ev.TopicPartition.Error))
+		}
+	}
+
+	return errs
+}
+
+func (pub *kafkaPublisher) publishTransaction(topic string, messages []*message.Message) error {
+	pub.txMu.Lock()
+	defer pub.txMu.Unlock()
+
+	if err := pub.p.BeginTransaction(); err != nil {
+		return fmt.Errorf("kafka: begin transaction failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pub.config.TransactionTimeout)
+	defer cancel()
+
+	if err := pub.publishSync(topic, messages); err != nil {
+		if abortErr := pub.p.AbortTransaction(ctx); abortErr != nil {
+			err = multierr.Append(err, fmt.Errorf("kafka: abort transaction failed: %w", abortErr))
+		}
+		return err
+	}
+
+	if err := pub.p.CommitTransaction(ctx); err != nil {
+		if abortErr := pub.p.AbortTransaction(ctx); abortErr != nil {
+			err = multierr.Append(err, abortErr)
 		}
+		return fmt.Errorf("kafka: commit transaction failed: %w", err)
 	}
+
 	return nil
 }
 
-// Close should flush unsent messages, if publisher is async.
+// Close flushes unsent messages within FlushTimeout, then closes the producer.
 func (pub *kafkaPublisher) Close() error {
+	if !pub.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	var err error
+	if remain := pub.p.Flush(int(pub.config.FlushTimeout / time.Millisecond)); remain > 0 {
+		err = fmt.Errorf("kafka: %d messages were not delivered before close", remain)
+	}
+
 	pub.p.Close()
-	return nil
+	<-pub.done
+
+	return err
 }
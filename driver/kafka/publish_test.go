@@ -0,0 +1,57 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublisherMarshal(t *testing.T) {
+	var (
+		pub = &kafkaPublisher{config: PublisherConfig{KeyMetadata: "partition_key"}}
+		msg = message.NewMessage("uuid-1", []byte("hello"))
+	)
+	msg.Metadata.Set("partition_key", "order-1")
+	msg.Metadata.Set("trace_id", "abc")
+
+	kmsg := pub.marshal("orders", msg)
+	assert.Equal(t, "orders", *kmsg.TopicPartition.Topic)
+	assert.Equal(t, kafka.PartitionAny, kmsg.TopicPartition.Partition)
+	assert.Equal(t, []byte("hello"), kmsg.Value)
+	assert.Equal(t, []byte("order-1"), kmsg.Key)
+	assert.Equal(t, kafka.Header{Key: UUIDHeaderKey, Value: []byte("uuid-1")}, kmsg.Headers[0])
+	assert.ElementsMatch(t, []kafka.Header{
+		{Key: UUIDHeaderKey, Value: []byte("uuid-1")},
+		{Key: "partition_key", Value: []byte("order-1")},
+		{Key: "trace_id", Value: []byte("abc")},
+	}, kmsg.Headers)
+
+	// 反序列化之后得到相同的消息
+	got := unmarshalMessage(msg.Context(), kmsg)
+	assert.Equal(t, msg.UUID, got.UUID)
+	assert.Equal(t, msg.Metadata, got.Metadata)
+}
+
+func TestPublisherMarshalWithoutKey(t *testing.T) {
+	pub := &kafkaPublisher{config: PublisherConfig{KeyMetadata: "partition_key"}}
+
+	kmsg := pub.marshal("orders", message.NewMessage("uuid-1", nil))
+	assert.Nil(t, kmsg.Key)
+	assert.Len(t, kmsg.Headers, 1)
+}
+
+func TestPublisherConfigMap(t *testing.T) {
+	cfg := PublisherConfig{
+		Brokers:         []string{"broker1:9092"},
+		TransactionalID: "tx-1",
+		ConfigMap:       kafka.ConfigMap{"linger.ms": 5},
+	}
+
+	cm := *cfg.configMap()
+	assert.Equal(t, "broker1:9092", cm["bootstrap.servers"])
+	assert.Equal(t, true, cm["enable.idempotence"])
+	assert.Equal(t, "tx-1", cm["transactional.id"])
+	assert.Equal(t, 5, cm["linger.ms"])
+}
@@ -0,0 +1,26 @@
+package local
+
+import (
+	"context"
+	"time"
+)
+
+type contextKey int
+
+const (
+	_ contextKey = iota
+	offsetContextKey
+	timestampContextKey
+)
+
+// MessageOffsetFromCtx returns offset of the consumed message, it can be passed to Store.Seek to replay
+func MessageOffsetFromCtx(ctx context.Context) (uint64, bool) {
+	offset, ok := ctx.Value(offsetContextKey).(uint64)
+	return offset, ok
+}
+
+// MessageTimestampFromCtx returns the time the consumed message was published
+func MessageTimestampFromCtx(ctx context.Context) (time.Time, bool) {
+	timestamp, ok := ctx.Value(timestampContextKey).(time.Time)
+	return timestamp, ok
+}
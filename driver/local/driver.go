@@ -0,0 +1,45 @@
+package local
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/driver"
+)
+
+func init() {
+	driver.Register("local", open)
+}
+
+// local://data/bus.db?group=g&batch_size=100&poll_interval=1s&nack_resend_sleep=1s
+//
+// local:///tmp/bus.db 使用绝对路径，没有路径时使用当前目录下的 watermill.db
+func open(dsn *driver.DSN, opt *driver.OpenOption) (domain.PublisherMaker, domain.SubscriberMaker, error) {
+	var path = filepath.FromSlash(dsn.Host + dsn.Path)
+
+	batchSize, err := dsn.Int("batch_size", 100)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pollInterval, err := dsn.Duration("poll_interval", time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nackResendSleep, err := dsn.Duration("nack_resend_sleep", time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return PubsublisherMaker(Config{
+		Path:   path,
+		Logger: opt.Logger,
+	}, SubscriberConfig{
+		ConsumerGroup:   dsn.Get("group", "default"),
+		BatchSize:       batchSize,
+		PollInterval:    pollInterval,
+		NackResendSleep: nackResendSleep,
+	})
+}
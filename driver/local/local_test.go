@@ -0,0 +1,150 @@
+package local
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/hnhuaxi/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore(t *testing.T, path string) *Store {
+	store, err := Open(Config{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func receive(t *testing.T, messages <-chan *message.Message) *message.Message {
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting message")
+		return nil
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	var store = testStore(t, filepath.Join(t.TempDir(), "bus.db"))
+	defer store.Close()
+
+	pub := store.NewPublisher()
+
+	msg1 := message.NewMessage("uuid-1", []byte("room 1"))
+	msg1.Metadata.Set("name", "BookRoom")
+	assert.NoError(t, pub.Publish("commands", msg1))
+
+	sub, err := store.NewSubscriber(SubscriberConfig{ConsumerGroup: "booking", NackResendSleep: 10 * time.Millisecond})
+	assert.NoError(t, err)
+
+	messages, err := sub.Subscribe(context.Background(), "commands")
+	assert.NoError(t, err)
+
+	// 晚订阅的消费组也能收到之前发布的消息
+	received := receive(t, messages)
+	assert.Equal(t, "uuid-1", received.UUID)
+	assert.Equal(t, "BookRoom", received.Metadata.Get("name"))
+	received.Ack()
+
+	// 发布立即唤醒订阅者，Nack 的消息重新投递
+	assert.NoError(t, pub.Publish("commands", message.NewMessage("uuid-2", []byte("room 2"))))
+
+	received = receive(t, messages)
+	assert.Equal(t, "uuid-2", received.UUID)
+	received.Nack()
+
+	received = receive(t, messages)
+	assert.Equal(t, "uuid-2", received.UUID)
+	received.Ack()
+
+	assert.NoError(t, sub.Close())
+
+	assert.Eventually(t, func() bool {
+		offset, err := store.Offset("booking", "commands")
+		return err == nil && offset == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestPersistAndReplay(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "bus.db")
+
+	store := testStore(t, path)
+	assert.NoError(t, store.NewPublisher().Publish("events",
+		message.NewMessage("uuid-1", nil),
+		message.NewMessage("uuid-2", nil),
+	))
+	assert.NoError(t, store.Seek("billing", "events", 1))
+	assert.NoError(t, store.Close())
+
+	// 重新打开后消息和 offset 仍然存在
+	store = testStore(t, path)
+	defer store.Close()
+
+	sub, err := store.NewSubscriber(SubscriberConfig{ConsumerGroup: "billing"})
+	assert.NoError(t, err)
+
+	messages, err := sub.Subscribe(context.Background(), "events")
+	assert.NoError(t, err)
+
+	received := receive(t, messages)
+	assert.Equal(t, "uuid-2", received.UUID)
+	received.Ack()
+	assert.NoError(t, sub.Close())
+
+	// 从头重放
+	assert.NoError(t, store.Seek("billing", "events", 0))
+
+	sub, err = store.NewSubscriber(SubscriberConfig{ConsumerGroup: "billing"})
+	assert.NoError(t, err)
+	defer sub.Close()
+
+	messages, err = sub.Subscribe(context.Background(), "events")
+	assert.NoError(t, err)
+
+	received = receive(t, messages)
+	assert.Equal(t, "uuid-1", received.UUID)
+	received.Ack()
+}
+
+func TestPubsublisherMakerSharedStore(t *testing.T) {
+	var cfg = Config{Path: filepath.Join(t.TempDir(), "bus.db")}
+
+	// 同一个路径打开两次，每个事件处理器使用自己的消费组
+	publisherMaker, billingMaker, err := PubsublisherMaker(cfg, SubscriberConfig{ConsumerGroup: "billing"})
+	assert.NoError(t, err)
+
+	_, shippingMaker, err := PubsublisherMaker(cfg, SubscriberConfig{ConsumerGroup: "shipping"})
+	assert.NoError(t, err)
+
+	pub, err := publisherMaker()
+	assert.NoError(t, err)
+	assert.NoError(t, pub.Publish("events", message.NewMessage("uuid-1", nil)))
+
+	for _, maker := range []func() (domain.Subscriber, error){billingMaker, shippingMaker} {
+		sub, err := maker()
+		assert.NoError(t, err)
+
+		messages, err := sub.Subscribe(context.Background(), "events")
+		assert.NoError(t, err)
+
+		// 每个消费组都收到同一条消息
+		received := receive(t, messages)
+		assert.Equal(t, "uuid-1", received.UUID)
+		received.Ack()
+
+		assert.NoError(t, sub.Close())
+		assert.NoError(t, sub.Close())
+	}
+
+	assert.NoError(t, pub.Close())
+
+	// 全部关闭之后文件锁被释放
+	store := testStore(t, cfg.Path)
+	assert.NoError(t, store.Close())
+}
@@ -0,0 +1,46 @@
+package local
+
+import (
+	"errors"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go.uber.org/atomic"
+)
+
+var ErrPublisherClosed = errors.New("local: publisher closed")
+
+type Publisher struct {
+	store  *Store
+	closed atomic.Bool
+}
+
+func (s *Store) NewPublisher() *Publisher {
+	return &Publisher{store: s}
+}
+
+// Publish 在一个 bbolt 事务中写入所有消息，返回时消息已经落盘
+func (pub *Publisher) Publish(topic string, messages ...*message.Message) error {
+	if pub.closed.Load() {
+		return ErrPublisherClosed
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	for _, msg := range messages {
+		pub.store.config.Logger.Trace("Publishing message", watermill.LogFields{
+			"message_uuid": msg.UUID,
+			"topic_name":   topic,
+		})
+	}
+
+	return pub.store.append(topic, messages)
+}
+
+// Close 不关闭 Store，Store 由调用者管理
+func (pub *Publisher) Close() error {
+	pub.closed.Store(true)
+	return nil
+}
@@ -0,0 +1,127 @@
+package local
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/hnhuaxi/domain"
+	"go.uber.org/multierr"
+)
+
+// sharedStore 同一个进程中相同路径的 Store 只打开一次，
+// 第一个发布者或订阅者创建时打开，最后一个关闭时关闭
+type sharedStore struct {
+	store *Store
+	refs  int
+}
+
+var (
+	sharedMu     sync.Mutex
+	sharedStores = make(map[string]*sharedStore)
+)
+
+func acquireStore(cfg Config) (*Store, string, error) {
+	key, err := filepath.Abs(cfg.Path)
+	if err != nil {
+		return nil, "", fmt.Errorf("local: invalid path %s: %w", cfg.Path, err)
+	}
+
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+
+	shared, ok := sharedStores[key]
+	if !ok {
+		store, err := Open(cfg)
+		if err != nil {
+			return nil, "", err
+		}
+
+		shared = &sharedStore{store: store}
+		sharedStores[key] = shared
+	}
+
+	shared.refs++
+	return shared.store, key, nil
+}
+
+func releaseStore(key string) error {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+
+	shared, ok := sharedStores[key]
+	if !ok {
+		return nil
+	}
+
+	if shared.refs--; shared.refs > 0 {
+		return nil
+	}
+
+	delete(sharedStores, key)
+	return shared.store.Close()
+}
+
+// PubsublisherMaker 返回共用同一个 Store 的发布者和订阅者构造器，和 domain.GoPubsublisherMaker 对应，
+// Store 在创建发布者或订阅者时打开，全部关闭之后关闭，同一个进程中多次调用可以使用相同的路径
+func PubsublisherMaker(cfg Config, subCfg SubscriberConfig) (domain.PublisherMaker, domain.SubscriberMaker, error) {
+	if cfg.Path == "" {
+		cfg.Path = "watermill.db"
+	}
+
+	publisherMaker := func() (domain.Publisher, error) {
+		store, key, err := acquireStore(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		return &sharedPublisher{Publisher: store.NewPublisher(), key: key}, nil
+	}
+
+	subscriberMaker := func() (domain.Subscriber, error) {
+		store, key, err := acquireStore(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		sub, err := store.NewSubscriber(subCfg)
+		if err != nil {
+			return nil, multierr.Append(err, releaseStore(key))
+		}
+
+		return &sharedSubscriber{Subscriber: sub, key: key}, nil
+	}
+
+	return publisherMaker, subscriberMaker, nil
+}
+
+type sharedPublisher struct {
+	*Publisher
+	key  string
+	once sync.Once
+}
+
+func (pub *sharedPublisher) Close() error {
+	var err error
+	pub.once.Do(func() {
+		err = multierr.Append(pub.Publisher.Close(), releaseStore(pub.key))
+	})
+
+	return err
+}
+
+type sharedSubscriber struct {
+	*Subscriber
+	key  string
+	once sync.Once
+}
+
+// Close 先关闭订阅再释放 Store
+func (sub *sharedSubscriber) Close() error {
+	var err error
+	sub.once.Do(func() {
+		err = multierr.Append(sub.Subscriber.Close(), releaseStore(sub.key))
+	})
+
+	return err
+}
@@ -0,0 +1,247 @@
+// Package local 提供保存在本地 bbolt 文件中的 pub/sub，用于本地开发，
+// 和 gochannel 不同，消息在重启后仍然存在，晚加入的消费组也能从头消费，
+// 每个消费组在每个 topic 上记录 offset，确认之后才前进，提供至少一次的投递语义。
+//
+// bbolt 文件同一时间只能被一个进程打开，发布者和订阅者需要在同一个进程中共用一个 Store，
+// 通过驱动或 PubsublisherMaker 创建的发布者和订阅者按路径共用 Store，不能跨进程使用同一个文件
+package local
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/creasty/defaults"
+	"github.com/hnhuaxi/domain"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	topicsBucket  = []byte("topics")
+	offsetsBucket = []byte("offsets")
+)
+
+type Config struct {
+	// Path bbolt 文件路径，不存在时创建
+	Path string `default:"watermill.db"`
+	// OpenTimeout 文件被其他进程锁住时等待的时间
+	OpenTimeout time.Duration `default:"1s"`
+	Logger      domain.LoggerAdapter
+}
+
+// Store 持有 bbolt 文件，所有 topic 和消费组的 offset 都保存在同一个文件中
+type Store struct {
+	db     *bolt.DB
+	config Config
+
+	// 发布消息时唤醒等待中的订阅者
+	mu      sync.Mutex
+	changed chan struct{}
+
+	// 同一个消费组在同一个 topic 上同一时间只有一个订阅者投递消息
+	groupsMu sync.Mutex
+	groups   map[string]chan struct{}
+}
+
+type record struct {
+	UUID      string           `json:"uuid"`
+	Payload   []byte           `json:"payload"`
+	Metadata  message.Metadata `json:"metadata"`
+	Timestamp time.Time        `json:"timestamp"`
+}
+
+// storedMessage 从文件中读出的消息及其 offset 和发布时间
+type storedMessage struct {
+	offset    uint64
+	timestamp time.Time
+	msg       *message.Message
+}
+
+func Open(cfg Config) (*Store, error) {
+	if err := defaults.Set(&cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = domain.Logger
+	}
+
+	db, err := bolt.Open(cfg.Path, 0600, &bolt.Options{Timeout: cfg.OpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("local: open %s failed: %w", cfg.Path, err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(topicsBucket); err != nil {
+			return err
+		}
+
+		_, err := tx.CreateBucketIfNotExists(offsetsBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{
+		db:      db,
+		config:  cfg,
+		changed: make(chan struct{}),
+		groups:  make(map[string]chan struct{}),
+	}, nil
+}
+
+func (s *Store) PublisherMaker() domain.PublisherMaker {
+	return func() (domain.Publisher, error) {
+		return s.NewPublisher(), nil
+	}
+}
+
+func (s *Store) SubscriberMaker(cfg SubscriberConfig) domain.SubscriberMaker {
+	return func() (domain.Subscriber, error) {
+		return s.NewSubscriber(cfg)
+	}
+}
+
+// Seek 设置消费组在 topic 上已经确认的 offset，下一条投递的是 offset 之后的消息，
+// Seek(group, topic, 0) 从头重放
+func (s *Store) Seek(consumerGroup, topic string, offset uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(offsetsBucket).Put(offsetKey(consumerGroup, topic), itob(offset))
+	})
+}
+
+// Offset 返回消费组在 topic 上已经确认的 offset
+func (s *Store) Offset(consumerGroup, topic string) (uint64, error) {
+	var offset uint64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if val := tx.Bucket(offsetsBucket).Get(offsetKey(consumerGroup, topic)); val != nil {
+			offset = btoi(val)
+		}
+		return nil
+	})
+
+	return offset, err
+}
+
+// Close 关闭 bbolt 文件，之前需要先关闭所有订阅者
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) append(topic string, messages []*message.Message) error {
+	var now = time.Now()
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(topicsBucket).CreateBucketIfNotExists([]byte(topic))
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range messages {
+			data, err := json.Marshal(record{UUID: msg.UUID, Payload: msg.Payload, Metadata: msg.Metadata, Timestamp: now})
+			if err != nil {
+				return fmt.Errorf("local: marshal message %s failed: %w", msg.UUID, err)
+			}
+
+			seq, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			if err := bucket.Put(itob(seq), data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.notify()
+	return nil
+}
+
+// read 返回 offset 之后最多 limit 条消息
+func (s *Store) read(topic string, offset uint64, limit int) ([]storedMessage, error) {
+	var messages []storedMessage
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(topicsBucket).Bucket([]byte(topic))
+		if bucket == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		for key, val := cursor.Seek(itob(offset + 1)); key != nil && len(messages) < limit; key, val = cursor.Next() {
+			var rec record
+			if err := json.Unmarshal(val, &rec); err != nil {
+				return fmt.Errorf("local: unmarshal message %d failed: %w", btoi(key), err)
+			}
+
+			msg := message.NewMessage(rec.UUID, rec.Payload)
+			if rec.Metadata != nil {
+				msg.Metadata = rec.Metadata
+			}
+
+			messages = append(messages, storedMessage{
+				offset:    btoi(key),
+				timestamp: rec.Timestamp,
+				msg:       msg,
+			})
+		}
+
+		return nil
+	})
+
+	return messages, err
+}
+
+func (s *Store) wait() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.changed
+}
+
+func (s *Store) notify() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// groupLock 返回消费组在 topic 上的锁，写入即加锁，读出即解锁，加锁时可以被取消
+func (s *Store) groupLock(consumerGroup, topic string) chan struct{} {
+	s.groupsMu.Lock()
+	defer s.groupsMu.Unlock()
+
+	key := string(offsetKey(consumerGroup, topic))
+	lock, ok := s.groups[key]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		s.groups[key] = lock
+	}
+
+	return lock
+}
+
+func offsetKey(consumerGroup, topic string) []byte {
+	return []byte(consumerGroup + "\x00" + topic)
+}
+
+func itob(v uint64) []byte {
+	var b = make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func btoi(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
@@ -0,0 +1,193 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/creasty/defaults"
+	"go.uber.org/atomic"
+)
+
+var ErrSubscriberClosed = errors.New("local: subscriber closed")
+
+type SubscriberConfig struct {
+	// ConsumerGroup 同一个消费组的订阅者竞争消费，每个消费组在每个 topic 上有自己的 offset，
+	// 新的消费组从第一条消息开始消费
+	ConsumerGroup string `default:"default"`
+	// BatchSize 一次从文件中读取的消息数
+	BatchSize int `default:"100"`
+	// PollInterval 同一个进程中的发布会立即唤醒订阅者，轮询只是兜底
+	PollInterval time.Duration `default:"1s"`
+	// NackResendSleep Nack 之后重新投递前等待的时间
+	NackResendSleep time.Duration `default:"1s"`
+}
+
+type Subscriber struct {
+	store   *Store
+	config  SubscriberConfig
+	closing chan struct{}
+	closed  atomic.Bool
+	wg      sync.WaitGroup
+}
+
+func (s *Store) NewSubscriber(cfg SubscriberConfig) (*Subscriber, error) {
+	if err := defaults.Set(&cfg); err != nil {
+		return nil, err
+	}
+
+	return &Subscriber{
+		store:   s,
+		config:  cfg,
+		closing: make(chan struct{}),
+	}, nil
+}
+
+// Subscribe returns output channel with messages from provided topic.
+//
+// To receive the next message, `Ack()` must be called on the received message.
+// Nacked message is redelivered after NackResendSleep.
+func (sub *Subscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	if sub.closed.Load() {
+		return nil, ErrSubscriberClosed
+	}
+
+	var output = make(chan *message.Message)
+
+	sub.wg.Add(1)
+	go func() {
+		defer sub.wg.Done()
+		defer close(output)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		go func() {
+			select {
+			case <-sub.closing:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		sub.consume(ctx, topic, output)
+	}()
+
+	return output, nil
+}
+
+func (sub *Subscriber) consume(ctx context.Context, topic string, output chan *message.Message) {
+	var (
+		lock   = sub.store.groupLock(sub.config.ConsumerGroup, topic)
+		fields = watermill.LogFields{"topic": topic, "consumer_group": sub.config.ConsumerGroup}
+	)
+
+	for {
+		// 先取得通知再读取，读取之后的发布不会被错过
+		changed := sub.store.wait()
+
+		select {
+		case lock <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+
+		delivered, err := sub.poll(ctx, topic, output)
+		<-lock
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			sub.store.config.Logger.Error("Poll messages failed", err, fields)
+		}
+
+		if delivered > 0 && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		case <-time.After(sub.config.PollInterval):
+		}
+	}
+}
+
+// poll 投递 offset 之后的一批消息，每条消息确认之后提交 offset
+func (sub *Subscriber) poll(ctx context.Context, topic string, output chan *message.Message) (int, error) {
+	offset, err := sub.store.Offset(sub.config.ConsumerGroup, topic)
+	if err != nil {
+		return 0, err
+	}
+
+	messages, err := sub.store.read(topic, offset, sub.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, stored := range messages {
+		msgCtx := context.WithValue(ctx, offsetContextKey, stored.offset)
+		msgCtx = context.WithValue(msgCtx, timestampContextKey, stored.timestamp)
+
+		if !sub.deliver(msgCtx, stored.msg, output) {
+			return i, ctx.Err()
+		}
+
+		if err := sub.store.Seek(sub.config.ConsumerGroup, topic, stored.offset); err != nil {
+			return i, err
+		}
+	}
+
+	return len(messages), nil
+}
+
+// deliver 投递消息直到被确认，Nack 的消息在 NackResendSleep 之后重新投递，返回 false 表示订阅已经结束
+func (sub *Subscriber) deliver(ctx context.Context, msg *message.Message, output chan *message.Message) bool {
+	for {
+		msg := msg.Copy()
+
+		msgCtx, cancel := context.WithCancel(ctx)
+		msg.SetContext(msgCtx)
+
+		select {
+		case output <- msg:
+		case <-ctx.Done():
+			cancel()
+			return false
+		}
+
+		select {
+		case <-msg.Acked():
+			cancel()
+			return true
+		case <-msg.Nacked():
+			cancel()
+		case <-ctx.Done():
+			cancel()
+			return false
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(sub.config.NackResendSleep):
+		}
+	}
+}
+
+// Close closes all subscriptions, offsets of acked messages are already committed.
+func (sub *Subscriber) Close() error {
+	if !sub.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	close(sub.closing)
+	sub.wg.Wait()
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package nats
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/driver"
+	"github.com/nats-io/stan.go"
+)
+
+// NATS Streaming (STAN) 已经废弃，注册为 stan，nats 由 driver/jetstream 提供。
+// 这是不兼容的变更：原来的 nats:// DSN 现在连接 JetStream，继续使用 STAN 需要改为 stan://，
+// events.ConfigDSN 在配置了 ClusterID 时仍然生成 stan:// DSN
+func init() {
+	driver.Register("stan", open)
+}
+
+// stan://localhost:4222?cluster_id=c&client_id=x&queue_group=g&durable_name=d&subscribers=4&close_timeout=1m&ack_wait=30s
+func open(dsn *driver.DSN, opt *driver.OpenOption) (domain.PublisherMaker, domain.SubscriberMaker, error) {
+	var hosts = dsn.Hosts()
+	if len(hosts) == 0 {
+		return nil, nil, errors.New("nats: dsn must have a server address")
+	}
+
+	subscribersCount, err := dsn.Int("subscribers", 1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	closeTimeout, err := dsn.Duration("close_timeout", time.Minute)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ackWait, err := dsn.Duration("ack_wait", 30*time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		clusterID   = dsn.Get("cluster_id", "test-cluster")
+		clientID    = dsn.Get("client_id")
+		stanOptions = []stan.Option{
+			stan.NatsURL("nats://" + hosts[0]),
+		}
+	)
+
+	publisherMaker := NatsPublisherMaker(StreamingPublisherConfig{
+		ClusterID:   clusterID,
+		ClientID:    dsn.Get("publisher_client_id", clientID+"-publisher"),
+		StanOptions: stanOptions,
+		Marshaler:   GobMarshaler{},
+	})
+
+	subscriberMaker := NatsSubscriberMaker(StreamingSubscriberConfig{
+		ClusterID:        clusterID,
+		ClientID:         clientID,
+		QueueGroup:       dsn.Get("queue_group"),
+		DurableName:      dsn.Get("durable_name"),
+		SubscribersCount: subscribersCount,
+		CloseTimeout:     closeTimeout,
+		AckWaitTimeout:   ackWait,
+		StanOptions:      stanOptions,
+		Unmarshaler:      GobMarshaler{},
+	})
+
+	return publisherMaker, subscriberMaker, nil
+}
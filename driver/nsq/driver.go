@@ -0,0 +1,68 @@
+package nsq
+
+import (
+	"errors"
+
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/driver"
+)
+
+func init() {
+	driver.Register("nsq", open)
+}
+
+// nsq://host1:4150,host2:4150?channel=y&lookupd=host:4161&concurrency=4&max_in_flight=16&requeue_delay=5s&batch_size=100&marshaler=json
+//
+// 发布使用第一个 nsqd 地址，订阅连接所有 nsqd 地址以及 lookupd 发现的 nsqd，
+// marshaler 可以是 gob(默认)、json 或 proto，见 MarshalerByName
+func open(dsn *driver.DSN, opt *driver.OpenOption) (domain.PublisherMaker, domain.SubscriberMaker, error) {
+	var hosts = dsn.Hosts()
+	if len(hosts) == 0 {
+		return nil, nil, errors.New("nsq: dsn must have a nsqd address")
+	}
+
+	concurrency, err := dsn.Int("concurrency", 1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	maxInFlight, err := dsn.Int("max_in_flight", concurrency)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	requeueDelay, err := dsn.Duration("requeue_delay", 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	batchSize, err := dsn.Int("batch_size", 100)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	marshaler, err := MarshalerByName(dsn.Get("marshaler"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publisherMaker := NsqPublisherMaker(NsqPublisherConfig{
+		Addr:         hosts[0],
+		Marshaler:    marshaler,
+		MaxBatchSize: batchSize,
+		Logger:       opt.Logger,
+	})
+
+	subscriberMaker := NsqSubscriberMaker(NsqSubscribeConfig{
+		Addrs:        hosts,
+		Lookupds:     dsn.Values("lookupd"),
+		Channel:      dsn.Get("channel"),
+		Concurrency:  concurrency,
+		MaxInFlight:  maxInFlight,
+		RequeueDelay: requeueDelay,
+		Unmarshaler:  marshaler,
+		Logger:       opt.Logger,
+	})
+
+	return publisherMaker, subscriberMaker, nil
+}
@@ -3,10 +3,13 @@ package nsq
 import (
 	"bytes"
 	"encoding/gob"
+	"encoding/json"
+	"sort"
 
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/nsqio/go-nsq"
 	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
 type Marshaler interface {
@@ -53,3 +56,214 @@ func (GobMarshaler) Unmarshal(nsqMsg *nsq.Message) (*message.Message, error) {
 
 	return msg, nil
 }
+
+// MarshalerUnmarshaler 同时实现 Marshaler 和 Unmarshaler，订阅和发布使用同一种编码
+type MarshalerUnmarshaler interface {
+	Marshaler
+	Unmarshaler
+}
+
+// MarshalerByName 返回名称对应的 marshaler，支持 gob、json 和 proto，
+// 用于 DSN 的 marshaler 参数，例如 nsq://localhost:4150?channel=x&marshaler=json
+func MarshalerByName(name string) (MarshalerUnmarshaler, error) {
+	switch name {
+	case "", "gob":
+		return GobMarshaler{}, nil
+	case "json":
+		return JSONMarshaler{}, nil
+	case "proto", "protobuf":
+		return ProtobufMarshaler{}, nil
+	default:
+		return nil, errors.Errorf("nsq: unknown marshaler %q", name)
+	}
+}
+
+// jsonEnvelope 是 JSONMarshaler 的消息格式，其他语言的消费者可以直接解析:
+//
+//	{"uuid": "...", "metadata": {"k": "v"}, "payload": "<base64>"}
+//
+// RawPayload 时 payload 为原始的 JSON 值
+type jsonEnvelope struct {
+	UUID     string            `json:"uuid"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Payload  json.RawMessage   `json:"payload"`
+}
+
+// JSONMarshaler 将消息编码为 JSON 信封，UUID 和 metadata 是普通字段
+type JSONMarshaler struct {
+	// RawPayload payload 本身是 JSON 时直接内嵌，而不是 base64 编码
+	RawPayload bool
+}
+
+func (m JSONMarshaler) Marshal(topic string, msg *message.Message) ([]byte, error) {
+	var (
+		payload []byte
+		err     error
+	)
+
+	if m.RawPayload {
+		if !json.Valid(msg.Payload) {
+			return nil, errors.New("cannot encode message: payload is not valid json")
+		}
+		payload = msg.Payload
+	} else if payload, err = json.Marshal(msg.Payload); err != nil {
+		return nil, errors.Wrap(err, "cannot encode message payload")
+	}
+
+	b, err := json.Marshal(jsonEnvelope{
+		UUID:     msg.UUID,
+		Metadata: msg.Metadata,
+		Payload:  payload,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot encode message")
+	}
+
+	return b, nil
+}
+
+func (m JSONMarshaler) Unmarshal(nsqMsg *nsq.Message) (*message.Message, error) {
+	var envelope jsonEnvelope
+	if err := json.Unmarshal(nsqMsg.Body, &envelope); err != nil {
+		return nil, errors.Wrap(err, "cannot decode message")
+	}
+
+	var payload []byte
+	if m.RawPayload {
+		payload = []byte(envelope.Payload)
+	} else if len(envelope.Payload) > 0 {
+		if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+			return nil, errors.Wrap(err, "cannot decode message payload")
+		}
+	}
+
+	msg := message.NewMessage(envelope.UUID, payload)
+	if envelope.Metadata != nil {
+		msg.Metadata = envelope.Metadata
+	}
+
+	return msg, nil
+}
+
+// protobuf 信封的字段号，和 envelope.proto 保持一致
+const (
+	envelopeUUIDField     protowire.Number = 1
+	envelopeMetadataField protowire.Number = 2
+	envelopePayloadField  protowire.Number = 3
+
+	metadataKeyField   protowire.Number = 1
+	metadataValueField protowire.Number = 2
+)
+
+// ProtobufMarshaler 将消息编码为 envelope.proto 中定义的 Envelope，
+// 其他语言可以用 envelope.proto 生成代码解析
+type ProtobufMarshaler struct{}
+
+func (ProtobufMarshaler) Marshal(topic string, msg *message.Message) ([]byte, error) {
+	var b []byte
+
+	b = protowire.AppendTag(b, envelopeUUIDField, protowire.BytesType)
+	b = protowire.AppendString(b, msg.UUID)
+
+	// map 按 key 排序，保证相同的消息编码结果一致
+	var keys = make([]string, 0, len(msg.Metadata))
+	for key := range msg.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var entry []byte
+		entry = protowire.AppendTag(entry, metadataKeyField, protowire.BytesType)
+		entry = protowire.AppendString(entry, key)
+		entry = protowire.AppendTag(entry, metadataValueField, protowire.BytesType)
+		entry = protowire.AppendString(entry, msg.Metadata[key])
+
+		b = protowire.AppendTag(b, envelopeMetadataField, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+
+	b = protowire.AppendTag(b, envelopePayloadField, protowire.BytesType)
+	b = protowire.AppendBytes(b, msg.Payload)
+
+	return b, nil
+}
+
+func (ProtobufMarshaler) Unmarshal(nsqMsg *nsq.Message) (*message.Message, error) {
+	var (
+		b        = nsqMsg.Body
+		uuid     string
+		payload  []byte
+		metadata = make(message.Metadata)
+	)
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, errors.Wrap(protowire.ParseError(n), "cannot decode message")
+		}
+		b = b[n:]
+
+		if typ != protowire.BytesType {
+			// 未知字段，跳过以兼容新版本的信封
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, errors.Wrap(protowire.ParseError(n), "cannot decode message")
+			}
+			b = b[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return nil, errors.Wrap(protowire.ParseError(n), "cannot decode message")
+		}
+		b = b[n:]
+
+		switch num {
+		case envelopeUUIDField:
+			uuid = string(v)
+		case envelopePayloadField:
+			payload = append([]byte(nil), v...)
+		case envelopeMetadataField:
+			key, val, err := unmarshalMetadataEntry(v)
+			if err != nil {
+				return nil, err
+			}
+			metadata.Set(key, val)
+		}
+	}
+
+	msg := message.NewMessage(uuid, payload)
+	msg.Metadata = metadata
+
+	return msg, nil
+}
+
+func unmarshalMetadataEntry(b []byte) (key, val string, err error) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", "", errors.Wrap(protowire.ParseError(n), "cannot decode message metadata")
+		}
+		b = b[n:]
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return "", "", errors.Wrap(protowire.ParseError(n), "cannot decode message metadata")
+		}
+
+		if typ == protowire.BytesType {
+			v, _ := protowire.ConsumeBytes(b)
+			switch num {
+			case metadataKeyField:
+				key = string(v)
+			case metadataValueField:
+				val = string(v)
+			}
+		}
+		b = b[n:]
+	}
+
+	return key, val, nil
+}
@@ -0,0 +1,65 @@
+package nsq
+
+import (
+	"testing"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/nsqio/go-nsq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalers(t *testing.T) {
+	var tests = []struct {
+		name      string
+		marshaler MarshalerUnmarshaler
+		payload   []byte
+	}{
+		{"gob", GobMarshaler{}, []byte("hello")},
+		{"json", JSONMarshaler{}, []byte{0, 1, 2, 0xff}},
+		{"json raw", JSONMarshaler{RawPayload: true}, []byte(`{"name":"room"}`)},
+		{"proto", ProtobufMarshaler{}, []byte("hello")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := message.NewMessage("9f3c1f0e-uuid", tt.payload)
+			msg.Metadata.Set("name", "BookRoom")
+			msg.Metadata.Set("partition_key", "room-1")
+
+			b, err := tt.marshaler.Marshal("events", msg)
+			assert.NoError(t, err)
+
+			var id nsq.MessageID
+			decoded, err := tt.marshaler.Unmarshal(nsq.NewMessage(id, b))
+			assert.NoError(t, err)
+			assert.Equal(t, msg.UUID, decoded.UUID)
+			assert.Equal(t, msg.Payload, decoded.Payload)
+			assert.Equal(t, msg.Metadata, decoded.Metadata)
+		})
+	}
+}
+
+func TestJSONMarshalerEnvelope(t *testing.T) {
+	msg := message.NewMessage("uuid-1", []byte(`{"id":1}`))
+	msg.Metadata.Set("name", "RoomBooked")
+
+	b, err := JSONMarshaler{RawPayload: true}.Marshal("events", msg)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"uuid":"uuid-1","metadata":{"name":"RoomBooked"},"payload":{"id":1}}`, string(b))
+
+	_, err = JSONMarshaler{RawPayload: true}.Marshal("events", message.NewMessage("uuid-2", []byte("not json")))
+	assert.Error(t, err)
+}
+
+func TestMarshalerByName(t *testing.T) {
+	m, err := MarshalerByName("json")
+	assert.NoError(t, err)
+	assert.IsType(t, JSONMarshaler{}, m)
+
+	m, err = MarshalerByName("")
+	assert.NoError(t, err)
+	assert.IsType(t, GobMarshaler{}, m)
+
+	_, err = MarshalerByName("xml")
+	assert.Error(t, err)
+}
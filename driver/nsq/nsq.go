@@ -2,96 +2,264 @@ package nsq
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/creasty/defaults"
 	"github.com/hnhuaxi/domain"
 	"github.com/nsqio/go-nsq"
 	"github.com/pkg/errors"
 )
 
+// DeferMetadata 消息 metadata 中的延迟投递时间，例如 "30s"，Publish 时会使用 DeferredPublish 发送
+const DeferMetadata = "_nsq_defer"
+
+var ErrSubscriberClosed = errors.New("nsq: subscriber closed")
+
 type NsqSubscriber struct {
 	config  *NsqSubscribeConfig
 	logger  domain.LoggerAdapter
 	doneCtx context.Context
 	cancel  context.CancelFunc
+	wg      sync.WaitGroup
 }
 
 type NsqSubscribeConfig struct {
 	// Topic       string
-	Channel     string
-	Addr        string
+	Channel string
+	// Addr 直连的 nsqd 地址，设置了 Lookupds 时可以为空
+	Addr string
+	// Addrs 多个直连的 nsqd 地址
+	Addrs []string
+	// Lookupds nsqlookupd 的 http 地址，用来发现 nsqd
+	Lookupds []string
+	// Concurrency 处理消息的 goroutine 数量
+	Concurrency int `default:"1"`
+	// MaxInFlight 最多同时未确认的消息数，至少为 Concurrency
+	MaxInFlight int
+	// RequeueDelay Nack 之后重新入队的延迟，为 0 时由 nsq 按尝试次数计算
+	RequeueDelay time.Duration
+	// RequeueWithoutBackoff Nack 时不触发消费者的 backoff
+	RequeueWithoutBackoff bool
+	// StopTimeout Close 时等待处理中消息完成的最长时间
+	StopTimeout time.Duration `default:"30s"`
+	// Config 基础的 nsq 配置，MaxInFlight 会被覆盖
+	Config      *nsq.Config `default:"-"`
 	Unmarshaler Unmarshaler
+	Logger      domain.LoggerAdapter
 }
 
 type NsqEventHandler struct {
-	msg       chan *nsq.Message
+	ctx       context.Context
+	sub       *NsqSubscriber
+	topic     string
+	output    chan *message.Message
 	consumer  *nsq.Consumer
 	unmarshal Unmarshaler
+	// closing 在 stop 开始时关闭，阻止新的消息写入 output
+	closing chan struct{}
+	mu      sync.RWMutex
 }
 
 func NsqSubscriberMaker(cfg NsqSubscribeConfig) domain.SubscriberMaker {
 
 	return func() (domain.Subscriber, error) {
+		if err := defaults.Set(&cfg); err != nil {
+			return nil, err
+		}
+
+		if cfg.Logger == nil {
+			cfg.Logger = domain.Logger
+		}
+
+		if cfg.Addr == "" && len(cfg.Addrs) == 0 && len(cfg.Lookupds) == 0 {
+			return nil, errors.New("nsq: nsqd or nsqlookupd address is required")
+		}
+
+		if cfg.MaxInFlight < cfg.Concurrency {
+			cfg.MaxInFlight = cfg.Concurrency
+		}
+
 		doneCtx, cancel := context.WithCancel(context.Background())
 		sub := &NsqSubscriber{
 			config:  &cfg,
 			doneCtx: doneCtx,
 			cancel:  cancel,
-			logger:  domain.Logger,
+			logger:  cfg.Logger,
 		}
 
 		return sub, nil
 	}
 }
 
-func (sub *NsqSubscriber) newSubscribe(ctx context.Context, topic string) (*NsqEventHandler, error) {
-	config := nsq.NewConfig()
+func (sub *NsqSubscriber) nsqConfig() *nsq.Config {
+	var config *nsq.Config
+	if sub.config.Config != nil {
+		clone := *sub.config.Config
+		config = &clone
+	} else {
+		config = nsq.NewConfig()
+	}
 
-	consumer, err := nsq.NewConsumer(topic, sub.config.Channel, config)
+	config.MaxInFlight = sub.config.MaxInFlight
+	return config
+}
+
+func (sub *NsqSubscriber) newSubscribe(ctx context.Context, topic string) (*NsqEventHandler, error) {
+	consumer, err := nsq.NewConsumer(topic, sub.config.Channel, sub.nsqConfig())
 	if err != nil {
 		return nil, err
 	}
 
 	var handler = &NsqEventHandler{
-		msg:       make(chan *nsq.Message, 10),
+		ctx:       ctx,
+		sub:       sub,
+		topic:     topic,
+		output:    make(chan *message.Message),
 		unmarshal: sub.config.Unmarshaler,
 		consumer:  consumer,
+		closing:   make(chan struct{}),
 	}
 
-	consumer.AddHandler(handler)
+	consumer.AddConcurrentHandlers(handler, sub.config.Concurrency)
 
-	// Use nsqlookupd to discover nsqd instances.
-	// See also ConnectToNSQD, ConnectToNSQDs, ConnectToNSQLookupds.
-	err = consumer.ConnectToNSQD(sub.config.Addr)
-	if err != nil {
-		return nil, err
+	var addrs = sub.config.Addrs
+	if sub.config.Addr != "" {
+		addrs = append([]string{sub.config.Addr}, addrs...)
+	}
+
+	if len(addrs) > 0 {
+		if err := consumer.ConnectToNSQDs(addrs); err != nil {
+			consumer.Stop()
+			return nil, err
+		}
+	}
+
+	if len(sub.config.Lookupds) > 0 {
+		if err := consumer.ConnectToNSQLookupds(sub.config.Lookupds); err != nil {
+			consumer.Stop()
+			return nil, err
+		}
 	}
 
+	sub.wg.Add(1)
 	go func() {
-		select {
+		defer sub.wg.Done()
 
+		select {
 		case <-ctx.Done():
-			sub.logger.Trace("on nsq subscriber close", watermill.LogFields{})
-			consumer.Stop()
-			close(handler.msg)
+			sub.logger.Trace("on nsq subscriber close", watermill.LogFields{"topic": topic})
 		case <-sub.doneCtx.Done():
-			sub.logger.Trace("on nsq subscriber all close", watermill.LogFields{})
-			consumer.Stop()
-			close(handler.msg)
-			// case
+			sub.logger.Trace("on nsq subscriber all close", watermill.LogFields{"topic": topic})
+		case <-consumer.StopChan:
 		}
 
+		handler.stop()
 	}()
 
 	return handler, nil
 }
 
+// stop 停止接收新消息，等待处理中的消息被 Ack/Nack 后关闭输出 channel
+func (event *NsqEventHandler) stop() {
+	var fields = watermill.LogFields{"topic": event.topic}
+
+	close(event.closing)
+	event.consumer.Stop()
+
+	select {
+	case <-event.consumer.StopChan:
+		event.sub.logger.Trace("nsq consumer drained", fields)
+	case <-time.After(event.sub.config.StopTimeout):
+		event.sub.logger.Error("nsq consumer stop timeout", errors.New("in-flight messages not drained"), fields)
+	}
+
+	event.mu.Lock()
+	close(event.output)
+	event.mu.Unlock()
+}
+
+// deliver 将消息写入 output，subscriber 关闭中时返回 false
+func (event *NsqEventHandler) deliver(msg *message.Message) bool {
+	event.mu.RLock()
+	defer event.mu.RUnlock()
+
+	select {
+	case <-event.closing:
+		return false
+	default:
+	}
+
+	select {
+	case event.output <- msg:
+		return true
+	case <-event.closing:
+		return false
+	case <-event.ctx.Done():
+		return false
+	}
+}
+
+// HandleMessage 将 nsq 消息投递到输出 channel，Ack 对应 Finish，Nack 对应 Requeue
 func (event *NsqEventHandler) HandleMessage(m *nsq.Message) error {
-	event.msg <- m
+	m.DisableAutoResponse()
+
+	msg, err := event.unmarshal.Unmarshal(m)
+	if err != nil {
+		event.sub.logger.Error("unmarshal nsq message to message.Message error", err, watermill.LogFields{"topic": event.topic})
+		// 无法解析的消息重试也没有意义
+		m.Finish()
+		return nil
+	}
+
+	var (
+		ctx, cancel = context.WithCancel(event.ctx)
+		fields      = watermill.LogFields{
+			"message_uuid": msg.UUID,
+			"topic":        event.topic,
+			"attempts":     m.Attempts,
+		}
+	)
+	defer cancel()
+
+	msg.SetContext(ctx)
+
+	if !event.deliver(msg) {
+		m.RequeueWithoutBackoff(0)
+		return nil
+	}
+	event.sub.logger.Trace("message sent to consumer", fields)
+
+	select {
+	case <-msg.Acked():
+		m.Finish()
+		event.sub.logger.Trace("message acked", fields)
+	case <-msg.Nacked():
+		event.requeue(m)
+		event.sub.logger.Trace("message nacked", fields)
+	case <-event.ctx.Done():
+		m.RequeueWithoutBackoff(0)
+	}
+
 	return nil
 }
 
+func (event *NsqEventHandler) requeue(m *nsq.Message) {
+	var delay = event.sub.config.RequeueDelay
+	if delay <= 0 {
+		// -1 由 nsq 根据尝试次数计算延迟
+		delay = -1
+	}
+
+	if event.sub.config.RequeueWithoutBackoff {
+		m.RequeueWithoutBackoff(delay)
+	} else {
+		m.Requeue(delay)
+	}
+}
+
 // Subscribe returns output channel with messages from provided topic.
 // Channel is closed, when Close() was called on the subscriber.
 //
@@ -102,49 +270,68 @@ func (event *NsqEventHandler) HandleMessage(m *nsq.Message) error {
 // Provided ctx is set to all produced messages.
 // When Nack or Ack is called on the message, context of the message is canceled.
 func (sub *NsqSubscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
-	var msgch = make(chan *message.Message)
+	if sub.doneCtx.Err() != nil {
+		return nil, ErrSubscriberClosed
+	}
 
 	handler, err := sub.newSubscribe(ctx, topic)
 	if err != nil {
 		return nil, err
 	}
-	go func() {
-		for msg := range handler.msg {
-			mmsg, err := handler.unmarshal.Unmarshal(msg)
-			if err != nil {
-				sub.logger.Error("unmarshal nsq message to message.Message error", err, watermill.LogFields{})
-				continue
-			}
-			msgch <- mmsg
-			// msg.Payload
-		}
-	}()
-	return msgch, nil
+
+	return handler.output, nil
 }
 
-// Close closes all subscriptions with their output channels and flush offsets etc. when needed.
+// Close closes all subscriptions with their output channels,
+// it waits in-flight messages to be acked or nacked at most StopTimeout.
 func (nsq *NsqSubscriber) Close() error {
 	if nsq.cancel != nil {
 		nsq.cancel()
 	}
 
+	nsq.wg.Wait()
 	return nil
 }
 
 type NsqPublisher struct {
 	config   *NsqPublisherConfig
-	producer *nsq.Producer
+	producer producer
 	logger   domain.LoggerAdapter
 }
 
+// producer 是 NsqPublisher 使用的 *nsq.Producer 的方法
+type producer interface {
+	Publish(topic string, body []byte) error
+	MultiPublish(topic string, body [][]byte) error
+	DeferredPublish(topic string, delay time.Duration, body []byte) error
+	Stop()
+}
+
 type NsqPublisherConfig struct {
 	Addr      string
 	Marshaler Marshaler
+	// MaxBatchSize 一次 MultiPublish 最多发送的消息数
+	MaxBatchSize int `default:"100"`
+	// Config 基础的 nsq 配置
+	Config *nsq.Config `default:"-"`
+	Logger domain.LoggerAdapter
 }
 
 func NsqPublisherMaker(cfg NsqPublisherConfig) domain.PublisherMaker {
 	return func() (domain.Publisher, error) {
-		config := nsq.NewConfig()
+		if err := defaults.Set(&cfg); err != nil {
+			return nil, err
+		}
+
+		if cfg.Logger == nil {
+			cfg.Logger = domain.Logger
+		}
+
+		config := cfg.Config
+		if config == nil {
+			config = nsq.NewConfig()
+		}
+
 		producer, err := nsq.NewProducer(cfg.Addr, config)
 		if err != nil {
 			return nil, err
@@ -153,20 +340,36 @@ func NsqPublisherMaker(cfg NsqPublisherConfig) domain.PublisherMaker {
 		return &NsqPublisher{
 			config:   &cfg,
 			producer: producer,
-			logger:   domain.Logger,
+			logger:   cfg.Logger,
 		}, nil
 	}
 }
 
 // Publish publishes provided messages to given topic.
 //
-// Publish can be synchronous or asynchronous - it depends on the implementation.
+// Messages are sent with MultiPublish in batches of MaxBatchSize,
+// messages with DeferMetadata are sent one by one with DeferredPublish.
 //
 // Most publishers implementations don't support atomic publishing of messages.
 // This means that if publishing one of the messages fails, the next messages will not be published.
 //
 // Publish must be thread safe.
 func (nsq *NsqPublisher) Publish(topic string, messages ...*message.Message) error {
+	var batch [][]byte
+
+	flush := func() error {
+		defer func() { batch = batch[:0] }()
+
+		switch len(batch) {
+		case 0:
+			return nil
+		case 1:
+			return nsq.producer.Publish(topic, batch[0])
+		default:
+			return nsq.producer.MultiPublish(topic, batch)
+		}
+	}
+
 	for _, msg := range messages {
 		messageFields := watermill.LogFields{
 			"message_uuid": msg.UUID,
@@ -180,16 +383,51 @@ func (nsq *NsqPublisher) Publish(topic string, messages ...*message.Message) err
 			return err
 		}
 
-		if err := nsq.producer.Publish(topic, b); err != nil {
-			return errors.Wrap(err, "sending message failed")
+		if deferred := msg.Metadata.Get(DeferMetadata); deferred != "" {
+			delay, err := time.ParseDuration(deferred)
+			if err != nil {
+				return errors.Wrapf(err, "invalid %s metadata", DeferMetadata)
+			}
+
+			if err := nsq.producer.DeferredPublish(topic, delay, b); err != nil {
+				return errors.Wrap(err, "sending deferred message failed")
+			}
+			continue
+		}
+
+		batch = append(batch, b)
+		if len(batch) >= nsq.config.MaxBatchSize {
+			if err := flush(); err != nil {
+				return errors.Wrap(err, "sending message failed")
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return errors.Wrap(err, "sending message failed")
+	}
+
+	return nil
+}
+
+// DeferredPublish publishes messages which are delivered to consumers after delay.
+func (nsq *NsqPublisher) DeferredPublish(topic string, delay time.Duration, messages ...*message.Message) error {
+	for _, msg := range messages {
+		b, err := nsq.config.Marshaler.Marshal(topic, msg)
+		if err != nil {
+			return err
+		}
+
+		if err := nsq.producer.DeferredPublish(topic, delay, b); err != nil {
+			return errors.Wrap(err, "sending deferred message failed")
 		}
 	}
 
 	return nil
 }
 
-// Close should flush unsent messages, if publisher is async.
+// Close stops the producer, it waits in-flight publishes to finish.
 func (nsq *NsqPublisher) Close() error {
-	go nsq.producer.Stop()
+	nsq.producer.Stop()
 	return nil
 }
@@ -0,0 +1,227 @@
+package nsq
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/hnhuaxi/domain"
+	"github.com/nsqio/go-nsq"
+	"github.com/stretchr/testify/assert"
+)
+
+type response struct {
+	finished bool
+	delay    time.Duration
+	backoff  bool
+}
+
+// testDelegate 记录消息的 Finish/Requeue，代替 nsqd 连接
+type testDelegate struct {
+	mu        sync.Mutex
+	responses []response
+	done      chan struct{}
+}
+
+func newTestDelegate() *testDelegate {
+	return &testDelegate{done: make(chan struct{}, 16)}
+}
+
+func (d *testDelegate) OnFinish(*nsq.Message) {
+	d.record(response{finished: true})
+}
+
+func (d *testDelegate) OnRequeue(m *nsq.Message, delay time.Duration, backoff bool) {
+	d.record(response{delay: delay, backoff: backoff})
+}
+
+func (d *testDelegate) OnTouch(*nsq.Message) {}
+
+func (d *testDelegate) record(r response) {
+	d.mu.Lock()
+	d.responses = append(d.responses, r)
+	d.mu.Unlock()
+	d.done <- struct{}{}
+}
+
+func (d *testDelegate) wait(t *testing.T) response {
+	select {
+	case <-d.done:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting message response")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.responses[len(d.responses)-1]
+}
+
+func newTestSubscriber(cfg NsqSubscribeConfig) *NsqSubscriber {
+	cfg.Channel = "test"
+	cfg.Concurrency = 1
+	cfg.MaxInFlight = 1
+	cfg.StopTimeout = time.Second
+	cfg.Unmarshaler = GobMarshaler{}
+	cfg.Logger = domain.Logger
+
+	doneCtx, cancel := context.WithCancel(context.Background())
+	return &NsqSubscriber{config: &cfg, logger: cfg.Logger, doneCtx: doneCtx, cancel: cancel}
+}
+
+func newTestMessage(t *testing.T, delegate nsq.MessageDelegate) *nsq.Message {
+	b, err := GobMarshaler{}.Marshal("events", message.NewMessage("uuid-1", []byte("hello")))
+	assert.NoError(t, err)
+
+	var id nsq.MessageID
+	m := nsq.NewMessage(id, b)
+	m.Delegate = delegate
+	return m
+}
+
+func TestHandleMessageAckNack(t *testing.T) {
+	var tests = []struct {
+		name string
+		cfg  NsqSubscribeConfig
+		ack  bool
+		want response
+	}{
+		{"ack", NsqSubscribeConfig{}, true, response{finished: true}},
+		{"nack", NsqSubscribeConfig{}, false, response{delay: -1, backoff: true}},
+		{"nack with delay", NsqSubscribeConfig{RequeueDelay: 2 * time.Second, RequeueWithoutBackoff: true}, false, response{delay: 2 * time.Second}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := newTestSubscriber(tt.cfg)
+			defer sub.Close()
+
+			handler, err := sub.newSubscribe(context.Background(), "events")
+			assert.NoError(t, err)
+
+			delegate := newTestDelegate()
+			go handler.HandleMessage(newTestMessage(t, delegate))
+
+			msg := <-handler.output
+			assert.Equal(t, "uuid-1", msg.UUID)
+			assert.Equal(t, "hello", string(msg.Payload))
+
+			if tt.ack {
+				msg.Ack()
+			} else {
+				msg.Nack()
+			}
+
+			assert.Equal(t, tt.want, delegate.wait(t))
+		})
+	}
+}
+
+func TestHandleMessageUnmarshalError(t *testing.T) {
+	sub := newTestSubscriber(NsqSubscribeConfig{})
+	defer sub.Close()
+
+	handler, err := sub.newSubscribe(context.Background(), "events")
+	assert.NoError(t, err)
+
+	var (
+		id       nsq.MessageID
+		delegate = newTestDelegate()
+		m        = nsq.NewMessage(id, []byte("not gob"))
+	)
+	m.Delegate = delegate
+
+	// 无法解析的消息直接 Finish，不投递
+	assert.NoError(t, handler.HandleMessage(m))
+	assert.Equal(t, response{finished: true}, delegate.wait(t))
+}
+
+func TestSubscriberStop(t *testing.T) {
+	sub := newTestSubscriber(NsqSubscribeConfig{})
+
+	handler, err := sub.newSubscribe(context.Background(), "events")
+	assert.NoError(t, err)
+
+	assert.NoError(t, sub.Close())
+
+	// 关闭之后输出 channel 被关闭
+	_, ok := <-handler.output
+	assert.False(t, ok)
+
+	// 停止之后收到的消息立即重新入队
+	delegate := newTestDelegate()
+	assert.NoError(t, handler.HandleMessage(newTestMessage(t, delegate)))
+	assert.Equal(t, response{delay: 0, backoff: false}, delegate.wait(t))
+
+	_, err = sub.Subscribe(context.Background(), "events")
+	assert.ErrorIs(t, err, ErrSubscriberClosed)
+}
+
+type publishCall struct {
+	method string
+	bodies []string
+	delay  time.Duration
+}
+
+// testProducer 记录发送的批次，代替 *nsq.Producer
+type testProducer struct {
+	calls []publishCall
+}
+
+func (p *testProducer) Publish(topic string, body []byte) error {
+	p.calls = append(p.calls, publishCall{method: "Publish", bodies: []string{string(body)}})
+	return nil
+}
+
+func (p *testProducer) MultiPublish(topic string, body [][]byte) error {
+	bodies := make([]string, len(body))
+	for i, b := range body {
+		bodies[i] = string(b)
+	}
+	p.calls = append(p.calls, publishCall{method: "MultiPublish", bodies: bodies})
+	return nil
+}
+
+func (p *testProducer) DeferredPublish(topic string, delay time.Duration, body []byte) error {
+	p.calls = append(p.calls, publishCall{method: "DeferredPublish", bodies: []string{string(body)}, delay: delay})
+	return nil
+}
+
+func (p *testProducer) Stop() {}
+
+// rawMarshaler 直接发送 payload，方便检查批次
+type rawMarshaler struct{}
+
+func (rawMarshaler) Marshal(topic string, msg *message.Message) ([]byte, error) {
+	return msg.Payload, nil
+}
+
+func TestPublisherBatching(t *testing.T) {
+	var (
+		producer = &testProducer{}
+		pub      = &NsqPublisher{
+			config:   &NsqPublisherConfig{Marshaler: rawMarshaler{}, MaxBatchSize: 2},
+			producer: producer,
+			logger:   domain.Logger,
+		}
+		deferred = message.NewMessage("c", []byte("c"))
+	)
+	deferred.Metadata.Set(DeferMetadata, "30s")
+
+	err := pub.Publish("events",
+		message.NewMessage("a", []byte("a")),
+		message.NewMessage("b", []byte("b")),
+		deferred,
+		message.NewMessage("d", []byte("d")),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []publishCall{
+		{method: "MultiPublish", bodies: []string{"a", "b"}},
+		{method: "DeferredPublish", bodies: []string{"c"}, delay: 30 * time.Second},
+		{method: "Publish", bodies: []string{"d"}},
+	}, producer.calls)
+
+	deferred.Metadata.Set(DeferMetadata, "soon")
+	assert.Error(t, pub.Publish("events", deferred))
+}
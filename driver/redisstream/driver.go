@@ -0,0 +1,173 @@
+package redisstream
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/driver"
+	"go.uber.org/multierr"
+)
+
+func init() {
+	driver.Register("redis", open)
+}
+
+// redis://:password@host:6379/0?group=g&consumer=c&maxlen=10000&batch_size=10&block=1s&claim_interval=5s&min_idle=1m&start_id=0
+//
+// 发布者和订阅者共用一个 *redis.Client，最后一个发布者或订阅者 Close 时关闭
+func open(dsn *driver.DSN, opt *driver.OpenOption) (domain.PublisherMaker, domain.SubscriberMaker, error) {
+	var hosts = dsn.Hosts()
+	if len(hosts) == 0 {
+		return nil, nil, errors.New("redisstream: dsn must have a redis address")
+	}
+
+	var options = redis.Options{Addr: hosts[0]}
+	if dsn.User != nil {
+		options.Username = dsn.User.Username()
+		options.Password, _ = dsn.User.Password()
+	}
+
+	if db := strings.Trim(dsn.Path, "/"); len(db) > 0 {
+		n, err := strconv.Atoi(db)
+		if err != nil {
+			return nil, nil, errors.New("redisstream: invalid redis db " + db)
+		}
+		options.DB = n
+	}
+
+	maxLen, err := dsn.Int("maxlen", 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	batchSize, err := dsn.Int("batch_size", 10)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blockTime, err := dsn.Duration("block", time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claimInterval, err := dsn.Duration("claim_interval", 5*time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	minIdleTime, err := dsn.Duration("min_idle", time.Minute)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		client = &sharedClient{options: options}
+
+		publisherConfig = PublisherConfig{
+			MaxLen: int64(maxLen),
+			Logger: opt.Logger,
+		}
+		subscriberConfig = SubscriberConfig{
+			ConsumerGroup: dsn.Get("group", "default"),
+			Consumer:      dsn.Get("consumer"),
+			StartID:       dsn.Get("start_id", "0"),
+			BatchSize:     int64(batchSize),
+			BlockTime:     blockTime,
+			ClaimInterval: claimInterval,
+			MinIdleTime:   minIdleTime,
+			Logger:        opt.Logger,
+		}
+	)
+
+	publisherMaker := func() (domain.Publisher, error) {
+		cfg := publisherConfig
+		cfg.Client = client.acquire()
+
+		pub, err := NewPublisher(cfg)
+		if err != nil {
+			client.release()
+			return nil, err
+		}
+
+		return &ownedPublisher{Publisher: pub, client: client}, nil
+	}
+
+	subscriberMaker := func() (domain.Subscriber, error) {
+		cfg := subscriberConfig
+		cfg.Client = client.acquire()
+
+		sub, err := NewSubscriber(cfg)
+		if err != nil {
+			client.release()
+			return nil, err
+		}
+
+		return &ownedSubscriber{Subscriber: sub, client: client}, nil
+	}
+
+	return publisherMaker, subscriberMaker, nil
+}
+
+// sharedClient 按引用计数管理 DSN 创建的 *redis.Client，第一次使用时创建，引用为 0 时关闭
+type sharedClient struct {
+	options redis.Options
+	mu      sync.Mutex
+	client  *redis.Client
+	refs    int
+}
+
+func (c *sharedClient) acquire() *redis.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == nil {
+		c.client = redis.NewClient(&c.options)
+	}
+	c.refs++
+
+	return c.client
+}
+
+func (c *sharedClient) release() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.refs--; c.refs > 0 {
+		return nil
+	}
+
+	client := c.client
+	c.client = nil
+	return client.Close()
+}
+
+type ownedPublisher struct {
+	*Publisher
+	client *sharedClient
+	once   sync.Once
+}
+
+func (pub *ownedPublisher) Close() (err error) {
+	pub.once.Do(func() {
+		err = multierr.Append(pub.Publisher.Close(), pub.client.release())
+	})
+	return err
+}
+
+type ownedSubscriber struct {
+	*Subscriber
+	client *sharedClient
+	once   sync.Once
+}
+
+func (sub *ownedSubscriber) Close() (err error) {
+	sub.once.Do(func() {
+		err = multierr.Append(sub.Subscriber.Close(), sub.client.release())
+	})
+	return err
+}
@@ -0,0 +1,95 @@
+package redisstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/creasty/defaults"
+	"github.com/go-redis/redis/v8"
+	"github.com/hnhuaxi/domain"
+)
+
+type PublisherConfig struct {
+	Client *redis.Client `default:"-"`
+	// MaxLen 大于 0 时 XADD 带上 MAXLEN 裁剪 stream，还没被消费的消息也会被裁掉
+	MaxLen int64
+	// ExactMaxLen 使用精确裁剪，默认使用 MAXLEN ~ 近似裁剪，性能更好
+	ExactMaxLen bool
+	Marshaler   Marshaler `default:"-"`
+	Logger      domain.LoggerAdapter
+}
+
+type Publisher struct {
+	config PublisherConfig
+}
+
+func PublisherMaker(cfg PublisherConfig) domain.PublisherMaker {
+	return func() (domain.Publisher, error) {
+		return NewPublisher(cfg)
+	}
+}
+
+func NewPublisher(cfg PublisherConfig) (*Publisher, error) {
+	if err := defaults.Set(&cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.Client == nil {
+		return nil, errors.New("redisstream: missing redis client")
+	}
+
+	if cfg.Marshaler == nil {
+		cfg.Marshaler = DefaultMarshaler{}
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = domain.Logger
+	}
+
+	return &Publisher{config: cfg}, nil
+}
+
+// Publish 使用 pipeline 在一次往返中 XADD 所有消息
+func (pub *Publisher) Publish(topic string, messages ...*message.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	var (
+		ctx  = context.Background()
+		pipe = pub.config.Client.Pipeline()
+	)
+
+	for _, msg := range messages {
+		values, err := pub.config.Marshaler.Marshal(topic, msg)
+		if err != nil {
+			return fmt.Errorf("redisstream: marshal message %s failed: %w", msg.UUID, err)
+		}
+
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: topic,
+			MaxLen: pub.config.MaxLen,
+			Approx: !pub.config.ExactMaxLen,
+			Values: values,
+		})
+
+		pub.config.Logger.Trace("Publishing message", watermill.LogFields{
+			"message_uuid": msg.UUID,
+			"topic_name":   topic,
+		})
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redisstream: xadd failed: %w", err)
+	}
+
+	return nil
+}
+
+// Close 不关闭 Client，Client 由调用者管理
+func (pub *Publisher) Close() error {
+	return nil
+}
@@ -0,0 +1,66 @@
+// Package redisstream 提供基于 Redis Streams 的 pub/sub，每个 topic 是一个 stream，
+// 发布使用 XADD，订阅使用消费组 XREADGROUP，确认后 XACK，
+// 长时间没有确认的 pending 消息由同组的其他订阅者通过 XAUTOCLAIM 接管
+package redisstream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+const (
+	UUIDField     = "_watermill_message_uuid"
+	PayloadField  = "payload"
+	MetadataField = "metadata"
+)
+
+type Marshaler interface {
+	Marshal(topic string, msg *message.Message) (map[string]interface{}, error)
+}
+
+type Unmarshaler interface {
+	Unmarshal(values map[string]interface{}) (*message.Message, error)
+}
+
+type MarshalerUnmarshaler interface {
+	Marshaler
+	Unmarshaler
+}
+
+// DefaultMarshaler 把 UUID、payload 和 JSON 编码的 metadata 保存为 stream entry 的三个字段
+type DefaultMarshaler struct{}
+
+func (DefaultMarshaler) Marshal(topic string, msg *message.Message) (map[string]interface{}, error) {
+	metadata, err := json.Marshal(msg.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("redisstream: marshal metadata failed: %w", err)
+	}
+
+	// go-redis 只接受 []byte，不接受 message.Payload 这样的命名类型
+	return map[string]interface{}{
+		UUIDField:     msg.UUID,
+		PayloadField:  []byte(msg.Payload),
+		MetadataField: metadata,
+	}, nil
+}
+
+func (DefaultMarshaler) Unmarshal(values map[string]interface{}) (*message.Message, error) {
+	uuid, ok := values[UUIDField].(string)
+	if !ok {
+		return nil, errors.New("redisstream: missing message uuid")
+	}
+
+	payload, _ := values[PayloadField].(string)
+	msg := message.NewMessage(uuid, []byte(payload))
+
+	if metadata, _ := values[MetadataField].(string); len(metadata) > 0 {
+		if err := json.Unmarshal([]byte(metadata), &msg.Metadata); err != nil {
+			return nil, fmt.Errorf("redisstream: unmarshal metadata failed: %w", err)
+		}
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,193 @@
+package redisstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/hnhuaxi/domain/driver"
+	"github.com/stretchr/testify/assert"
+)
+
+func testClient(t *testing.T) *redis.Client {
+	s := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func receive(t *testing.T, messages <-chan *message.Message) *message.Message {
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting message")
+		return nil
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	var client = testClient(t)
+
+	pub, err := NewPublisher(PublisherConfig{Client: client})
+	assert.NoError(t, err)
+
+	sub, err := NewSubscriber(SubscriberConfig{
+		Client:          client,
+		ConsumerGroup:   "booking",
+		BlockTime:       10 * time.Millisecond,
+		NackResendSleep: 10 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	messages, err := sub.Subscribe(context.Background(), "commands")
+	assert.NoError(t, err)
+
+	msg1 := message.NewMessage("uuid-1", []byte("room 1"))
+	msg1.Metadata.Set("name", "BookRoom")
+	assert.NoError(t, pub.Publish("commands", msg1, message.NewMessage("uuid-2", []byte("room 2"))))
+
+	received := receive(t, messages)
+	assert.Equal(t, "uuid-1", received.UUID)
+	assert.Equal(t, "room 1", string(received.Payload))
+	assert.Equal(t, "BookRoom", received.Metadata.Get("name"))
+	received.Ack()
+
+	// Nack 的消息重新投递
+	received = receive(t, messages)
+	assert.Equal(t, "uuid-2", received.UUID)
+	received.Nack()
+
+	received = receive(t, messages)
+	assert.Equal(t, "uuid-2", received.UUID)
+	received.Ack()
+
+	assert.NoError(t, sub.Close())
+
+	pending, err := client.XPending(context.Background(), "commands", "booking").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), pending.Count)
+
+	// 另一个消费组从头开始消费
+	other, err := NewSubscriber(SubscriberConfig{Client: client, ConsumerGroup: "billing", BlockTime: 10 * time.Millisecond})
+	assert.NoError(t, err)
+	defer other.Close()
+
+	messages, err = other.Subscribe(context.Background(), "commands")
+	assert.NoError(t, err)
+
+	received = receive(t, messages)
+	assert.Equal(t, "uuid-1", received.UUID)
+	received.Ack()
+}
+
+func TestClaimPending(t *testing.T) {
+	var client = testClient(t)
+
+	pub, err := NewPublisher(PublisherConfig{Client: client})
+	assert.NoError(t, err)
+	assert.NoError(t, pub.Publish("events", message.NewMessage("uuid-1", nil)))
+
+	crashed, err := NewSubscriber(SubscriberConfig{Client: client, Consumer: "crashed", BlockTime: 10 * time.Millisecond})
+	assert.NoError(t, err)
+
+	messages, err := crashed.Subscribe(context.Background(), "events")
+	assert.NoError(t, err)
+
+	// 收到消息但没有确认就退出，消息留在 crashed 的 pending 列表中
+	assert.Equal(t, "uuid-1", receive(t, messages).UUID)
+	assert.NoError(t, crashed.Close())
+
+	sub, err := NewSubscriber(SubscriberConfig{
+		Client:        client,
+		Consumer:      "alive",
+		BlockTime:     10 * time.Millisecond,
+		ClaimInterval: 10 * time.Millisecond,
+		MinIdleTime:   50 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	defer sub.Close()
+
+	messages, err = sub.Subscribe(context.Background(), "events")
+	assert.NoError(t, err)
+
+	received := receive(t, messages)
+	assert.Equal(t, "uuid-1", received.UUID)
+	received.Ack()
+
+	assert.Eventually(t, func() bool {
+		pending, err := client.XPending(context.Background(), "events", "default").Result()
+		return err == nil && pending.Count == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestPublishMaxLen(t *testing.T) {
+	var client = testClient(t)
+
+	pub, err := NewPublisher(PublisherConfig{Client: client, MaxLen: 2, ExactMaxLen: true})
+	assert.NoError(t, err)
+
+	for _, uuid := range []string{"uuid-1", "uuid-2", "uuid-3"} {
+		assert.NoError(t, pub.Publish("events", message.NewMessage(uuid, nil)))
+	}
+
+	length, err := client.XLen(context.Background(), "events").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), length)
+}
+
+func TestParseAutoClaim(t *testing.T) {
+	// Redis 7 返回第三个元素为已删除的 ID，Redis 6.2 对已删除的 entry 返回 nil 字段
+	next, entries, err := parseAutoClaim([]interface{}{
+		"0-0",
+		[]interface{}{
+			[]interface{}{"1-0", []interface{}{UUIDField, "uuid-1", PayloadField, "hello"}},
+			[]interface{}{"2-0", nil},
+		},
+		[]interface{}{"3-0"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "0-0", next)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "1-0", entries[0].ID)
+
+	msg, err := DefaultMarshaler{}.Unmarshal(entries[0].Values)
+	assert.NoError(t, err)
+	assert.Equal(t, "uuid-1", msg.UUID)
+	assert.Equal(t, "hello", string(msg.Payload))
+}
+
+func TestOpenClosesClient(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	pm, sm, err := driver.Open("redis://" + s.Addr() + "?group=booking&block=10ms")
+	assert.NoError(t, err)
+
+	pub, err := pm()
+	assert.NoError(t, err)
+
+	sub, err := sm()
+	assert.NoError(t, err)
+
+	client := sub.(*ownedSubscriber).config.Client
+	assert.Same(t, pub.(*ownedPublisher).config.Client, client)
+
+	// 还有订阅者在使用时不关闭 client
+	assert.NoError(t, pub.Close())
+	assert.NoError(t, pub.Close())
+	assert.NoError(t, client.Ping(context.Background()).Err())
+
+	assert.NoError(t, sub.Close())
+	assert.ErrorIs(t, client.Ping(context.Background()).Err(), redis.ErrClosed)
+
+	// 之后创建的发布者使用新的 client
+	pub, err = pm()
+	assert.NoError(t, err)
+	defer pub.Close()
+	assert.NoError(t, pub.Publish("commands", message.NewMessage("uuid-1", nil)))
+}
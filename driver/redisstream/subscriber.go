@@ -0,0 +1,337 @@
+package redisstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/creasty/defaults"
+	"github.com/go-redis/redis/v8"
+	"github.com/hnhuaxi/domain"
+	"go.uber.org/atomic"
+)
+
+var ErrSubscriberClosed = errors.New("redisstream: subscriber closed")
+
+type SubscriberConfig struct {
+	Client *redis.Client `default:"-"`
+	// ConsumerGroup 同一个消费组的订阅者竞争消费，不同消费组各自收到全部消息
+	ConsumerGroup string `default:"default"`
+	// Consumer 消费者名称，默认随机生成，pending 消息记在这个名称下
+	Consumer string
+	// StartID 消费组不存在时创建消费组的起始位置，0 从头消费，$ 只消费新消息
+	StartID string `default:"0"`
+	// BatchSize 每次 XREADGROUP 读取的消息数
+	BatchSize int64 `default:"10"`
+	// BlockTime XREADGROUP 阻塞等待新消息的时间，也决定了 Close 的响应时间
+	BlockTime time.Duration `default:"1s"`
+	// ClaimInterval 检查其他消费者 pending 消息的间隔，小于 0 关闭接管
+	ClaimInterval time.Duration `default:"5s"`
+	// MinIdleTime pending 消息超过这个时间没有确认才会被 XAUTOCLAIM 接管
+	MinIdleTime time.Duration `default:"1m"`
+	// NackResendSleep Nack 之后重新投递前等待的时间
+	NackResendSleep time.Duration `default:"1s"`
+	Unmarshaler     Unmarshaler   `default:"-"`
+	Logger          domain.LoggerAdapter
+}
+
+// Subscriber 每个 topic 一个 goroutine，消息按顺序投递，确认之后才投递下一条
+type Subscriber struct {
+	config  SubscriberConfig
+	closing chan struct{}
+	closed  atomic.Bool
+	wg      sync.WaitGroup
+}
+
+type deliverResult int
+
+const (
+	deliverAcked deliverResult = iota
+	deliverClosed
+)
+
+func SubscriberMaker(cfg SubscriberConfig) domain.SubscriberMaker {
+	return func() (domain.Subscriber, error) {
+		return NewSubscriber(cfg)
+	}
+}
+
+func NewSubscriber(cfg SubscriberConfig) (*Subscriber, error) {
+	if err := defaults.Set(&cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.Client == nil {
+		return nil, errors.New("redisstream: missing redis client")
+	}
+
+	if cfg.Consumer == "" {
+		cfg.Consumer = watermill.NewShortUUID()
+	}
+
+	if cfg.Unmarshaler == nil {
+		cfg.Unmarshaler = DefaultMarshaler{}
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = domain.Logger
+	}
+
+	return &Subscriber{
+		config:  cfg,
+		closing: make(chan struct{}),
+	}, nil
+}
+
+// Subscribe returns output channel with messages from provided topic.
+//
+// To receive the next message, `Ack()` must be called on the received message.
+// Nacked message is redelivered after NackResendSleep.
+func (sub *Subscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	if sub.closed.Load() {
+		return nil, ErrSubscriberClosed
+	}
+
+	if err := sub.createGroup(ctx, topic); err != nil {
+		return nil, err
+	}
+
+	var output = make(chan *message.Message)
+
+	sub.wg.Add(1)
+	go func() {
+		defer sub.wg.Done()
+		defer close(output)
+
+		// 正在阻塞的 XREADGROUP 在 Close 时被取消
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		go func() {
+			select {
+			case <-sub.closing:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		sub.consume(ctx, topic, output)
+	}()
+
+	return output, nil
+}
+
+func (sub *Subscriber) createGroup(ctx context.Context, topic string) error {
+	err := sub.config.Client.XGroupCreateMkStream(ctx, topic, sub.config.ConsumerGroup, sub.config.StartID).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("redisstream: create consumer group %s failed: %w", sub.config.ConsumerGroup, err)
+	}
+
+	return nil
+}
+
+func (sub *Subscriber) consume(ctx context.Context, topic string, output chan *message.Message) {
+	var (
+		fields    = watermill.LogFields{"topic": topic, "consumer_group": sub.config.ConsumerGroup, "consumer": sub.config.Consumer}
+		lastClaim time.Time
+	)
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if sub.config.ClaimInterval > 0 && time.Since(lastClaim) >= sub.config.ClaimInterval {
+			lastClaim = time.Now()
+			if err := sub.claim(ctx, topic, output); err != nil && ctx.Err() == nil {
+				sub.config.Logger.Error("Claim pending messages failed", err, fields)
+			}
+		}
+
+		streams, err := sub.config.Client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    sub.config.ConsumerGroup,
+			Consumer: sub.config.Consumer,
+			Streams:  []string{topic, ">"},
+			Count:    sub.config.BatchSize,
+			Block:    sub.config.BlockTime,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		} else if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			sub.config.Logger.Error("Read messages failed", err, fields)
+			if !sub.sleep(ctx, sub.config.NackResendSleep) {
+				return
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, entry := range stream.Messages {
+				if sub.process(ctx, topic, entry, output) == deliverClosed {
+					return
+				}
+			}
+		}
+	}
+}
+
+// claim 使用 XAUTOCLAIM 接管其他消费者超过 MinIdleTime 没有确认的消息，
+// go-redis v8 的 XAutoClaim 不能解析 Redis 7 返回的三元素结果，这里直接解析原始回复
+func (sub *Subscriber) claim(ctx context.Context, topic string, output chan *message.Message) error {
+	var start = "0-0"
+
+	for {
+		reply, err := sub.config.Client.Do(ctx, "XAUTOCLAIM", topic, sub.config.ConsumerGroup, sub.config.Consumer,
+			sub.config.MinIdleTime.Milliseconds(), start, "COUNT", sub.config.BatchSize).Slice()
+		if err != nil {
+			return err
+		}
+
+		next, entries, err := parseAutoClaim(reply)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if sub.process(ctx, topic, entry, output) == deliverClosed {
+				return nil
+			}
+		}
+
+		if next == "0-0" {
+			return nil
+		}
+		start = next
+	}
+}
+
+func parseAutoClaim(reply []interface{}) (string, []redis.XMessage, error) {
+	if len(reply) < 2 {
+		return "", nil, fmt.Errorf("redisstream: unexpected XAUTOCLAIM reply %v", reply)
+	}
+
+	next, ok := reply[0].(string)
+	if !ok {
+		return "", nil, fmt.Errorf("redisstream: unexpected XAUTOCLAIM cursor %v", reply[0])
+	}
+
+	items, ok := reply[1].([]interface{})
+	if !ok {
+		return "", nil, fmt.Errorf("redisstream: unexpected XAUTOCLAIM entries %v", reply[1])
+	}
+
+	var entries = make([]redis.XMessage, 0, len(items))
+	for _, item := range items {
+		pair, ok := item.([]interface{})
+		if !ok || len(pair) != 2 {
+			continue
+		}
+
+		id, _ := pair[0].(string)
+		// Redis 6.2 对已经被裁剪掉的 entry 返回 nil 字段
+		kvs, ok := pair[1].([]interface{})
+		if !ok {
+			continue
+		}
+
+		var values = make(map[string]interface{}, len(kvs)/2)
+		for i := 0; i+1 < len(kvs); i += 2 {
+			if key, ok := kvs[i].(string); ok {
+				values[key] = kvs[i+1]
+			}
+		}
+
+		entries = append(entries, redis.XMessage{ID: id, Values: values})
+	}
+
+	return next, entries, nil
+}
+
+// process 投递一条 entry 直到被确认，Nack 的消息在 NackResendSleep 之后重新投递
+func (sub *Subscriber) process(ctx context.Context, topic string, entry redis.XMessage, output chan *message.Message) deliverResult {
+	var fields = watermill.LogFields{"topic": topic, "consumer_group": sub.config.ConsumerGroup, "id": entry.ID}
+
+	for {
+		msg, err := sub.config.Unmarshaler.Unmarshal(entry.Values)
+		if err != nil {
+			// 无法解析的消息重试也没有意义，确认后跳过
+			sub.config.Logger.Error("Cannot unmarshal message", err, fields)
+			sub.ack(topic, entry.ID, fields)
+			return deliverAcked
+		}
+
+		acked, ok := sub.deliver(ctx, msg, output)
+		if !ok {
+			return deliverClosed
+		}
+
+		if acked {
+			sub.ack(topic, entry.ID, fields)
+			return deliverAcked
+		}
+
+		if !sub.sleep(ctx, sub.config.NackResendSleep) {
+			return deliverClosed
+		}
+	}
+}
+
+func (sub *Subscriber) ack(topic, id string, fields watermill.LogFields) {
+	// 订阅被取消时已确认的消息仍然要 XACK
+	if err := sub.config.Client.XAck(context.Background(), topic, sub.config.ConsumerGroup, id).Err(); err != nil {
+		sub.config.Logger.Error("Ack message failed", err, fields)
+	}
+}
+
+// deliver 返回消息是否被确认，以及订阅是否仍然有效
+func (sub *Subscriber) deliver(ctx context.Context, msg *message.Message, output chan *message.Message) (acked bool, ok bool) {
+	msgCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	msg.SetContext(msgCtx)
+
+	select {
+	case output <- msg:
+	case <-ctx.Done():
+		return false, false
+	}
+
+	select {
+	case <-msg.Acked():
+		return true, true
+	case <-msg.Nacked():
+		return false, true
+	case <-ctx.Done():
+		return false, false
+	}
+}
+
+func (sub *Subscriber) sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// Close closes all subscriptions, unacked messages stay pending and are claimed by other consumers.
+func (sub *Subscriber) Close() error {
+	if !sub.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	close(sub.closing)
+	sub.wg.Wait()
+
+	return nil
+}
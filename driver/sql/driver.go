@@ -0,0 +1,112 @@
+package sql
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/driver"
+	"gorm.io/gorm"
+)
+
+var (
+	dbsMu sync.RWMutex
+	dbs   = make(map[string]*gorm.DB)
+)
+
+func init() {
+	driver.Register("sql", open)
+}
+
+// RegisterDB 注册 sql:// DSN 使用的数据库连接，DSN 的 host 部分是 name，
+// 通常是传给 repository/db 的同一个 *gorm.DB
+func RegisterDB(name string, db *gorm.DB) {
+	dbsMu.Lock()
+	defer dbsMu.Unlock()
+
+	dbs[name] = db
+}
+
+func lookupDB(name string) (*gorm.DB, bool) {
+	dbsMu.RLock()
+	defer dbsMu.RUnlock()
+
+	db, ok := dbs[name]
+	return db, ok
+}
+
+// sql://main?group=g&batch_size=100&poll_interval=100ms&max_poll_interval=5s&nack_resend_sleep=1s&lease_timeout=30s&skip_locked=true&auto_migrate=true
+//
+// main 是 RegisterDB 注册的名称，messages_table 和 offsets_table 可以修改表名
+func open(dsn *driver.DSN, opt *driver.OpenOption) (domain.PublisherMaker, domain.SubscriberMaker, error) {
+	db, ok := lookupDB(dsn.Host)
+	if !ok {
+		return nil, nil, fmt.Errorf("sql: db %q is not registered, see RegisterDB", dsn.Host)
+	}
+
+	batchSize, err := dsn.Int("batch_size", 100)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pollInterval, err := dsn.Duration("poll_interval", 100*time.Millisecond)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	maxPollInterval, err := dsn.Duration("max_poll_interval", 5*time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nackResendSleep, err := dsn.Duration("nack_resend_sleep", time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	leaseTimeout, err := dsn.Duration("lease_timeout", 30*time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	skipLocked, err := dsn.Bool("skip_locked", false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	autoMigrate, err := dsn.Bool("auto_migrate", false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		messagesTable = dsn.Get("messages_table", DefaultMessagesTable)
+		offsetsTable  = dsn.Get("offsets_table", DefaultOffsetsTable)
+	)
+
+	publisherMaker := PublisherMaker(PublisherConfig{
+		DB:            db,
+		MessagesTable: messagesTable,
+		OffsetsTable:  offsetsTable,
+		AutoMigrate:   autoMigrate,
+		Logger:        opt.Logger,
+	})
+
+	subscriberMaker := SubscriberMaker(SubscriberConfig{
+		DB:              db,
+		ConsumerGroup:   dsn.Get("group", "default"),
+		MessagesTable:   messagesTable,
+		OffsetsTable:    offsetsTable,
+		BatchSize:       batchSize,
+		PollInterval:    pollInterval,
+		MaxPollInterval: maxPollInterval,
+		NackResendSleep: nackResendSleep,
+		LeaseTimeout:    leaseTimeout,
+		SkipLocked:      skipLocked,
+		AutoMigrate:     autoMigrate,
+		Logger:          opt.Logger,
+	})
+
+	return publisherMaker, subscriberMaker, nil
+}
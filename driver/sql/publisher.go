@@ -0,0 +1,97 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/creasty/defaults"
+	"github.com/hnhuaxi/domain"
+	"gorm.io/gorm"
+)
+
+type PublisherConfig struct {
+	DB            *gorm.DB `default:"-"`
+	MessagesTable string   `default:"watermill_messages"`
+	OffsetsTable  string   `default:"watermill_offsets"`
+	// AutoMigrate 创建 Publisher 时创建消息表和 offset 表
+	AutoMigrate bool
+	Logger      domain.LoggerAdapter
+}
+
+type Publisher struct {
+	db     *gorm.DB
+	config PublisherConfig
+}
+
+func PublisherMaker(cfg PublisherConfig) domain.PublisherMaker {
+	return func() (domain.Publisher, error) {
+		return NewPublisher(cfg)
+	}
+}
+
+func NewPublisher(cfg PublisherConfig) (*Publisher, error) {
+	if err := defaults.Set(&cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.DB == nil {
+		return nil, errors.New("sql: missing DB")
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = domain.Logger
+	}
+
+	if cfg.AutoMigrate {
+		if err := Migrate(cfg.DB, cfg.MessagesTable, cfg.OffsetsTable); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Publisher{
+		db:     cfg.DB,
+		config: cfg,
+	}, nil
+}
+
+// WithTx 返回在 tx 中发布消息的 Publisher，例如 DBRepository.Begin 之后的 DB()，
+// 事务提交后消息才对订阅者可见，回滚时消息一起丢弃
+func (pub *Publisher) WithTx(tx *gorm.DB) *Publisher {
+	return &Publisher{
+		db:     tx,
+		config: pub.config,
+	}
+}
+
+// Publish 在一条语句中写入所有消息
+func (pub *Publisher) Publish(topic string, messages ...*message.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	var records = make([]*MessageRecord, 0, len(messages))
+	for _, msg := range messages {
+		record, err := marshalMessage(topic, msg)
+		if err != nil {
+			return fmt.Errorf("sql: marshal message %s failed: %w", msg.UUID, err)
+		}
+		records = append(records, record)
+
+		pub.config.Logger.Trace("Publishing message", watermill.LogFields{
+			"message_uuid": msg.UUID,
+			"topic_name":   topic,
+		})
+	}
+
+	if err := pub.db.Table(pub.config.MessagesTable).Create(&records).Error; err != nil {
+		return fmt.Errorf("sql: insert messages failed: %w", err)
+	}
+
+	return nil
+}
+
+func (pub *Publisher) Close() error {
+	return nil
+}
@@ -0,0 +1,71 @@
+// Package sql 提供基于数据库表的 pub/sub，适合没有消息队列的小服务，
+// 使用 repository/db 相同的 *gorm.DB，发布可以和 DBRepository 的写入在同一个事务中
+package sql
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultMessagesTable = "watermill_messages"
+	DefaultOffsetsTable  = "watermill_offsets"
+)
+
+// MessageRecord 消息表，所有 topic 共用一张表，ID 即消息的 offset
+type MessageRecord struct {
+	ID        uint64 `gorm:"primaryKey;autoIncrement"`
+	Topic     string `gorm:"size:255;not null;index:idx_topic_id,priority:1"`
+	UUID      string `gorm:"size:64;not null"`
+	Payload   []byte
+	Metadata  []byte
+	CreatedAt time.Time
+}
+
+// OffsetRecord 消费组在 topic 上最后确认的消息 ID，以及正在处理的订阅者的租约
+type OffsetRecord struct {
+	ConsumerGroup string `gorm:"primaryKey;size:255"`
+	Topic         string `gorm:"primaryKey;size:255"`
+	AckedID       uint64 `gorm:"not null;default:0"`
+	LeaseOwner    string `gorm:"size:64;not null;default:''"`
+	LeasedUntil   *time.Time
+	UpdatedAt     time.Time
+}
+
+// Migrate 创建消息表和 offset 表
+func Migrate(db *gorm.DB, messagesTable, offsetsTable string) error {
+	if err := db.Table(messagesTable).AutoMigrate(&MessageRecord{}); err != nil {
+		return err
+	}
+
+	return db.Table(offsetsTable).AutoMigrate(&OffsetRecord{})
+}
+
+func marshalMessage(topic string, msg *message.Message) (*MessageRecord, error) {
+	metadata, err := json.Marshal(msg.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MessageRecord{
+		Topic:    topic,
+		UUID:     msg.UUID,
+		Payload:  msg.Payload,
+		Metadata: metadata,
+	}, nil
+}
+
+func unmarshalMessage(record *MessageRecord) (*message.Message, error) {
+	msg := message.NewMessage(record.UUID, record.Payload)
+
+	if len(record.Metadata) > 0 {
+		if err := json.Unmarshal(record.Metadata, &msg.Metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	return msg, nil
+}
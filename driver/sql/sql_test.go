@@ -0,0 +1,198 @@
+package sql
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/hnhuaxi/domain/driver"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func testDB(t *testing.T) *gorm.DB {
+	dsn := "file:" + filepath.Join(t.TempDir(), "messages.db") + "?_busy_timeout=5000"
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, Migrate(db, DefaultMessagesTable, DefaultOffsetsTable))
+	return db
+}
+
+func receive(t *testing.T, messages <-chan *message.Message) *message.Message {
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting message")
+		return nil
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	var db = testDB(t)
+
+	pub, err := NewPublisher(PublisherConfig{DB: db})
+	assert.NoError(t, err)
+
+	msg1 := message.NewMessage("uuid-1", []byte("room 1"))
+	msg1.Metadata.Set("name", "BookRoom")
+	assert.NoError(t, pub.Publish("commands", msg1, message.NewMessage("uuid-2", []byte("room 2"))))
+
+	sub, err := NewSubscriber(SubscriberConfig{
+		DB:              db,
+		ConsumerGroup:   "booking",
+		PollInterval:    10 * time.Millisecond,
+		NackResendSleep: 10 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	messages, err := sub.Subscribe(context.Background(), "commands")
+	assert.NoError(t, err)
+
+	received := receive(t, messages)
+	assert.Equal(t, "uuid-1", received.UUID)
+	assert.Equal(t, "BookRoom", received.Metadata.Get("name"))
+	received.Ack()
+
+	// Nack 的消息重新投递
+	received = receive(t, messages)
+	assert.Equal(t, "uuid-2", received.UUID)
+	received.Nack()
+
+	received = receive(t, messages)
+	assert.Equal(t, "uuid-2", received.UUID)
+	received.Ack()
+
+	assert.NoError(t, sub.Close())
+
+	var offset OffsetRecord
+	assert.NoError(t, db.Table(DefaultOffsetsTable).Where("consumer_group = ?", "booking").Take(&offset).Error)
+	assert.Equal(t, uint64(2), offset.AckedID)
+
+	// 另一个消费组从头开始消费
+	other, err := NewSubscriber(SubscriberConfig{DB: db, ConsumerGroup: "billing", PollInterval: 10 * time.Millisecond})
+	assert.NoError(t, err)
+	defer other.Close()
+
+	messages, err = other.Subscribe(context.Background(), "commands")
+	assert.NoError(t, err)
+
+	received = receive(t, messages)
+	assert.Equal(t, "uuid-1", received.UUID)
+	received.Ack()
+}
+
+func TestPublishWithTx(t *testing.T) {
+	var db = testDB(t)
+
+	pub, err := NewPublisher(PublisherConfig{DB: db})
+	assert.NoError(t, err)
+
+	tx := db.Begin()
+	assert.NoError(t, pub.WithTx(tx).Publish("events", message.NewMessage("uuid-1", nil)))
+	tx.Rollback()
+
+	var count int64
+	assert.NoError(t, db.Table(DefaultMessagesTable).Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+
+	tx = db.Begin()
+	assert.NoError(t, pub.WithTx(tx).Publish("events", message.NewMessage("uuid-2", nil)))
+	tx.Commit()
+
+	assert.NoError(t, db.Table(DefaultMessagesTable).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestPublishWhileHandling(t *testing.T) {
+	var db = testDB(t)
+
+	pub, err := NewPublisher(PublisherConfig{DB: db})
+	assert.NoError(t, err)
+	assert.NoError(t, pub.Publish("commands", message.NewMessage("uuid-1", nil)))
+
+	sub, err := NewSubscriber(SubscriberConfig{DB: db, PollInterval: 10 * time.Millisecond})
+	assert.NoError(t, err)
+	defer sub.Close()
+
+	commands, err := sub.Subscribe(context.Background(), "commands")
+	assert.NoError(t, err)
+
+	events, err := sub.Subscribe(context.Background(), "events")
+	assert.NoError(t, err)
+
+	// 处理消息时不持有事务，可以在同一个数据库中发布消息
+	received := receive(t, commands)
+	assert.NoError(t, pub.Publish("events", message.NewMessage("uuid-2", nil)))
+	received.Ack()
+
+	received = receive(t, events)
+	assert.Equal(t, "uuid-2", received.UUID)
+	received.Ack()
+}
+
+func TestOffsetLease(t *testing.T) {
+	var db = testDB(t)
+
+	pub, err := NewPublisher(PublisherConfig{DB: db})
+	assert.NoError(t, err)
+	assert.NoError(t, pub.Publish("commands", message.NewMessage("uuid-1", nil), message.NewMessage("uuid-2", nil)))
+
+	sub, err := NewSubscriber(SubscriberConfig{DB: db, LeaseTimeout: time.Minute})
+	assert.NoError(t, err)
+
+	records, err := sub.lease("commands", "a")
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	// 租约有效期间其他订阅者读不到消息
+	records, err = sub.lease("commands", "b")
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+	assert.ErrorIs(t, sub.commit("commands", "b", 1), errLeaseLost)
+
+	// 确认之后提交 offset，释放之后其他订阅者从 offset 之后继续
+	assert.NoError(t, sub.commit("commands", "a", 1))
+	assert.NoError(t, sub.release("commands", "a"))
+
+	records, err = sub.lease("commands", "b")
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "uuid-2", records[0].UUID)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	var db = testDB(t)
+	RegisterDB("test", db)
+
+	pm, sm, err := driver.Open("sql://test?group=booking&poll_interval=10ms&lease_timeout=1m")
+	assert.NoError(t, err)
+
+	pub, err := pm()
+	assert.NoError(t, err)
+	defer pub.Close()
+
+	sub, err := sm()
+	assert.NoError(t, err)
+	defer sub.Close()
+
+	messages, err := sub.Subscribe(context.Background(), "commands")
+	assert.NoError(t, err)
+
+	assert.NoError(t, pub.Publish("commands", message.NewMessage("uuid-1", nil)))
+	received := receive(t, messages)
+	assert.Equal(t, "uuid-1", received.UUID)
+	received.Ack()
+
+	_, _, err = driver.Open("sql://missing")
+	assert.Error(t, err)
+}
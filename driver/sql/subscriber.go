@@ -0,0 +1,341 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/creasty/defaults"
+	"github.com/hnhuaxi/domain"
+	"go.uber.org/atomic"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSubscriberClosed = errors.New("sql: subscriber closed")
+
+	errLeaseLost = errors.New("sql: offset lease expired and taken over by another subscriber")
+)
+
+type SubscriberConfig struct {
+	DB *gorm.DB `default:"-"`
+	// ConsumerGroup 同一个消费组的订阅者竞争消费，每个消费组在每个 topic 上有自己的 offset
+	ConsumerGroup string `default:"default"`
+	MessagesTable string `default:"watermill_messages"`
+	OffsetsTable  string `default:"watermill_offsets"`
+	// BatchSize 一次租用最多读取的消息数
+	BatchSize int `default:"100"`
+	// LeaseTimeout 租用 offset 的时长，每次确认消息时续租，
+	// 超过这个时间没有确认消息时其他订阅者可以接管，消息可能被重复处理
+	LeaseTimeout time.Duration `default:"30s"`
+	// PollInterval 没有新消息时的轮询间隔，连续没有消息时加倍，直到 MaxPollInterval
+	PollInterval    time.Duration `default:"100ms"`
+	MaxPollInterval time.Duration `default:"5s"`
+	// NackResendSleep Nack 之后重新投递前等待的时间
+	NackResendSleep time.Duration `default:"1s"`
+	// SkipLocked 使用 FOR UPDATE SKIP LOCKED，其他消费者正在租用时不等待锁，MySQL 8.0 和 PostgreSQL 9.5 以上支持
+	SkipLocked bool
+	// AutoMigrate 创建 Subscriber 时创建消息表和 offset 表
+	AutoMigrate bool
+	Logger      domain.LoggerAdapter
+}
+
+// Subscriber 轮询消息表，同一个消费组的订阅者在短事务中租用 offset 行，
+// 租约有效期间其他订阅者不会读取同一个 topic 的消息，处理消息时不持有数据库锁，
+// 处理消息的代码可以在同一个数据库中发布消息。租约使用各个实例的本地时间。
+//
+// 自增 ID 按插入顺序分配，但并发的事务可能不按 ID 顺序提交，
+// 长事务中发布的消息有可能在 offset 越过它之后才可见而被跳过
+type Subscriber struct {
+	config  SubscriberConfig
+	closing chan struct{}
+	closed  atomic.Bool
+	wg      sync.WaitGroup
+}
+
+type deliverResult int
+
+const (
+	deliverAcked deliverResult = iota
+	deliverNacked
+	deliverClosed
+)
+
+func SubscriberMaker(cfg SubscriberConfig) domain.SubscriberMaker {
+	return func() (domain.Subscriber, error) {
+		return NewSubscriber(cfg)
+	}
+}
+
+func NewSubscriber(cfg SubscriberConfig) (*Subscriber, error) {
+	if err := defaults.Set(&cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.DB == nil {
+		return nil, errors.New("sql: missing DB")
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = domain.Logger
+	}
+
+	if cfg.AutoMigrate {
+		if err := Migrate(cfg.DB, cfg.MessagesTable, cfg.OffsetsTable); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Subscriber{
+		config:  cfg,
+		closing: make(chan struct{}),
+	}, nil
+}
+
+// Subscribe returns output channel with messages from provided topic.
+//
+// To receive the next message, `Ack()` must be called on the received message.
+// Nacked message is redelivered after NackResendSleep.
+func (sub *Subscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	if sub.closed.Load() {
+		return nil, ErrSubscriberClosed
+	}
+
+	var output = make(chan *message.Message)
+
+	sub.wg.Add(1)
+	go func() {
+		defer sub.wg.Done()
+		defer close(output)
+
+		sub.consume(ctx, topic, output)
+	}()
+
+	return output, nil
+}
+
+func (sub *Subscriber) consume(ctx context.Context, topic string, output chan *message.Message) {
+	var (
+		interval = sub.config.PollInterval
+		// owner 是这次订阅持有的租约
+		owner  = watermill.NewUUID()
+		fields = watermill.LogFields{"topic": topic, "consumer_group": sub.config.ConsumerGroup}
+	)
+
+	for {
+		acked, nacked, err := sub.poll(ctx, topic, owner, output)
+		if err != nil {
+			sub.config.Logger.Error("Poll messages failed", err, fields)
+		}
+
+		var wait time.Duration
+		switch {
+		case nacked:
+			wait = sub.config.NackResendSleep
+		case acked > 0 && err == nil:
+			interval = sub.config.PollInterval
+		default:
+			wait = interval
+			if interval *= 2; interval > sub.config.MaxPollInterval {
+				interval = sub.config.MaxPollInterval
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.closing:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// poll 在一个短事务中租用消费组的 offset 并读取一批消息，事务提交之后再投递，
+// 每条消息确认后立即提交 offset 并续租，处理消息期间不持有数据库的锁和事务。
+// 返回确认的消息数，以及是否有消息被 Nack
+func (sub *Subscriber) poll(ctx context.Context, topic, owner string, output chan *message.Message) (acked int, nacked bool, err error) {
+	records, err := sub.lease(topic, owner)
+	if err != nil || len(records) == 0 {
+		return 0, false, err
+	}
+
+	// 不使用 ctx，订阅被取消时也要释放租约
+	defer func() {
+		if releaseErr := sub.release(topic, owner); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+	}()
+
+	for _, record := range records {
+		msg, err := unmarshalMessage(record)
+		if err != nil {
+			// 无法解析的消息重试也没有意义，跳过
+			sub.config.Logger.Error("Cannot unmarshal message", err, watermill.LogFields{"topic": topic, "id": record.ID})
+			if err := sub.commit(topic, owner, record.ID); err != nil {
+				return acked, false, err
+			}
+			continue
+		}
+
+		switch sub.deliver(ctx, msg, output) {
+		case deliverAcked:
+			acked++
+			if err := sub.commit(topic, owner, record.ID); err != nil {
+				return acked, false, err
+			}
+		case deliverNacked:
+			return acked, true, nil
+		case deliverClosed:
+			return acked, false, nil
+		}
+	}
+
+	return acked, false, nil
+}
+
+// lease 锁住 offset 行，没有其他订阅者持有未过期的租约时租用它并读取一批消息，
+// 没有新消息或者租约被其他订阅者持有时返回空
+func (sub *Subscriber) lease(topic, owner string) (records []*MessageRecord, err error) {
+	err = sub.config.DB.Transaction(func(tx *gorm.DB) error {
+		record, err := sub.lockOffset(tx, topic)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// SkipLocked 时其他订阅者正在租用
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var now = time.Now()
+		if record.LeaseOwner != "" && record.LeaseOwner != owner && record.LeasedUntil != nil && record.LeasedUntil.After(now) {
+			return nil
+		}
+
+		if err := tx.Table(sub.config.MessagesTable).
+			Where("topic = ? AND id > ?", topic, record.AckedID).
+			Order("id").
+			Limit(sub.config.BatchSize).
+			Find(&records).Error; err != nil {
+			return err
+		}
+
+		if len(records) == 0 {
+			return nil
+		}
+
+		leasedUntil := now.Add(sub.config.LeaseTimeout)
+		return sub.offsets(tx, topic).
+			Updates(map[string]interface{}{"lease_owner": owner, "leased_until": &leasedUntil}).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// commit 提交 offset 并续租，租约已经被其他订阅者接管时返回 errLeaseLost
+func (sub *Subscriber) commit(topic, owner string, id uint64) error {
+	leasedUntil := time.Now().Add(sub.config.LeaseTimeout)
+
+	tx := sub.offsets(sub.config.DB, topic).
+		Where("lease_owner = ?", owner).
+		Updates(map[string]interface{}{"acked_id": id, "leased_until": &leasedUntil, "updated_at": time.Now()})
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if tx.RowsAffected == 0 {
+		return errLeaseLost
+	}
+
+	return nil
+}
+
+func (sub *Subscriber) release(topic, owner string) error {
+	return sub.offsets(sub.config.DB, topic).
+		Where("lease_owner = ?", owner).
+		Updates(map[string]interface{}{"lease_owner": "", "leased_until": nil}).Error
+}
+
+func (sub *Subscriber) offsets(db *gorm.DB, topic string) *gorm.DB {
+	return db.Table(sub.config.OffsetsTable).
+		Where("consumer_group = ? AND topic = ?", sub.config.ConsumerGroup, topic)
+}
+
+func (sub *Subscriber) lockOffset(tx *gorm.DB, topic string) (*OffsetRecord, error) {
+	var locking = clause.Locking{Strength: "UPDATE"}
+	if sub.config.SkipLocked {
+		locking.Options = "SKIP LOCKED"
+	}
+
+	var (
+		record OffsetRecord
+		query  = func() error {
+			return sub.offsets(tx, topic).
+				Clauses(locking).
+				Take(&record).Error
+		}
+	)
+
+	err := query()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 消费组第一次消费这个 topic
+		if err := tx.Table(sub.config.OffsetsTable).
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&OffsetRecord{ConsumerGroup: sub.config.ConsumerGroup, Topic: topic}).Error; err != nil {
+			return nil, fmt.Errorf("sql: create offset failed: %w", err)
+		}
+		err = query()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+func (sub *Subscriber) deliver(ctx context.Context, msg *message.Message, output chan *message.Message) deliverResult {
+	msgCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	msg.SetContext(msgCtx)
+
+	select {
+	case output <- msg:
+	case <-ctx.Done():
+		return deliverClosed
+	case <-sub.closing:
+		return deliverClosed
+	}
+
+	select {
+	case <-msg.Acked():
+		return deliverAcked
+	case <-msg.Nacked():
+		return deliverNacked
+	case <-ctx.Done():
+		return deliverClosed
+	case <-sub.closing:
+		return deliverClosed
+	}
+}
+
+// Close closes all subscriptions, offsets are committed as soon as messages are acked.
+func (sub *Subscriber) Close() error {
+	if !sub.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	close(sub.closing)
+	sub.wg.Wait()
+
+	return nil
+}
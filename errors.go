@@ -12,6 +12,7 @@ var (
 	ErrCantPrimaryKey    = errors.New("can't get primary key")
 	ErrMustNotZero       = errors.New("must not zero value")
 	ErrNotFound          = errors.New("not found")
+	ErrNoChanges         = errors.New("no changes")
 )
 
 func CheckDuplicate(err error) bool {
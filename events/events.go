@@ -2,17 +2,23 @@ package events
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
 
-	"github.com/ThreeDotsLabs/watermill-kafka/v2/pkg/kafka"
-	// "github.com/ThreeDotsLabs/watermill-nats/pkg/nats"
-	// "github.com/AlexCuse/watermill-jetstream/pkg/jetstream"
+	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/hnhuaxi/domain"
-	"github.com/hnhuaxi/domain/driver/amqp"
-	"github.com/hnhuaxi/domain/driver/nsq"
+	"github.com/hnhuaxi/domain/driver"
+	_ "github.com/hnhuaxi/domain/driver/amqp"
+	_ "github.com/hnhuaxi/domain/driver/jetstream"
+	_ "github.com/hnhuaxi/domain/driver/nats"
+	_ "github.com/hnhuaxi/domain/driver/nsq"
 	"github.com/hnhuaxi/platform/config"
 	"github.com/hnhuaxi/platform/logger"
+	"go.uber.org/multierr"
 )
 
 type Message = message.Message
@@ -25,138 +31,135 @@ type Publisher interface {
 	Publish(topic string, msgs ...*message.Message) error
 }
 
+// Events 持有一对发布者和订阅者，使用完之后需要 Close
 type Events struct {
-	subscriber Subscriber
-	publisher  Publisher
+	subscriber domain.Subscriber
+	publisher  domain.Publisher
 }
 
-func NewEvents(config *config.Config, logger *logger.Logger) (*Events, error) {
-	switch config.MessageQueue.Driver {
-	case "kafka":
-		var (
-			cfg             = config.MessageQueue.Kafka
-			subscribeConfig = kafka.DefaultSaramaSubscriberConfig()
-		)
+var _ domain.Pubsublisher = (*Events)(nil)
 
-		subscriber, err := kafka.NewSubscriber(
-			kafka.SubscriberConfig{
-				Brokers:               cfg.Brokers,
-				Unmarshaler:           kafka.DefaultMarshaler{},
-				OverwriteSaramaConfig: subscribeConfig,
-				ConsumerGroup:         cfg.Group,
-			},
-			domain.StdLogger(logger),
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create kafka subscriber: %w", err)
-		}
+// ConfigOption 配置文件中没有的驱动选项
+type ConfigOption struct {
+	// NsqMarshaler nsq 的消息编码，gob(默认)、json 或 proto，见 nsq.MarshalerByName
+	NsqMarshaler string
+}
+
+type ConfigOptFunc func(opt *ConfigOption)
+
+func OptNsqMarshaler(name string) ConfigOptFunc {
+	return func(opt *ConfigOption) {
+		opt.NsqMarshaler = name
+	}
+}
+
+// NewEvents 根据配置的消息队列驱动创建 Events，
+// MessageQueue.Driver 也可以直接是一个驱动 DSN，例如 kafka://broker1,broker2?group=x，
+// nsq 的消息编码通过 OptNsqMarshaler 选择，或者 DSN 的 marshaler 参数，例如 nsq://localhost:4150?channel=x&marshaler=json
+func NewEvents(config *config.Config, logger *logger.Logger, opts ...ConfigOptFunc) (*Events, error) {
+	dsn, err := ConfigDSN(config, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return Open(dsn, driver.OptLogger(domain.StdLogger(logger)))
+}
+
+// Open creates Events from a driver DSN, see driver.Open
+func Open(dsn string, opts ...driver.OpenOptFunc) (*Events, error) {
+	publisherMaker, subscriberMaker, err := driver.Open(dsn, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEventsFromMakers(publisherMaker, subscriberMaker)
+}
+
+func NewEventsFromMakers(publisherMaker domain.PublisherMaker, subscriberMaker domain.SubscriberMaker) (*Events, error) {
+	publisher, err := publisherMaker()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create publisher: %w", err)
+	}
+
+	subscriber, err := subscriberMaker()
+	if err != nil {
+		publisher.Close()
+		return nil, fmt.Errorf("failed to create subscriber: %w", err)
+	}
+
+	return &Events{
+		subscriber: subscriber,
+		publisher:  publisher,
+	}, nil
+}
+
+// ConfigDSN converts the message queue config into a driver DSN
+func ConfigDSN(config *config.Config, opts ...ConfigOptFunc) (string, error) {
+	var (
+		mq  = config.MessageQueue
+		opt ConfigOption
+	)
 
-		publishConfig := kafka.DefaultSaramaSyncPublisherConfig()
-		publishConfig.Producer.Return.Errors = true
+	for _, op := range opts {
+		op(&opt)
+	}
+
+	if strings.Contains(mq.Driver, "://") {
+		return mq.Driver, nil
+	}
 
-		publisher, err := kafka.NewPublisher(
-			kafka.PublisherConfig{
-				Brokers:               cfg.Brokers,
-				Marshaler:             kafka.DefaultMarshaler{},
-				OverwriteSaramaConfig: publishConfig,
-			},
-			domain.StdLogger(logger),
+	switch mq.Driver {
+	case "kafka":
+		return (&url.URL{
+			Scheme:   "kafka",
+			Host:     strings.Join(mq.Kafka.Brokers, ","),
+			RawQuery: url.Values{"group": {mq.Kafka.Group}}.Encode(),
+		}).String(), nil
+	case "nats":
+		var (
+			cfg    = mq.Nats
+			scheme = "nats"
+			query  = url.Values{
+				"queue_group":   {cfg.QueueGroup},
+				"durable_name":  {cfg.DurableName},
+				"close_timeout": {cfg.CloseTimeout.String()},
+				"ack_wait":      {cfg.AckWaitTimeout.String()},
+			}
 		)
 
-		if err != nil {
-			return nil, fmt.Errorf("failed to create kafka publisher: %w", err)
-		}
-		return &Events{
-			subscriber: subscriber,
-			publisher:  publisher,
-		}, nil
-	// case "nats":
-	// var (
-	// 	cfg = config.MessageQueue.Nats
-	// )
-	// _ = cfg
-	// // subscribeConfig := jetstream.
-
-	// subscriber, err := jetstream.NewSubscriber(
-	// 	jetstream.SubscriberConfig{
-	// 		URL:            cfg.Addr,
-	// 		CloseTimeout:   cfg.CloseTimeout,
-	// 		AckWaitTimeout: cfg.AckWaitTimeout,
-	// 		Unmarshaler:    jetstream.JSONMarshaler{},
-	// 	},
-	// 	// nats.StreamingSubscriberConfig{
-	// 	// 	ClusterID:        cfg.ClusterID,
-	// 	// 	ClientID:         cfg.ClientID,
-	// 	// 	QueueGroup:       cfg.QueueGroup,
-	// 	// 	DurableName:      cfg.DurableName,
-	// 	// 	SubscribersCount: cfg.MaxSubscribeCount, // how many goroutines should consume messages
-	// 	// 	CloseTimeout:     cfg.CloseTimeout,
-	// 	// 	AckWaitTimeout:   cfg.AckWaitTimeout,
-	// 	// 	StanOptions: []stan.Option{
-	// 	// 		stan.NatsURL(cfg.Addr),
-	// 	// 	},
-	// 	// 	Unmarshaler: nats.GobMarshaler{},
-	// 	// },
-	// 	domain.StdLogger(logger),
-	// )
-	// if err != nil {
-	// 	return nil, fmt.Errorf("failed to create nats subscriber: %w", err)
-	// }
-
-	// publisher, err := jetstream.NewPublisher(
-	// 	jetstream.PublisherConfig{
-	// 		URL:       cfg.Addr,
-	// 		Marshaler: jetstream.JSONMarshaler{},
-	// 	},
-	// 	domain.StdLogger(logger),
-	// )
-	// if err != nil {
-	// 	return nil, fmt.Errorf("failed to create nats publisher: %w", err)
-	// }
-
-	// return &Events{
-	// 	subscriber: subscriber,
-	// 	publisher:  publisher,
-	// }, nil
-	case "nsq":
-		publisher, err := nsq.NsqPublisherMaker(nsq.NsqPublisherConfig{
-			Addr:      config.MessageQueue.Nsq.Addr,
-			Marshaler: nsq.GobMarshaler{},
-		})()
-		if err != nil {
-			return nil, err
+		// 设置了 ClusterID 的是 NATS Streaming 的配置，继续使用 stan 驱动
+		if cfg.ClusterID != "" {
+			scheme = "stan"
+			query.Set("cluster_id", cfg.ClusterID)
+			query.Set("client_id", cfg.ClientID)
 		}
 
-		subscriber, err := nsq.NsqSubscriberMaker(nsq.NsqSubscribeConfig{
-			Channel:     config.MessageQueue.Nsq.Channel,
-			Addr:        config.MessageQueue.Nsq.Addr,
-			Unmarshaler: nsq.GobMarshaler{},
-		})()
-		if err != nil {
-			return nil, err
+		// JetStream 只有设置了 queue group 时才能有多个订阅者
+		if cfg.QueueGroup != "" || scheme == "stan" {
+			query.Set("subscribers", strconv.Itoa(cfg.MaxSubscribeCount))
 		}
 
-		return &Events{
-			subscriber: subscriber,
-			publisher:  publisher,
-		}, nil
-	case "rabbitmq":
-		addr := config.MessageQueue.Rabbitmq.Addr
-
-		publisher, err := amqp.PublisherMaker(addr)()
-		if err != nil {
-			return nil, err
+		return (&url.URL{
+			Scheme:   scheme,
+			Host:     strings.TrimPrefix(cfg.Addr, "nats://"),
+			RawQuery: query.Encode(),
+		}).String(), nil
+	case "nsq":
+		var query = url.Values{"channel": {mq.Nsq.Channel}}
+		if opt.NsqMarshaler != "" {
+			query.Set("marshaler", opt.NsqMarshaler)
 		}
 
-		subscriber, err := amqp.SubscriberMaker(addr)()
-		return &Events{
-			subscriber: subscriber,
-			publisher:  publisher,
-		}, nil
+		return (&url.URL{
+			Scheme:   "nsq",
+			Host:     mq.Nsq.Addr,
+			RawQuery: query.Encode(),
+		}).String(), nil
+	case "rabbitmq":
+		return mq.Rabbitmq.Addr, nil
 	default:
-		return nil, domain.ErrInvalidDriverType
+		return "", domain.ErrInvalidDriverType
 	}
-
 }
 
 func (events *Events) Subscribe(ctx context.Context, topic string) (<-chan *Message, error) {
@@ -168,6 +171,64 @@ func (events *Events) Subscribe(ctx context.Context, topic string) (<-chan *Mess
 	return messages, nil
 }
 
-func (events *Events) Publish(topic string, msg *Message) error {
-	return events.publisher.Publish(topic, msg)
+func (events *Events) Publish(topic string, msgs ...*Message) error {
+	return events.publisher.Publish(topic, msgs...)
+}
+
+// Close 关闭发布者和订阅者，订阅返回的 channel 随之关闭
+func (events *Events) Close() error {
+	var errs error
+	if err := events.publisher.Close(); err != nil {
+		errs = multierr.Append(errs, fmt.Errorf("failed to close publisher: %w", err))
+	}
+
+	if err := events.subscriber.Close(); err != nil {
+		errs = multierr.Append(errs, fmt.Errorf("failed to close subscriber: %w", err))
+	}
+
+	return errs
+}
+
+// PublishJSON 把 v 编码为 JSON 作为消息的 payload 发布到 topic
+func PublishJSON[T any](events *Events, topic string, v T) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %T: %w", v, err)
+	}
+
+	return events.Publish(topic, message.NewMessage(watermill.NewUUID(), payload))
+}
+
+// SubscribeJSON 订阅 topic 并把 payload 解码为 T，值被接收之后消息才确认，
+// 无法解码的消息记录日志后确认丢弃，ctx 结束或 Events 关闭时 channel 关闭
+func SubscribeJSON[T any](ctx context.Context, events *Events, topic string) (<-chan T, error) {
+	messages, err := events.Subscribe(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	var output = make(chan T)
+
+	go func() {
+		defer close(output)
+
+		for msg := range messages {
+			var v T
+			if err := json.Unmarshal(msg.Payload, &v); err != nil {
+				domain.Logger.Error("Cannot unmarshal message", err, watermill.LogFields{"topic": topic, "message_uuid": msg.UUID})
+				msg.Ack()
+				continue
+			}
+
+			select {
+			case output <- v:
+				msg.Ack()
+			case <-ctx.Done():
+				msg.Nack()
+				return
+			}
+		}
+	}()
+
+	return output, nil
 }
@@ -0,0 +1,210 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/platform/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+)
+
+type RoomBooked struct {
+	RoomId    string
+	GuestName string
+}
+
+func TestJSON(t *testing.T) {
+	events, err := NewEventsFromMakers(domain.GoPubsublisherMaker(gochannel.Config{}))
+	assert.NoError(t, err)
+
+	booked, err := SubscribeJSON[RoomBooked](context.Background(), events, "rooms")
+	assert.NoError(t, err)
+
+	assert.NoError(t, PublishJSON(events, "rooms", RoomBooked{RoomId: "1", GuestName: "Tom"}))
+
+	select {
+	case v := <-booked:
+		assert.Equal(t, RoomBooked{RoomId: "1", GuestName: "Tom"}, v)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting message")
+	}
+
+	// Close 关闭订阅返回的 channel
+	assert.NoError(t, events.Close())
+
+	select {
+	case _, ok := <-booked:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel is not closed")
+	}
+}
+
+func TestTopic(t *testing.T) {
+	events, err := NewEventsFromMakers(domain.GoPubsublisherMaker(gochannel.Config{}))
+	assert.NoError(t, err)
+	defer events.Close()
+
+	var (
+		topic    = NewTopic[*RoomBooked](events, "rooms")
+		received = make(chan *RoomBooked)
+		attempts atomic.Int32
+	)
+
+	assert.NoError(t, topic.Subscribe(context.Background(), func(ctx context.Context, v *RoomBooked) error {
+		// 第一次处理失败，Nack 之后重新投递
+		if attempts.Inc() == 1 {
+			return errors.New("retry")
+		}
+
+		received <- v
+		return nil
+	}))
+
+	assert.NoError(t, topic.Publish(context.Background(), &RoomBooked{RoomId: "1", GuestName: "Tom"}))
+
+	select {
+	case v := <-received:
+		assert.Equal(t, &RoomBooked{RoomId: "1", GuestName: "Tom"}, v)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting message")
+	}
+	assert.Equal(t, int32(2), attempts.Load())
+}
+
+// queuePubsub 同一个 topic 的多个订阅竞争消费，确认之后才投递下一条，和 kafka、nsq 的消费组相同
+type queuePubsub struct {
+	queue chan *message.Message
+}
+
+func (q *queuePubsub) Publish(topic string, msgs ...*message.Message) error {
+	for _, msg := range msgs {
+		q.queue <- msg
+	}
+	return nil
+}
+
+func (q *queuePubsub) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
+	output := make(chan *message.Message)
+
+	go func() {
+		defer close(output)
+		for {
+			select {
+			case msg := <-q.queue:
+				output <- msg
+				select {
+				case <-msg.Acked():
+				case <-msg.Nacked():
+					q.queue <- msg
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return output, nil
+}
+
+func (q *queuePubsub) Close() error {
+	return nil
+}
+
+func TestTopicConcurrency(t *testing.T) {
+	var (
+		pubsub = &queuePubsub{queue: make(chan *message.Message, 10)}
+		events = &Events{publisher: pubsub, subscriber: pubsub}
+		topic  = NewTopic[*RoomBooked](events, "rooms", OptConcurrency(2))
+
+		running, peak atomic.Int32
+		release       = make(chan struct{})
+		handled       = make(chan string, 4)
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	assert.NoError(t, topic.Subscribe(ctx, func(ctx context.Context, v *RoomBooked) error {
+		n := running.Inc()
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+
+		<-release
+		running.Dec()
+		handled <- v.RoomId
+		return nil
+	}))
+
+	for _, room := range []string{"1", "2", "3", "4"} {
+		assert.NoError(t, topic.Publish(ctx, &RoomBooked{RoomId: room}))
+	}
+
+	// 两个处理器同时运行，第三条消息等待
+	assert.Eventually(t, func() bool { return running.Load() == 2 }, 5*time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(2), running.Load())
+
+	close(release)
+
+	var rooms []string
+	for i := 0; i < 4; i++ {
+		select {
+		case room := <-handled:
+			rooms = append(rooms, room)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting message")
+		}
+	}
+
+	assert.ElementsMatch(t, []string{"1", "2", "3", "4"}, rooms)
+	assert.Equal(t, int32(2), peak.Load())
+}
+
+func TestConfigDSNNsqMarshaler(t *testing.T) {
+	var cfg config.Config
+	cfg.MessageQueue.Driver = "nsq"
+	cfg.MessageQueue.Nsq.Addr = "localhost:4150"
+	cfg.MessageQueue.Nsq.Channel = "x"
+
+	dsn, err := ConfigDSN(&cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "nsq://localhost:4150?channel=x", dsn)
+
+	dsn, err = ConfigDSN(&cfg, OptNsqMarshaler("json"))
+	assert.NoError(t, err)
+	assert.Equal(t, "nsq://localhost:4150?channel=x&marshaler=json", dsn)
+}
+
+func TestConfigDSNNats(t *testing.T) {
+	var cfg config.Config
+	cfg.MessageQueue.Driver = "nats"
+	cfg.MessageQueue.Nats.Addr = "nats://localhost:4222"
+	cfg.MessageQueue.Nats.DurableName = "d"
+	cfg.MessageQueue.Nats.MaxSubscribeCount = 4
+	cfg.MessageQueue.Nats.CloseTimeout = time.Minute
+	cfg.MessageQueue.Nats.AckWaitTimeout = 30 * time.Second
+
+	// 没有 queue group 时 JetStream 只能有一个订阅者
+	dsn, err := ConfigDSN(&cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "nats://localhost:4222?ack_wait=30s&close_timeout=1m0s&durable_name=d&queue_group=", dsn)
+
+	cfg.MessageQueue.Nats.QueueGroup = "g"
+	dsn, err = ConfigDSN(&cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "nats://localhost:4222?ack_wait=30s&close_timeout=1m0s&durable_name=d&queue_group=g&subscribers=4", dsn)
+
+	// NATS Streaming 的配置仍然使用 stan 驱动
+	cfg.MessageQueue.Nats.ClusterID = "c"
+	cfg.MessageQueue.Nats.ClientID = "x"
+	dsn, err = ConfigDSN(&cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "stan://localhost:4222?ack_wait=30s&client_id=x&close_timeout=1m0s&cluster_id=c&durable_name=d&queue_group=g&subscribers=4", dsn)
+}
@@ -0,0 +1,150 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/components/cqrs"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/hnhuaxi/domain"
+)
+
+// Topic 绑定 topic 名称、编码和 Go 类型，发布和订阅时自动编解码，
+// 订阅时根据处理函数返回的错误确认或者 Nack 消息
+type Topic[T any] struct {
+	events *Events
+	name   string
+	opt    TopicOption
+}
+
+type TopicOption struct {
+	Marshaler cqrs.CommandEventMarshaler
+	// Concurrency 订阅的次数，每个订阅一个 goroutine，最多同时处理 Concurrency 条消息。
+	// 驱动需要在同一个消费组的订阅之间分配消息，例如 kafka 分区、nsq channel、amqp 队列；
+	// gochannel 的每个订阅都收到全部消息，local 同一个消费组同一时间只有一个订阅投递
+	Concurrency int
+	Logger      domain.LoggerAdapter
+}
+
+type TopicOptFunc func(opt *TopicOption)
+
+func OptMarshaler(marshaler cqrs.CommandEventMarshaler) TopicOptFunc {
+	return func(opt *TopicOption) {
+		opt.Marshaler = marshaler
+	}
+}
+
+func OptConcurrency(n int) TopicOptFunc {
+	return func(opt *TopicOption) {
+		opt.Concurrency = n
+	}
+}
+
+func OptLogger(log domain.LoggerAdapter) TopicOptFunc {
+	return func(opt *TopicOption) {
+		opt.Logger = log
+	}
+}
+
+// NewTopic 默认使用 JSON 编码，T 是 protobuf 消息的指针时使用 OptMarshaler(domain.ProtobufMarshaler)
+func NewTopic[T any](events *Events, name string, opts ...TopicOptFunc) *Topic[T] {
+	var opt = TopicOption{
+		Marshaler:   domain.JSONMarshaler,
+		Concurrency: 1,
+		Logger:      domain.Logger,
+	}
+
+	for _, op := range opts {
+		op(&opt)
+	}
+
+	if opt.Concurrency < 1 {
+		opt.Concurrency = 1
+	}
+
+	return &Topic[T]{
+		events: events,
+		name:   name,
+		opt:    opt,
+	}
+}
+
+func (topic *Topic[T]) Name() string {
+	return topic.name
+}
+
+func (topic *Topic[T]) Publish(ctx context.Context, v T) error {
+	msg, err := topic.opt.Marshaler.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %T: %w", v, err)
+	}
+	msg.SetContext(ctx)
+
+	return topic.events.Publish(topic.name, msg)
+}
+
+// Subscribe 订阅 Concurrency 次，每个订阅一个 goroutine 依次处理消息，订阅成功后立即返回，
+// handle 返回 nil 时确认消息，返回错误时 Nack 由驱动重新投递，
+// 无法解码的消息记录日志后确认丢弃，ctx 结束或 Events 关闭时停止处理
+func (topic *Topic[T]) Subscribe(ctx context.Context, handle func(ctx context.Context, v T) error) error {
+	var wg sync.WaitGroup
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	for i := 0; i < topic.opt.Concurrency; i++ {
+		messages, err := topic.events.Subscribe(ctx, topic.name)
+		if err != nil {
+			// 停止已经成功的订阅
+			cancel()
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range messages {
+				topic.handle(msg, handle)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+
+	return nil
+}
+
+func (topic *Topic[T]) handle(msg *message.Message, handle func(ctx context.Context, v T) error) {
+	var fields = watermill.LogFields{"topic": topic.name, "message_uuid": msg.UUID}
+
+	v, err := topic.decode(msg)
+	if err != nil {
+		topic.opt.Logger.Error("Cannot unmarshal message", err, fields)
+		msg.Ack()
+		return
+	}
+
+	if err := handle(msg.Context(), v); err != nil {
+		topic.opt.Logger.Error("Handle message failed", err, fields)
+		msg.Nack()
+		return
+	}
+
+	msg.Ack()
+}
+
+// decode T 是指针类型时解码到新分配的值中，protobuf 消息需要这样解码
+func (topic *Topic[T]) decode(msg *message.Message) (T, error) {
+	var v T
+	if typ := reflect.TypeOf(v); typ != nil && typ.Kind() == reflect.Ptr {
+		v = reflect.New(typ.Elem()).Interface().(T)
+		return v, topic.opt.Marshaler.Unmarshal(msg, v)
+	}
+
+	return v, topic.opt.Marshaler.Unmarshal(msg, &v)
+}
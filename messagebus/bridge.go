@@ -0,0 +1,155 @@
+package messagebus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/hnhuaxi/domain"
+	"go.uber.org/multierr"
+)
+
+// BridgedMetadataKey 转发的消息带上 bridge 的名称，避免双向镜像时消息来回转发
+const BridgedMetadataKey = "_bridged_by"
+
+// BridgeRoute 把 From topic 上的消息转发到 To topic
+type BridgeRoute struct {
+	From string
+	// To 目标 topic，为空时和 From 相同
+	To string
+	// EventNames 只转发这些名称的事件，名称由 BridgeConfig.Marshaler 的 NameFromMessage 读取，为空时转发全部消息
+	EventNames []string
+}
+
+type BridgeConfig struct {
+	// Name 桥的名称，用于处理器名称和 BridgedMetadataKey
+	Name            string
+	SubscriberMaker domain.SubscriberMaker
+	PublisherMaker  domain.PublisherMaker
+	Routes          []BridgeRoute
+	// Filter 返回 false 的消息被确认但不转发
+	Filter func(route BridgeRoute, msg *message.Message) bool
+	// ForwardBridged 转发其他 bridge 转发过来的消息，默认跳过，
+	// 两个方向的 bridge 镜像同一个 topic 时不能设置
+	ForwardBridged bool
+	Marshaler      domain.CommandEventMarshaler
+	Logger         watermill.LoggerAdapter
+}
+
+// Bridge 订阅一个驱动上的 topic 并发布到另一个驱动，例如从 NSQ 迁移到 Kafka 期间镜像事件，
+// 消息发布成功之后才确认源消息，提供至少一次的转发，UUID 和 metadata 保持不变
+type Bridge struct {
+	config BridgeConfig
+	router *domain.Router
+}
+
+func NewBridge(config BridgeConfig) (*Bridge, error) {
+	if config.SubscriberMaker == nil || config.PublisherMaker == nil {
+		return nil, errors.New("messagebus: bridge requires SubscriberMaker and PublisherMaker")
+	}
+
+	if len(config.Routes) == 0 {
+		return nil, errors.New("messagebus: bridge requires at least one route")
+	}
+
+	if config.Name == "" {
+		config.Name = "bridge"
+	}
+
+	if config.Marshaler == nil {
+		config.Marshaler = DefaultMarshaler
+	}
+
+	if config.Logger == nil {
+		config.Logger = domain.Logger
+	}
+
+	router, err := message.NewRouter(message.RouterConfig{}, config.Logger)
+	if err != nil {
+		return nil, err
+	}
+	router.AddMiddleware(middleware.Recoverer)
+
+	publisher, err := config.PublisherMaker()
+	if err != nil {
+		return nil, fmt.Errorf("messagebus: create bridge publisher failed: %w", err)
+	}
+
+	// 创建失败时关闭已经创建的发布者和订阅者，router 还没有运行，不会关闭它们
+	var closers = []io.Closer{publisher}
+	for _, route := range config.Routes {
+		if route.To == "" {
+			route.To = route.From
+		}
+
+		subscriber, err := config.SubscriberMaker()
+		if err != nil {
+			err = fmt.Errorf("messagebus: create bridge subscriber failed: %w", err)
+			for _, closer := range closers {
+				err = multierr.Append(err, closer.Close())
+			}
+			return nil, err
+		}
+		closers = append(closers, subscriber)
+
+		router.AddHandler(
+			fmt.Sprintf("%s_%s_%s", config.Name, route.From, route.To),
+			route.From,
+			subscriber,
+			route.To,
+			publisher,
+			newBridgeHandler(config, route),
+		)
+	}
+
+	return &Bridge{
+		config: config,
+		router: router,
+	}, nil
+}
+
+func newBridgeHandler(config BridgeConfig, route BridgeRoute) message.HandlerFunc {
+	var names = make(map[string]struct{}, len(route.EventNames))
+	for _, name := range route.EventNames {
+		names[name] = struct{}{}
+	}
+
+	return func(msg *message.Message) ([]*message.Message, error) {
+		if !config.ForwardBridged && msg.Metadata.Get(BridgedMetadataKey) != "" {
+			return nil, nil
+		}
+
+		if len(names) > 0 {
+			if _, ok := names[config.Marshaler.NameFromMessage(msg)]; !ok {
+				return nil, nil
+			}
+		}
+
+		if config.Filter != nil && !config.Filter(route, msg) {
+			return nil, nil
+		}
+
+		forward := msg.Copy()
+		forward.Metadata.Set(BridgedMetadataKey, config.Name)
+
+		return []*message.Message{forward}, nil
+	}
+}
+
+// Run 阻塞直到 ctx 结束或者 Close
+func (bridge *Bridge) Run(ctx context.Context) error {
+	return bridge.router.Run(ctx)
+}
+
+// Running 在所有路由都开始订阅之后关闭
+func (bridge *Bridge) Running() chan struct{} {
+	return bridge.router.Running()
+}
+
+func (bridge *Bridge) Close() error {
+	return bridge.router.Close()
+}
@@ -0,0 +1,120 @@
+package messagebus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/hnhuaxi/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBridge(t *testing.T) {
+	var (
+		sourcePublisherMaker, sourceSubscriberMaker = domain.GoPubsublisherMaker(gochannel.Config{})
+		targetPublisherMaker, targetSubscriberMaker = domain.GoPubsublisherMaker(gochannel.Config{})
+	)
+
+	bridge, err := NewBridge(BridgeConfig{
+		Name:            "nsq_to_kafka",
+		SubscriberMaker: sourceSubscriberMaker,
+		PublisherMaker:  targetPublisherMaker,
+		Routes: []BridgeRoute{{
+			From:       "events",
+			To:         "mirrored_events",
+			EventNames: []string{DefaultMarshaler.Name(&OrderBeer{})},
+		}},
+	})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go bridge.Run(ctx)
+	<-bridge.Running()
+
+	targetSubscriber, err := targetSubscriberMaker()
+	assert.NoError(t, err)
+
+	messages, err := targetSubscriber.Subscribe(ctx, "mirrored_events")
+	assert.NoError(t, err)
+
+	sourcePublisher, err := sourcePublisherMaker()
+	assert.NoError(t, err)
+
+	cleanRoom, err := DefaultMarshaler.Marshal(&CleanRoom{RoomId: "1"})
+	assert.NoError(t, err)
+
+	orderBeer, err := DefaultMarshaler.Marshal(&OrderBeer{RoomId: "1", Count: 2})
+	assert.NoError(t, err)
+	orderBeer.Metadata.Set("trace_id", "abc")
+
+	// 已经转发过的消息不会再次转发
+	bridged := orderBeer.Copy()
+	bridged.UUID = "bridged"
+	bridged.Metadata.Set(BridgedMetadataKey, "kafka_to_nsq")
+
+	assert.NoError(t, sourcePublisher.Publish("events", cleanRoom, bridged, orderBeer))
+
+	select {
+	case msg := <-messages:
+		assert.Equal(t, orderBeer.UUID, msg.UUID)
+		assert.Equal(t, "abc", msg.Metadata.Get("trace_id"))
+		assert.Equal(t, "nsq_to_kafka", msg.Metadata.Get(BridgedMetadataKey))
+
+		var evt OrderBeer
+		assert.NoError(t, DefaultMarshaler.Unmarshal(msg, &evt))
+		assert.Equal(t, OrderBeer{RoomId: "1", Count: 2}, evt)
+		msg.Ack()
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting message")
+	}
+
+	select {
+	case msg := <-messages:
+		t.Fatalf("unexpected message %s", msg.UUID)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.NoError(t, bridge.Close())
+}
+
+// countingPubSub 记录 Close 的次数
+type countingPubSub struct {
+	*gochannel.GoChannel
+	closed *int
+}
+
+func (c countingPubSub) Close() error {
+	*c.closed++
+	return c.GoChannel.Close()
+}
+
+func TestBridgeCloseOnError(t *testing.T) {
+	var (
+		closed    int
+		makes     int
+		errMaker  = errors.New("maker failed")
+		newPubSub = func() countingPubSub {
+			return countingPubSub{GoChannel: gochannel.NewGoChannel(gochannel.Config{}, nil), closed: &closed}
+		}
+	)
+
+	// 第二个路由的订阅者创建失败，关闭已经创建的发布者和第一个订阅者
+	_, err := NewBridge(BridgeConfig{
+		SubscriberMaker: func() (domain.Subscriber, error) {
+			if makes++; makes > 1 {
+				return nil, errMaker
+			}
+			return newPubSub(), nil
+		},
+		PublisherMaker: func() (domain.Publisher, error) {
+			return newPubSub(), nil
+		},
+		Routes: []BridgeRoute{{From: "a"}, {From: "b"}},
+	})
+	assert.ErrorIs(t, err, errMaker)
+	assert.Equal(t, 2, closed)
+}
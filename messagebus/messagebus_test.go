@@ -10,6 +10,7 @@ import (
 	"github.com/ThreeDotsLabs/watermill/components/cqrs"
 	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
 	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/driver"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -87,3 +88,52 @@ func publishCommands(commandBus *cqrs.CommandBus) func() {
 		time.Sleep(time.Second)
 	}
 }
+
+func TestBusTopics(t *testing.T) {
+	var (
+		publisherMaker, subscribeMaker = domain.GoPubsublisherMaker(gochannel.Config{})
+	)
+
+	bus := NewMessageBus(BusConfig{
+		SubscriberMaker: subscribeMaker,
+		PublisherMaker:  publisherMaker,
+	})
+
+	bus.AddCmdHandler(domain.NewCmdHandler(func(ctx context.Context, cmd *BookRoom) error {
+		return nil
+	}))
+
+	bus.AddEventHandler(domain.NewEventHandler(func(ctx context.Context, evt *OrderBeer) error {
+		return nil
+	}))
+
+	assert.Equal(t, []string{"events", "messagebus.BookRoom"}, bus.Topics())
+}
+
+func TestBusEventsDSN(t *testing.T) {
+	var (
+		publisherMaker, subscribeMaker = domain.GoPubsublisherMaker(gochannel.Config{})
+		groups                         []string
+	)
+
+	driver.Register("testevents", func(dsn *driver.DSN, opt *driver.OpenOption) (domain.PublisherMaker, domain.SubscriberMaker, error) {
+		groups = append(groups, dsn.Get("group"))
+		return publisherMaker, subscribeMaker, nil
+	})
+
+	bus := NewMessageBus(BusConfig{
+		SubscriberMaker: subscribeMaker,
+		PublisherMaker:  publisherMaker,
+		EventsDSN:       "testevents://?topology=pubsub&group={handler}",
+	})
+	assert.NoError(t, bus.openDSN())
+	assert.NotNil(t, bus.config.EventsPublisherMaker)
+
+	_, err := bus.config.EventsSubscriberConstructor("OrderBeer handler")
+	assert.NoError(t, err)
+	_, err = bus.config.EventsSubscriberConstructor("CleanRoom")
+	assert.NoError(t, err)
+
+	// 每个事件处理器使用自己的消费组
+	assert.Equal(t, []string{"", "OrderBeer handler", "CleanRoom"}, groups)
+}
@@ -2,50 +2,411 @@ package repository
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/hnhuaxi/cache"
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/utils"
 	"github.com/hnhuaxi/platform/logger"
+	"go.uber.org/atomic"
 )
 
+// CacheRepository 是任意 Repository 的缓存装饰器，按主键 Get 时先读缓存，未命中时读取并写入缓存，
+// Insert 和 Delete 之后使缓存失效，或者在 WriteThrough 时直接写入缓存。
+//
+// 只有按主键(id)且没有 Select/Omit/Relations/DBScopes/Scope/Trashed 的 Get 使用缓存，
+// 其他查询和 Find 直接交给被装饰的 Repository
 type CacheRepository[M Model[E], E any] struct {
 	logger *logger.Logger
 	repos  Repository[M, E]
-	cache  *cache.Cache[string, E]
+	cache  Cache[E]
+	opt    CacheOption
+	flight flightGroup[E]
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type CacheOption struct {
+	// Namespace 缓存 key 的前缀，多个服务共用一个缓存时区分
+	Namespace string
+	// Expiration 缓存的默认过期时间，Get 的 OptExpiration 和 Insert 的 OptExpires 优先
+	Expiration time.Duration
+	// WriteThrough Insert 之后把实体写入缓存，默认只使缓存失效
+	WriteThrough bool
+	// Singleflight 同一个 key 并发未命中时只读取一次，避免缓存击穿
+	Singleflight bool
+}
+
+type CacheOptFunc func(opt *CacheOption)
+
+// CacheStats 缓存命中统计
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+func OptCacheNamespace(namespace string) CacheOptFunc {
+	return func(opt *CacheOption) {
+		opt.Namespace = namespace
+	}
+}
+
+func OptCacheExpiration(expiration time.Duration) CacheOptFunc {
+	return func(opt *CacheOption) {
+		opt.Expiration = expiration
+	}
+}
+
+func OptWriteThrough() CacheOptFunc {
+	return func(opt *CacheOption) {
+		opt.WriteThrough = true
+	}
+}
+
+func OptSingleflight() CacheOptFunc {
+	return func(opt *CacheOption) {
+		opt.Singleflight = true
+	}
 }
 
-func NewCacheRepository[M Model[E], E any](repos Repository[M, E], logger *logger.Logger, size int) *CacheRepository[M, E] {
-	var log = logger.Sugar()
-	cache, err := cache.New[string, E](size)
+// NewCacheRepository 使用容量为 size 的进程内 LRU 缓存
+func NewCacheRepository[M Model[E], E any](repos Repository[M, E], logger *logger.Logger, size int, opts ...CacheOptFunc) *CacheRepository[M, E] {
+	cache, err := NewLRUCache[E](size)
 	if err != nil {
-		log.Fatalf("create cache failed with size: %d, because %s", size, err)
+		logger.Sugar().Fatalf("create cache failed with size: %d, because %s", size, err)
+	}
+
+	return NewCacheRepositoryWith[M](repos, cache, logger, opts...)
+}
+
+// NewCacheRepositoryWith 使用指定的缓存存储
+func NewCacheRepositoryWith[M Model[E], E any](repos Repository[M, E], cache Cache[E], logger *logger.Logger, opts ...CacheOptFunc) *CacheRepository[M, E] {
+	var opt CacheOption
+	for _, op := range opts {
+		op(&opt)
 	}
+
 	return &CacheRepository[M, E]{
 		logger: logger,
 		repos:  repos,
 		cache:  cache,
+		opt:    opt,
 	}
 }
 
+// Put 只把实体写入缓存
 func (cache *CacheRepository[M, E]) Put(ctx context.Context, entity E) error {
-	panic("not implemented") // TODO: Implement
+	id, ok := cache.entityID(entity)
+	if !ok {
+		return domain.ErrCantPrimaryKey
+	}
+
+	return cache.cache.Set(ctx, cache.cacheKey(id), entity, cache.opt.Expiration)
 }
 
-func (cache *CacheRepository[M, E]) Insert(ctx context.Context, entity E, opts ...PutOptFunc) error {
-	panic("not implemented") // TODO: Implement
+func (cache *CacheRepository[M, E]) Insert(ctx context.Context, entity *E, opts ...PutOptFunc) error {
+	if err := cache.repos.Insert(ctx, entity, opts...); err != nil {
+		return err
+	}
+
+	id, ok := cache.entityID(*entity)
+	if !ok {
+		return nil
+	}
+
+	key := cache.cacheKey(id)
+	if !cache.opt.WriteThrough {
+		cache.deleteKey(ctx, key)
+		return nil
+	}
+
+	var (
+		putOpts PutOption
+		value   = *entity
+	)
+	for _, op := range opts {
+		// 选项已经被被装饰的 Repository 校验过
+		_ = op(&putOpts)
+	}
+
+	// 在事务中时提交之后再写入，避免缓存未提交的数据
+	AfterCommit(ctx, func(ctx context.Context) {
+		if err := cache.cache.Set(ctx, key, value, cache.expiration(putOpts.Expires)); err != nil {
+			cache.warnf("update cache %s failed: %s", key, err)
+		}
+	})
+
+	return nil
 }
 
+// Peek 只读取缓存，未命中时返回 domain.ErrNotFound
 func (cache *CacheRepository[M, E]) Peek(ctx context.Context, id Key) (E, error) {
-	panic("not implemented") // TODO: Implement
+	entity, ok, err := cache.cache.Get(ctx, cache.cacheKey(id.Value()))
+	if err != nil {
+		return entity, err
+	}
+
+	if !ok {
+		return entity, domain.ErrNotFound
+	}
+
+	return entity, nil
 }
 
 func (cache *CacheRepository[M, E]) Get(ctx context.Context, id Key, opts ...SearchOptFunc) (E, error) {
-	panic("not implemented") // TODO: Implement
+	var so SearchOpt
+	for _, op := range opts {
+		// 这里只读取缓存相关的选项，校验交给被装饰的 Repository
+		_ = op(&so)
+	}
+
+	if !cacheable(id, &so) {
+		return cache.repos.Get(ctx, id, opts...)
+	}
+
+	var key = cache.cacheKey(id.Value())
+
+	if !so.SkipCache {
+		entity, ok, err := cache.cache.Get(ctx, key)
+		if err != nil {
+			cache.warnf("read cache %s failed: %s", key, err)
+		} else if ok {
+			cache.hits.Inc()
+			return entity, nil
+		}
+	}
+	cache.misses.Inc()
+
+	load := func() (E, error) {
+		entity, err := cache.repos.Get(ctx, id, opts...)
+		if err != nil {
+			return entity, err
+		}
+
+		if err := cache.fill(ctx, key, entity, cache.expiration(so.Expiration)); err != nil {
+			cache.warnf("write cache %s failed: %s", key, err)
+		}
+
+		return entity, nil
+	}
+
+	if cache.opt.Singleflight {
+		return cache.flight.Do(key, load)
+	}
+
+	return load()
 }
 
 func (cache *CacheRepository[M, E]) Find(ctx context.Context, opts ...SearchOptFunc) ([]E, SearchMetadata, error) {
-	panic("not implemented") // TODO: Implement
+	return cache.repos.Find(ctx, opts...)
 }
 
 func (cache *CacheRepository[M, E]) Delete(ctx context.Context, entity E) error {
-	panic("not implemented") // TODO: Implement
+	if err := cache.repos.Delete(ctx, entity); err != nil {
+		return err
+	}
+
+	if id, ok := cache.entityID(entity); ok {
+		cache.deleteKey(ctx, cache.cacheKey(id))
+	}
+
+	return nil
+}
+
+// Update 修改之后使缓存失效
+func (cache *CacheRepository[M, E]) Update(ctx context.Context, id Key, changes E, opts ...PutOptFunc) (int64, error) {
+	rows, err := cache.repos.Update(ctx, id, changes, opts...)
+	cache.invalidate(ctx, id)
+	return rows, err
+}
+
+// Patch 修改之后使缓存失效
+func (cache *CacheRepository[M, E]) Patch(ctx context.Context, id Key, patch []byte, opts ...PutOptFunc) (int64, error) {
+	rows, err := cache.repos.Patch(ctx, id, patch, opts...)
+	cache.invalidate(ctx, id)
+	return rows, err
+}
+
+// UpdateWhere 不知道哪些实体被修改，不会使缓存失效，
+// 调用方需要自己 Invalidate，或者依靠缓存的过期时间
+func (cache *CacheRepository[M, E]) UpdateWhere(ctx context.Context, filters []FilterItem, changes E, opts ...PutOptFunc) (int64, error) {
+	return cache.repos.UpdateWhere(ctx, filters, changes, opts...)
+}
+
+// Restore 被装饰的 Repository 没有实现 SoftDeleter 时返回 ErrSoftDeleteDisabled
+func (cache *CacheRepository[M, E]) Restore(ctx context.Context, id Key) error {
+	deleter, ok := cache.repos.(SoftDeleter[E])
+	if !ok {
+		return ErrSoftDeleteDisabled
+	}
+
+	if err := deleter.Restore(ctx, id); err != nil {
+		return err
+	}
+
+	cache.invalidate(ctx, id)
+	return nil
+}
+
+// ForceDelete 被装饰的 Repository 没有实现 SoftDeleter 时和 Delete 相同
+func (cache *CacheRepository[M, E]) ForceDelete(ctx context.Context, entity E) error {
+	deleter, ok := cache.repos.(SoftDeleter[E])
+	if !ok {
+		return cache.Delete(ctx, entity)
+	}
+
+	if err := deleter.ForceDelete(ctx, entity); err != nil {
+		return err
+	}
+
+	if id, ok := cache.entityID(entity); ok {
+		cache.deleteKey(ctx, cache.cacheKey(id))
+	}
+
+	return nil
+}
+
+// Invalidate 删除主键为 id 的缓存，实体在其他地方被修改时调用
+func (cache *CacheRepository[M, E]) Invalidate(ctx context.Context, id Key) error {
+	return cache.cache.Delete(ctx, cache.cacheKey(id.Value()))
+}
+
+func (cache *CacheRepository[M, E]) Stats() CacheStats {
+	return CacheStats{
+		Hits:   cache.hits.Load(),
+		Misses: cache.misses.Load(),
+	}
+}
+
+// invalidate 修改失败时也删除缓存，修改可能已经部分生效
+func (cache *CacheRepository[M, E]) invalidate(ctx context.Context, id Key) {
+	if !strings.EqualFold(id.Name(), "id") {
+		return
+	}
+
+	cache.deleteKey(ctx, cache.cacheKey(id.Value()))
+}
+
+// deleteKey ctx 中有 RunInTx 的事务时在提交之后删除缓存，
+// 否则提交之前其他请求可能把旧的数据重新写入缓存
+func (cache *CacheRepository[M, E]) deleteKey(ctx context.Context, key string) {
+	AfterCommit(ctx, func(ctx context.Context) {
+		if err := cache.cache.Delete(ctx, key); err != nil {
+			cache.warnf("delete cache %s failed: %s", key, err)
+		}
+	})
+}
+
+// fill 读取未命中后回填缓存，缓存实现了 CacheFiller 时使用 Fill
+func (cache *CacheRepository[M, E]) fill(ctx context.Context, key string, entity E, expiration time.Duration) error {
+	if filler, ok := cache.cache.(CacheFiller[E]); ok {
+		return filler.Fill(ctx, key, entity, expiration)
+	}
+
+	return cache.cache.Set(ctx, key, entity, expiration)
+}
+
+// warnf 缓存读写失败只记录日志，不影响对 Repository 的操作
+func (cache *CacheRepository[M, E]) warnf(template string, args ...interface{}) {
+	cache.logger.Sugar().Warnf(template, args...)
+}
+
+func (cache *CacheRepository[M, E]) expiration(expiration time.Duration) time.Duration {
+	if expiration > 0 {
+		return expiration
+	}
+
+	return cache.opt.Expiration
+}
+
+func (cache *CacheRepository[M, E]) cacheKey(id interface{}) string {
+	var m M
+
+	t := reflect.TypeOf(m)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	key := fmt.Sprintf("%s:%v", utils.SnakeCase(t.Name()), id)
+	if cache.opt.Namespace != "" {
+		key = cache.opt.Namespace + "$$" + key
+	}
+
+	return key
+}
+
+// entityID 返回实体对应模型的 ID 或 Id 字段
+func (cache *CacheRepository[M, E]) entityID(entity E) (interface{}, bool) {
+	var m M
+
+	v := reflect.ValueOf(m.FromEntity(entity))
+	for v.Kind() == reflect.Ptr {
+		v = reflect.Indirect(v)
+	}
+
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	for _, name := range []string{"ID", "Id"} {
+		if field := v.FieldByName(name); field.IsValid() && !field.IsZero() {
+			return field.Interface(), true
+		}
+	}
+
+	return nil, false
+}
+
+func cacheable(id Key, so *SearchOpt) bool {
+	return strings.EqualFold(id.Name(), "id") &&
+		len(so.Select) == 0 &&
+		len(so.Omit) == 0 &&
+		len(so.Relations) == 0 &&
+		len(so.DBScopes) == 0 &&
+		so.Trashed == TrashedExclude &&
+		so.Scope == nil
+}
+
+// flightGroup 合并同一个 key 上并发的读取
+type flightGroup[E any] struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall[E]
+}
+
+type flightCall[E any] struct {
+	wg     sync.WaitGroup
+	entity E
+	err    error
+}
+
+func (g *flightGroup[E]) Do(key string, fn func() (E, error)) (E, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall[E])
+	}
+
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		// 等待的调用方各自拿到一份拷贝，和 LRUCache 一样不共用实体
+		return cloneEntity(call.entity), call.err
+	}
+
+	call := &flightCall[E]{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.entity, call.err = fn()
+	call.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return call.entity, call.err
 }
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/platform/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type User struct {
+	ID   uint
+	Name string
+}
+
+type PUser struct {
+	ID   uint
+	Name string
+}
+
+func (u *User) ToEntity() *PUser {
+	return &PUser{ID: u.ID, Name: u.Name}
+}
+
+func (u *User) FromEntity(entity *PUser) interface{} {
+	return &User{ID: entity.ID, Name: entity.Name}
+}
+
+// memRepository 记录 Get 的调用次数
+type memRepository struct {
+	mu    sync.Mutex
+	users map[uint]PUser
+	gets  int
+}
+
+func (repos *memRepository) Insert(ctx context.Context, entity **PUser, opts ...PutOptFunc) error {
+	repos.mu.Lock()
+	defer repos.mu.Unlock()
+
+	if (*entity).ID == 0 {
+		(*entity).ID = uint(len(repos.users) + 1)
+	}
+	repos.users[(*entity).ID] = **entity
+	return nil
+}
+
+func (repos *memRepository) Get(ctx context.Context, id Key, opts ...SearchOptFunc) (*PUser, error) {
+	repos.mu.Lock()
+	defer repos.mu.Unlock()
+
+	repos.gets++
+	user, ok := repos.users[id.Value().(uint)]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (repos *memRepository) Find(ctx context.Context, opts ...SearchOptFunc) ([]*PUser, SearchMetadata, error) {
+	return nil, SearchMetadata{}, nil
+}
+
+func (repos *memRepository) Delete(ctx context.Context, entity *PUser) error {
+	repos.mu.Lock()
+	defer repos.mu.Unlock()
+
+	delete(repos.users, entity.ID)
+	return nil
+}
+
+func (repos *memRepository) Update(ctx context.Context, id Key, changes *PUser, opts ...PutOptFunc) (int64, error) {
+	repos.mu.Lock()
+	defer repos.mu.Unlock()
+
+	user, ok := repos.users[id.Value().(uint)]
+	if !ok {
+		return 0, domain.ErrNotFound
+	}
+
+	user.Name = changes.Name
+	repos.users[user.ID] = user
+	return 1, nil
+}
+
+func (repos *memRepository) Patch(ctx context.Context, id Key, patch []byte, opts ...PutOptFunc) (int64, error) {
+	return 0, domain.ErrNotFound
+}
+
+func (repos *memRepository) UpdateWhere(ctx context.Context, filters []FilterItem, changes *PUser, opts ...PutOptFunc) (int64, error) {
+	return 0, domain.ErrNotFound
+}
+
+func (repos *memRepository) getCount() int {
+	repos.mu.Lock()
+	defer repos.mu.Unlock()
+
+	return repos.gets
+}
+
+func TestCacheRepository(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		repos = &memRepository{users: make(map[uint]PUser)}
+		cache = NewCacheRepository[*User, *PUser](repos, &logger.Logger{}, 10)
+		user  = &PUser{Name: "bob"}
+	)
+
+	assert.NoError(t, cache.Insert(ctx, &user))
+	assert.Equal(t, uint(1), user.ID)
+
+	// 第一次读取未命中，之后从缓存读取
+	for i := 0; i < 3; i++ {
+		got, err := cache.Get(ctx, ID(1))
+		assert.NoError(t, err)
+		assert.Equal(t, "bob", got.Name)
+	}
+	assert.Equal(t, 1, repos.getCount())
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 1}, cache.Stats())
+
+	// SkipCache 读取 Repository 并刷新缓存
+	_, err := cache.Get(ctx, ID(1), OptWithoutCache())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, repos.getCount())
+
+	// Select 的查询不使用缓存
+	_, err = cache.Get(ctx, ID(1), OptGetSelect("name"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, repos.getCount())
+
+	// Insert 使缓存失效
+	user.Name = "alice"
+	assert.NoError(t, cache.Insert(ctx, &user))
+
+	_, err = cache.Peek(ctx, ID(1))
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	got, err := cache.Get(ctx, ID(1))
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", got.Name)
+
+	// Update 使缓存失效
+	rows, err := cache.Update(ctx, ID(1), &PUser{Name: "carol"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rows)
+
+	got, err = cache.Get(ctx, ID(1))
+	assert.NoError(t, err)
+	assert.Equal(t, "carol", got.Name)
+
+	assert.NoError(t, cache.Delete(ctx, got))
+	_, err = cache.Get(ctx, ID(1))
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
+
+func TestCacheRepositoryWriteThrough(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		repos = &memRepository{users: make(map[uint]PUser)}
+		cache = NewCacheRepository[*User, *PUser](repos, &logger.Logger{}, 10, OptWriteThrough(), OptSingleflight())
+		user  = &PUser{Name: "bob"}
+	)
+
+	assert.NoError(t, cache.Insert(ctx, &user, OptExpires(time.Minute)))
+
+	got, err := cache.Peek(ctx, ID(1))
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", got.Name)
+
+	got, err = cache.Get(ctx, ID(1))
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", got.Name)
+	assert.Equal(t, 0, repos.getCount())
+}
+
+func TestLRUCache(t *testing.T) {
+	var ctx = context.Background()
+
+	lru, err := NewLRUCache[int](2)
+	assert.NoError(t, err)
+
+	assert.NoError(t, lru.Set(ctx, "a", 1, 0))
+	assert.NoError(t, lru.Set(ctx, "b", 2, 0))
+
+	// 读取 a 之后 b 是最久没有使用的
+	_, ok, _ := lru.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.NoError(t, lru.Set(ctx, "c", 3, 0))
+
+	_, ok, _ = lru.Get(ctx, "b")
+	assert.False(t, ok)
+	assert.Equal(t, 2, lru.Len())
+
+	assert.NoError(t, lru.Set(ctx, "d", 4, time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+
+	_, ok, _ = lru.Get(ctx, "d")
+	assert.False(t, ok)
+}
+
+func TestLRUCacheCopiesPointers(t *testing.T) {
+	var ctx = context.Background()
+
+	lru, err := NewLRUCache[*PUser](2)
+	assert.NoError(t, err)
+
+	user := &PUser{ID: 1, Name: "Tom"}
+	assert.NoError(t, lru.Set(ctx, "user:1", user, 0))
+	user.Name = "Jerry"
+
+	// 修改写入或读出的实体都不影响缓存
+	cached, ok, err := lru.Get(ctx, "user:1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "Tom", cached.Name)
+
+	cached.Name = "Spike"
+	cached, _, _ = lru.Get(ctx, "user:1")
+	assert.Equal(t, "Tom", cached.Name)
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidCursor 游标不能解码，或者和当前的排序不匹配
+var ErrInvalidCursor = errors.New("repository: invalid cursor")
+
+// Cursor 游标分页的位置，保存一条记录在各个排序列上的值，
+// 对调用方是不透明的 base64 字符串
+type Cursor struct {
+	Fields []string          `json:"f"`
+	Values []json.RawMessage `json:"v"`
+}
+
+// EncodeCursor 把排序列 fields 和对应的值 values 编码为游标
+func EncodeCursor(fields []string, values []interface{}) (string, error) {
+	cursor := Cursor{Fields: fields, Values: make([]json.RawMessage, len(values))}
+	for i, val := range values {
+		b, err := json.Marshal(val)
+		if err != nil {
+			return "", err
+		}
+		cursor.Values[i] = b
+	}
+
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeCursor 解码 EncodeCursor 返回的游标，值由调用方按列的类型解析
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(b, &cursor); err != nil || len(cursor.Fields) != len(cursor.Values) {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
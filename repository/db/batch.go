@@ -5,10 +5,10 @@ import (
 	"reflect"
 
 	"github.com/akrennmair/slice"
+	"github.com/hnhuaxi/domain"
 	"github.com/hnhuaxi/domain/repository"
 	"github.com/hnhuaxi/platform/logger"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 type BatchRepository[M repository.Model[E], E any] interface {
@@ -32,7 +32,7 @@ func (batch *DBBatchRepository[M, E]) BatchInsert(ctx context.Context, entities
 	var (
 		models    = SlicePb2Go[M](*entities)
 		opts, err = batch.buildPutOpts(ops)
-		scope     = batch.getScope()
+		scope     = batch.getScope(ctx)
 	)
 	if err != nil {
 		return err
@@ -40,11 +40,7 @@ func (batch *DBBatchRepository[M, E]) BatchInsert(ctx context.Context, entities
 
 	scope = batch.applyOnConflict(scope, opts)
 
-	if opts.SkipAllAssociations {
-		scope = scope.Omit(clause.Associations)
-	} else if len(opts.SkipAssociations) > 0 {
-		scope = scope.Omit(opts.SkipAssociations...)
-	}
+	scope = batch.applyAssociations(scope, opts)
 
 	if len(opts.Select) > 1 {
 		first, rest := opts.Select[0], opts.Select[1:]
@@ -60,7 +56,7 @@ func (batch *DBBatchRepository[M, E]) BatchInsert(ctx context.Context, entities
 	if len(opts.ReturnKey) > 0 {
 		columns := []string{"ID", "CreatedAt", "UpdatedAt"}
 		columns = append(columns, opts.ReturnColumns...)
-		models, err = batch.returnColumns(models, opts.ReturnKey, columns)
+		models, err = batch.returnColumns(ctx, models, opts.ReturnKey, columns)
 		if err != nil {
 			return err
 		}
@@ -70,13 +66,13 @@ func (batch *DBBatchRepository[M, E]) BatchInsert(ctx context.Context, entities
 	return nil
 }
 
-func (batch *DBBatchRepository[M, E]) returnColumns(models []M, key string, columns []string) ([]M, error) {
+func (batch *DBBatchRepository[M, E]) returnColumns(ctx context.Context, models []M, key string, columns []string) ([]M, error) {
 	var (
 		savedModels []M
 		// log         = batch.logger.Sugar()
 	)
 
-	if err := batch.getScope().Clauses(batch.returnKeysExpr(models, key)).Find(&savedModels).Error; err != nil {
+	if err := batch.getScope(ctx).Clauses(batch.returnKeysExpr(models, key)).Find(&savedModels).Error; err != nil {
 		return nil, err
 	}
 
@@ -93,8 +89,89 @@ func (batch *DBBatchRepository[M, E]) returnColumns(models []M, key string, colu
 	return models, nil
 }
 
-func (batch *DBBatchRepository[M, E]) BatchUpdate(ctx context.Context, entities *[]E, updates []string) error {
-	panic("nonimplement")
+// BatchUpdate 在一个事务中逐条按主键修改，updates 为修改的字段，为空时修改非零值的字段。
+// 启用版本字段时任何一条的版本不同都会回滚，并返回 *repository.ErrConcurrentModification
+func (batch *DBBatchRepository[M, E]) BatchUpdate(ctx context.Context, entities *[]E, updates []string, ops ...repository.PutOptFunc) error {
+	var scope = batch.getScope(ctx)
+
+	opts, err := batch.buildPutOpts(ops)
+	if err != nil {
+		return err
+	}
+
+	if opts.Scope != nil {
+		scope = opts.Scope
+	}
+
+	sch, err := batch.getSchema()
+	if err != nil {
+		return err
+	}
+
+	pk := sch.PrioritizedPrimaryField
+	if pk == nil {
+		return domain.ErrCantPrimaryKey
+	}
+
+	vf, err := batch.versionField()
+	if err != nil {
+		return err
+	}
+
+	// 事务提交之后才把新的版本写回 entities
+	var updated = make([]E, len(*entities))
+	copy(updated, *entities)
+
+	if err := scope.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var txOpts = *opts
+		txOpts.Scope = tx
+
+		for i, entity := range *entities {
+			m := repository.FromEntity[M](entity)
+			v := reflect.ValueOf(m)
+
+			id, zero := pk.ValueOf(ctx, v)
+			if zero {
+				return domain.ErrCantPrimaryKey
+			}
+
+			columns, err := batch.updateColumns(ctx, m, updates)
+			if err != nil {
+				return err
+			}
+
+			version, err := batch.versionColumns(ctx, m, columns)
+			if err != nil {
+				return err
+			}
+
+			key := repository.FullID(pk.DBName, id)
+			if _, err := batch.updates(ctx, &txOpts, columns, key, version, func(scope Scope) (Scope, error) {
+				return scope.Where(batch.keyWhereString(key), id), nil
+			}); err != nil {
+				return err
+			}
+
+			if version != nil {
+				current, err := repository.VersionValue(version)
+				if err != nil {
+					return err
+				}
+
+				if err := vf.Set(ctx, v, current+1); err != nil {
+					return err
+				}
+				updated[i] = m.ToEntity()
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	*entities = updated
+	return nil
 }
 
 func (batch *DBBatchRepository[M, E]) BatchDelete(ctx context.Context, entities []E) error {
@@ -0,0 +1,266 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/hnhuaxi/domain/repository"
+	"github.com/hnhuaxi/domain/utils"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var errCursorCustomSort = errors.New("repository: cursor can't be used with custom sort")
+
+// keysetColumn 游标分页使用的一个排序列
+type keysetColumn struct {
+	field *schema.Field
+	desc  bool
+}
+
+// keysetColumns 返回 sorts 对应的列，最后加入主键保证顺序唯一，
+// 有自定义排序时不能使用游标，返回 nil
+func (r *DBRepository[M, E]) keysetColumns(sorts []repository.SortMode) ([]keysetColumn, error) {
+	sch, err := r.getSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]keysetColumn, 0, len(sorts)+1)
+	for _, sort := range sorts {
+		if _, ok := r.extendSorts[utils.CamelCase(sort.Field)]; ok {
+			return nil, nil
+		}
+
+		field := sch.LookUpField(sort.Field)
+		if field == nil || field.DBName == "" {
+			return nil, nil
+		}
+
+		columns = append(columns, keysetColumn{
+			field: field,
+			desc:  strings.EqualFold(string(sort.Direction), string(repository.OrderDesc)),
+		})
+	}
+
+	// 主键和最后一个排序的方向相同，可以使用 (a, b) > (?, ?) 的比较
+	var desc bool
+	if len(columns) > 0 {
+		desc = columns[len(columns)-1].desc
+	}
+
+	for _, pk := range sch.PrimaryFields {
+		if !slices.ContainsFunc(columns, func(col keysetColumn) bool { return col.field == pk }) {
+			columns = append(columns, keysetColumn{field: pk, desc: desc})
+		}
+	}
+
+	return columns, nil
+}
+
+// applySorts 排序阶段，有游标时只查询游标之后(BeforeCursor 时之前)的记录，
+// BeforeCursor 时反向排序，读取之后由 applyPage 反转。返回游标使用的列
+func (r *DBRepository[M, E]) applySorts(scope Scope, sorts []repository.SortMode, page repository.PageOption) (Scope, []keysetColumn, error) {
+	columns, err := r.keysetColumns(sorts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		cursor   = page.AfterCursor
+		backward = page.BeforeCursor != ""
+	)
+
+	if backward {
+		cursor = page.BeforeCursor
+	}
+
+	if columns == nil {
+		if cursor != "" {
+			return nil, nil, errCursorCustomSort
+		}
+
+		return Chain(sorts, scope, func(sort repository.SortMode, scope Scope) Scope {
+			name, _ := r.DBName(sort.Field)
+			if custom, ok := r.extendSorts[utils.CamelCase(sort.Field)]; ok {
+				return custom(scope, sort.Field, sort.Direction)
+			}
+			return scope.Order(fmt.Sprintf("%s %s", name, sort.Direction))
+		}), nil, nil
+	}
+
+	if cursor != "" {
+		values, err := decodeCursor(cursor, columns)
+		if err != nil {
+			return nil, nil, err
+		}
+		scope = scope.Where(keysetCondition(columns, values, backward))
+	}
+
+	for _, col := range columns {
+		scope = scope.Order(clause.OrderByColumn{
+			Column: clause.Column{Table: clause.CurrentTable, Name: col.field.DBName},
+			Desc:   col.desc != backward,
+		})
+	}
+
+	return scope, columns, nil
+}
+
+// keysetCondition 方向相同时使用行值比较 (a, b) > (?, ?)，可以利用联合索引，
+// 否则展开为 a > ? OR (a = ? AND b < ?)。两种写法和 NULL 比较的结果都是 NULL，
+// 排序列有 NULL 的记录不会出现在游标之后的页中，游标分页的排序列需要是 NOT NULL
+func keysetCondition(columns []keysetColumn, values []interface{}, backward bool) clause.Expression {
+	column := func(col keysetColumn) clause.Column {
+		return clause.Column{Table: clause.CurrentTable, Name: col.field.DBName}
+	}
+
+	uniform := !slices.ContainsFunc(columns, func(col keysetColumn) bool { return col.desc != columns[0].desc })
+	if uniform {
+		var (
+			op           = "<"
+			placeholders = strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+			vars         = make([]interface{}, 0, len(columns)*2)
+		)
+
+		if columns[0].desc == backward {
+			op = ">"
+		}
+
+		for _, col := range columns {
+			vars = append(vars, column(col))
+		}
+		vars = append(vars, values...)
+
+		return clause.Expr{SQL: fmt.Sprintf("(%s) %s (%s)", placeholders, op, placeholders), Vars: vars}
+	}
+
+	ors := make([]clause.Expression, 0, len(columns))
+	for i, col := range columns {
+		ands := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, clause.Eq{Column: column(columns[j]), Value: values[j]})
+		}
+
+		if col.desc == backward {
+			ands = append(ands, clause.Gt{Column: column(col), Value: values[i]})
+		} else {
+			ands = append(ands, clause.Lt{Column: column(col), Value: values[i]})
+		}
+
+		ors = append(ors, clause.And(ands...))
+	}
+
+	return clause.Or(ors...)
+}
+
+// keysetSelect 保证查询的字段包含游标使用的列，否则 encodeCursor 读到的是零值，
+// names 为空时查询全部字段不需要处理
+func keysetSelect(names []string, columns []keysetColumn) []string {
+	if len(names) == 0 || slices.Contains(names, "*") {
+		return names
+	}
+
+	for _, col := range columns {
+		if !slices.ContainsFunc(names, col.matches) {
+			names = append(names, col.field.DBName)
+		}
+	}
+
+	return names
+}
+
+// keysetOmit 从忽略的字段中去掉游标使用的列
+func keysetOmit(names []string, columns []keysetColumn) []string {
+	return slices.DeleteFunc(slices.Clone(names), func(name string) bool {
+		return slices.ContainsFunc(columns, func(col keysetColumn) bool { return col.matches(name) })
+	})
+}
+
+func (col keysetColumn) matches(name string) bool {
+	return strings.EqualFold(name, col.field.Name) || strings.EqualFold(name, col.field.DBName)
+}
+
+// decodeCursor 按列的类型解析游标中的值，游标的列和当前的排序不同时返回 repository.ErrInvalidCursor
+func decodeCursor(s string, columns []keysetColumn) ([]interface{}, error) {
+	cursor, err := repository.DecodeCursor(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cursor.Fields) != len(columns) {
+		return nil, repository.ErrInvalidCursor
+	}
+
+	values := make([]interface{}, len(columns))
+	for i, col := range columns {
+		if cursor.Fields[i] != col.field.DBName {
+			return nil, repository.ErrInvalidCursor
+		}
+
+		val := reflect.New(col.field.FieldType)
+		if err := json.Unmarshal(cursor.Values[i], val.Interface()); err != nil {
+			return nil, repository.ErrInvalidCursor
+		}
+		values[i] = val.Elem().Interface()
+	}
+
+	return values, nil
+}
+
+func encodeCursor(ctx context.Context, columns []keysetColumn, m interface{}) (string, error) {
+	var (
+		v      = reflect.ValueOf(m)
+		fields = make([]string, len(columns))
+		values = make([]interface{}, len(columns))
+	)
+
+	for i, col := range columns {
+		fields[i] = col.field.DBName
+		values[i], _ = col.field.ValueOf(ctx, v)
+	}
+
+	return repository.EncodeCursor(fields, values)
+}
+
+// pageLimit 多读取一条记录，用来判断是否还有更多记录
+func pageLimit(page repository.PageOption) int {
+	if page.PageSize > 0 {
+		return page.PageSize + 1
+	}
+
+	return page.PageSize
+}
+
+// applyPage 去掉 pageLimit 多读取的记录，BeforeCursor 时恢复排序的顺序，并生成前后页的游标
+func (r *DBRepository[M, E]) applyPage(ctx context.Context, metadata *repository.SearchMetadata, page repository.PageOption, columns []keysetColumn, models *[]M) error {
+	if page.PageSize > 0 && len(*models) > page.PageSize {
+		metadata.HasMore = true
+		*models = (*models)[:page.PageSize]
+	}
+
+	if columns == nil {
+		return nil
+	}
+
+	if page.BeforeCursor != "" {
+		slices.Reverse(*models)
+	}
+
+	if len(*models) == 0 {
+		return nil
+	}
+
+	var err error
+	if metadata.PrevCursor, err = encodeCursor(ctx, columns, (*models)[0]); err != nil {
+		return err
+	}
+
+	metadata.NextCursor, err = encodeCursor(ctx, columns, (*models)[len(*models)-1])
+	return err
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hnhuaxi/domain/repository"
+	"github.com/hnhuaxi/platform/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBRepositoryCursor(t *testing.T) {
+	var (
+		db  = testDB()
+		ctx = context.Background()
+	)
+	assert.NoError(t, db.AutoMigrate(&Post{}))
+
+	r := NewDBRepository[*Post, *PPost](db, &logger.Logger{}).AddSort("Title")
+	for _, title := range []string{"c", "a", "b", "c", "b", "c"} {
+		post := &PPost{Title: title}
+		assert.NoError(t, r.Insert(ctx, &post))
+	}
+
+	ids := func(posts []*PPost) (ids []uint) {
+		for _, post := range posts {
+			ids = append(ids, post.Id)
+		}
+		return
+	}
+
+	for _, tt := range []struct {
+		direction repository.OrderDirection
+		want      []uint
+	}{
+		{repository.OrderAsc, []uint{2, 3, 5, 1, 4, 6}},
+		{repository.OrderDesc, []uint{6, 4, 1, 5, 3, 2}},
+	} {
+		var (
+			got   []uint
+			pages []repository.SearchMetadata
+			opts  = []repository.SearchOptFunc{
+				repository.OptPageSize(4),
+				repository.OptSort(repository.SortMode{Field: "Title", Direction: tt.direction}),
+			}
+		)
+
+		// 按游标向后读取全部记录
+		posts, metadata, err := r.Find(ctx, opts...)
+		for assert.NoError(t, err) {
+			got = append(got, ids(posts)...)
+			pages = append(pages, metadata)
+			if !metadata.HasMore {
+				break
+			}
+			posts, metadata, err = r.Find(ctx, append(opts, repository.OptAfterCursor(metadata.NextCursor))...)
+		}
+
+		assert.Equal(t, tt.want, got)
+		assert.Len(t, pages, 2)
+
+		// 从最后一页向前读取，结果仍然按排序的顺序
+		posts, metadata, err = r.Find(ctx, append(opts, repository.OptBeforeCursor(pages[1].PrevCursor))...)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want[:4], ids(posts))
+		assert.False(t, metadata.HasMore)
+
+		posts, metadata, err = r.Find(ctx, append(opts, repository.OptBeforeCursor(pages[1].PrevCursor), repository.OptPageSize(2))...)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want[2:4], ids(posts))
+		assert.True(t, metadata.HasMore)
+	}
+
+	// Select 和 Omit 去掉了排序列时仍然查询它们，游标不会是零值
+	for _, opt := range []repository.SearchOptFunc{repository.OptGetSelect("id"), repository.OptGetOmit("title")} {
+		sort := repository.OptSort(repository.SortMode{Field: "Title", Direction: repository.OrderAsc})
+		posts, metadata, err := r.Find(ctx, repository.OptPageSize(4), sort, opt)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint{2, 3, 5, 1}, ids(posts))
+
+		posts, _, err = r.Find(ctx, repository.OptPageSize(4), sort, opt, repository.OptAfterCursor(metadata.NextCursor))
+		assert.NoError(t, err)
+		assert.Equal(t, []uint{4, 6}, ids(posts))
+	}
+
+	// 游标和当前的排序不匹配
+	_, metadata, err := r.Find(ctx, repository.OptPageSize(2))
+	assert.NoError(t, err)
+	_, _, err = r.Find(ctx, repository.OptPageSize(2), repository.OptSort(repository.SortMode{Field: "Title", Direction: repository.OrderAsc}), repository.OptAfterCursor(metadata.NextCursor))
+	assert.ErrorIs(t, err, repository.ErrInvalidCursor)
+}
+
+func TestDBRelationRepositoryCursor(t *testing.T) {
+	var (
+		db  = testDB()
+		ctx = context.Background()
+	)
+	assert.NoError(t, db.AutoMigrate(&User{}, &Account{}))
+
+	bob := &User{ID: 1, Name: "bob"}
+	for _, total := range []float64{3, 1, 2, 3, 2} {
+		bob.Accounts = append(bob.Accounts, Account{Total: total})
+	}
+	assert.NoError(t, db.Create(bob).Error)
+	assert.NoError(t, db.Create(&User{ID: 2, Name: "alice", Accounts: []Account{{Total: 1}}}).Error)
+
+	r := NewDBRelationRepository[*User, *PUser, *Account, *PAccount](db, &logger.Logger{}, "Accounts")
+	r.AddSort("Total")
+
+	ids := func(accounts []*PAccount) (ids []uint32) {
+		for _, account := range accounts {
+			ids = append(ids, account.Id)
+		}
+		return
+	}
+
+	// Select 和 Omit 去掉了排序列时仍然查询它们，游标不会是零值
+	for _, opt := range []repository.SearchOptFunc{repository.OptGetSelect("id"), repository.OptGetOmit("total")} {
+		var (
+			usr  = &PUser{Id: 1}
+			sort = repository.OptSort(repository.SortMode{Field: "Total", Direction: repository.OrderAsc})
+		)
+
+		accounts, metadata, err := r.Find(ctx, usr, repository.OptPageSize(3), sort, opt)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint32{2, 3, 5}, ids(accounts))
+		assert.True(t, metadata.HasMore)
+
+		next := repository.OptAfterCursor(metadata.NextCursor)
+		accounts, metadata, err = r.Find(ctx, usr, repository.OptPageSize(3), sort, opt, next)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint32{1, 4}, ids(accounts))
+		assert.False(t, metadata.HasMore)
+
+		accounts, _, err = r.FindMany(ctx, []*PUser{usr}, repository.OptPageSize(3), sort, opt, next)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint32{1, 4}, ids(accounts))
+	}
+}
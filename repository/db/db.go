@@ -46,6 +46,8 @@ type DBRepository[M repository.Model[E], E any] struct {
 	schema      *schema.Schema
 	inTrans     bool
 	namer       schema.Namer
+	version     string
+	softDelete  string
 }
 
 func NewDBRepository[M repository.Model[E], E any](db *gorm.DB, log *logger.Logger) *DBRepository[M, E] {
@@ -139,7 +141,7 @@ func (r *DBRepository[M, E]) keyWhereString(key repository.Key) string {
 
 func (r *DBRepository[M, E]) GetInto(ctx context.Context, entity *E, key repository.Key, opts ...repository.SearchOptFunc) error {
 	var (
-		scope = r.getScope()
+		scope = r.getScope(ctx)
 		g     M
 		m     = g.FromEntity(*entity)
 		opt   *repository.SearchOpt
@@ -157,6 +159,10 @@ func (r *DBRepository[M, E]) GetInto(ctx context.Context, entity *E, key reposit
 
 	scope = r.applySearchColumns(opt, scope)
 
+	if scope, err = r.applyTrashed(scope, opt.Trashed); err != nil {
+		return err
+	}
+
 	scope = r.applyRelations(scope, opt.Relations)
 	// 扩展 db scopes 处理
 	for _, dbScope := range opt.DBScopes {
@@ -188,6 +194,8 @@ func (r *DBRepository[M, E]) Clone() *DBRepository[M, E] {
 		sorts:       repository.CopyFrom(r.sorts),
 		extendSorts: repository.CopyFrom(r.extendSorts),
 		inTrans:     repository.CopyFrom(r.inTrans),
+		version:     r.version,
+		softDelete:  r.softDelete,
 	}
 }
 
@@ -198,16 +206,18 @@ func (r *DBRepository[M, E]) Begin() (*DBRepository[M, E], error) {
 	return clone, nil
 }
 
-func (r *DBRepository[M, E]) Commit() {
-	r.tx.Commit()
+func (r *DBRepository[M, E]) Commit() error {
+	err := r.tx.Commit().Error
 	r.inTrans = false
 	r.tx = nil
+	return err
 }
 
-func (r *DBRepository[M, E]) Rollback() {
-	r.tx.Rollback()
+func (r *DBRepository[M, E]) Rollback() error {
+	err := r.tx.Rollback().Error
 	r.inTrans = false
 	r.tx = nil
+	return err
 }
 
 func (r *DBRepository[M, E]) SetNamingStrategy(namer schema.Namer) *DBRepository[M, E] {
@@ -215,12 +225,28 @@ func (r *DBRepository[M, E]) SetNamingStrategy(namer schema.Namer) *DBRepository
 	return r
 }
 
-func (r *DBRepository[M, E]) getScope() *gorm.DB {
+// getScope Begin 之后使用自己的事务，否则使用 repository.RunInTx 保存在 ctx 中的事务
+func (r *DBRepository[M, E]) getScope(ctx context.Context) *gorm.DB {
 	if r.inTrans {
 		return r.tx
-	} else {
-		return r.db
 	}
+
+	if tx, ok := repository.TxFromContext(ctx); ok {
+		return tx
+	}
+
+	return r.db
+}
+
+// DB 返回当前使用的连接，Begin 之后是事务，
+// 可以传给 sql.Publisher.WithTx 让发布消息和写入在同一个事务中
+func (r *DBRepository[M, E]) DB() *gorm.DB {
+	return r.getScope(context.Background())
+}
+
+// DBContext 和 DB 相同，ctx 中有 repository.RunInTx 的事务时返回这个事务
+func (r *DBRepository[M, E]) DBContext(ctx context.Context) *gorm.DB {
+	return r.getScope(ctx)
 }
 
 func (r *DBRepository[M, E]) getSchema() (*schema.Schema, error) {
@@ -276,7 +302,7 @@ func (r *DBRepository[M, E]) DBName(name string) (string, error) {
 
 func (r *DBRepository[M, E]) Find(ctx context.Context, opts ...repository.SearchOptFunc) ([]E, repository.SearchMetadata, error) {
 	var (
-		scope    = r.getScope().WithContext(ctx)
+		scope    = r.getScope(ctx).WithContext(ctx)
 		models   = make([]M, 0, 100)
 		metadata repository.SearchMetadata
 	)
@@ -331,39 +357,19 @@ func (r *DBRepository[M, E]) Find(ctx context.Context, opts ...repository.Search
 		return nil, metadata, err
 	}
 
-	scope = scope.Limit(so.Page.PageSize)
-	if so.Page.Page > 0 && so.Page.PageSize > 0 {
+	scope = scope.Limit(pageLimit(so.Page))
+	if so.Page.Page > 0 && so.Page.PageSize > 0 && so.Page.AfterCursor == "" && so.Page.BeforeCursor == "" {
 		scope = scope.Offset((so.Page.Page - 1) * so.Page.PageSize)
 	}
 	metadata.Page = so.Page.Page
 	metadata.PageSize = so.Page.PageSize
 
 	// 载入过滤器阶段
-	if err := r.validFilters(so.Filters); err != nil {
+	if scope, err = r.applyFilters(scope, so.Filters); err != nil {
 		return nil, metadata, err
 	}
 
-	if scope, err = ChainErr(so.Filters, scope, func(filter repository.FilterItem, scope Scope) (Scope, error) {
-		id := utils.SnakeCase(filter.ID)
-		field, err := r.Field(id)
-		if err != nil {
-			return nil, err
-		}
-		typeop, ok := r.filterOps[field.Name]
-		if !ok {
-			return nil, fmt.Errorf("no register filter id %s", filter.ID)
-		}
-
-		if bindOp, ok := typeop.Oper.(ScopeWrap); ok {
-			filter.Type = typeop.Type
-			scope = bindOp.WithScope(scope, func() {
-				typeop.Oper.Op(field.DBName, filter.Val())
-			})
-		} else {
-			return nil, fmt.Errorf("invalid db op bind of %s", filter.ID)
-		}
-		return scope, nil
-	}); err != nil {
+	if scope, err = r.applyTrashed(scope, so.Trashed); err != nil {
 		return nil, metadata, err
 	}
 
@@ -373,13 +379,10 @@ func (r *DBRepository[M, E]) Find(ctx context.Context, opts ...repository.Search
 		return nil, metadata, err
 	}
 
-	scope = Chain(so.Sorts, scope, func(sort repository.SortMode, scope Scope) Scope {
-		name, _ := r.DBName(sort.Field)
-		if custom, ok := r.extendSorts[utils.CamelCase(sort.Field)]; ok {
-			return custom(scope, sort.Field, sort.Direction)
-		}
-		return scope.Order(fmt.Sprintf("%s %s", name, sort.Direction))
-	})
+	var keyset []keysetColumn
+	if scope, keyset, err = r.applySorts(scope, so.Sorts, so.Page); err != nil {
+		return nil, metadata, err
+	}
 
 	// 处理字段列表
 	fields := slice.Filter(so.Fields, func(fi repository.FieldItem) bool {
@@ -388,6 +391,12 @@ func (r *DBRepository[M, E]) Find(ctx context.Context, opts ...repository.Search
 	fieldNames := slice.Map(fields, func(fi repository.FieldItem) string {
 		return fi.Name
 	})
+
+	if keyset != nil {
+		fieldNames = keysetSelect(fieldNames, keyset)
+		so.Select = keysetSelect(so.Select, keyset)
+		so.Omit = keysetOmit(so.Omit, keyset)
+	}
 	scope = scope.Select(fieldNames)
 
 	scope = r.applySearchColumns(so, scope)
@@ -425,19 +434,13 @@ func (r *DBRepository[M, E]) Find(ctx context.Context, opts ...repository.Search
 		scope = dbScope(scope)
 	}
 
-	// 获取 total 数据
-	scope = r.applyTotal(ctx, scope)
-
-	if err := r.withDebug(ctx, scope, func(scope Scope) Scope {
-		return scope.Find(&models)
-	}); err != nil {
+	// 查询并获取 total 数据
+	if metadata.Total, err = r.findTotal(ctx, scope, so.Total, &models); err != nil {
 		return nil, metadata, err
 	}
 
-	if total, ok := GetScopeTotal(scope); ok {
-		if err := total.Total(&metadata.Total); err != nil {
-			return nil, metadata, err
-		}
+	if err := r.applyPage(ctx, &metadata, so.Page, keyset, &models); err != nil {
+		return nil, metadata, err
 	}
 
 	r.applyMetadata(&metadata, models)
@@ -459,7 +462,7 @@ func (r *DBRepository[M, E]) withDebug(ctx context.Context, scope Scope, fn func
 
 func (r *DBRepository[M, E]) Insert(ctx context.Context, entity *E, ops ...repository.PutOptFunc) error {
 	var (
-		scope = r.getScope()
+		scope = r.getScope(ctx)
 		g     M
 		m     = g.FromEntity(*entity)
 	)
@@ -476,6 +479,8 @@ func (r *DBRepository[M, E]) Insert(ctx context.Context, entity *E, ops ...repos
 
 	scope = r.applyUpdateColumns(scope, opts)
 
+	scope = r.applyAssociations(scope, opts)
+
 	if len(opts.LoadKeys) > 0 {
 		newScope := scope.Session(&gorm.Session{})
 		var attrs = make(map[string]interface{})
@@ -501,6 +506,15 @@ func (r *DBRepository[M, E]) Insert(ctx context.Context, entity *E, ops ...repos
 		scope = dbScope(scope)
 	}
 
+	vf, err := r.versionField()
+	if err != nil {
+		return err
+	}
+
+	if vf != nil {
+		return r.saveVersioned(ctx, scope, m, vf, opts)
+	}
+
 	return r.withDebug(ctx, scope, func(tx Scope) Scope {
 		if opts.ForceCreate {
 			return tx.Model(m).Create(m)
@@ -528,6 +542,54 @@ func (r *DBRepository[M, E]) applyOnConflict(scope Scope, opts *repository.PutOp
 	return scope
 }
 
+func (r *DBRepository[M, E]) applyAssociations(scope Scope, opts *repository.PutOption) Scope {
+	if opts.SkipAllAssociations {
+		return scope.Omit(clause.Associations)
+	}
+
+	if len(opts.SkipAssociations) > 0 {
+		return scope.Omit(opts.SkipAssociations...)
+	}
+
+	return scope
+}
+
+func (r *DBRepository[M, E]) applyFilters(scope Scope, filters []repository.FilterItem) (Scope, error) {
+	if err := r.validFilters(filters); err != nil {
+		return nil, err
+	}
+
+	return ChainErr(filters, scope, func(filter repository.FilterItem, scope Scope) (Scope, error) {
+		if filter.Expr != nil {
+			expr, err := r.filterExpression(scope, *filter.Expr)
+			if err != nil || expr == nil {
+				return scope, err
+			}
+			return scope.Where(expr), nil
+		}
+
+		id := utils.SnakeCase(filter.ID)
+		field, err := r.Field(id)
+		if err != nil {
+			return nil, err
+		}
+		typeop, ok := r.filterOps[field.Name]
+		if !ok {
+			return nil, fmt.Errorf("no register filter id %s", filter.ID)
+		}
+
+		if bindOp, ok := typeop.Oper.(ScopeWrap); ok {
+			filter.Type = typeop.Type
+			scope = bindOp.WithScope(scope, func() {
+				typeop.Oper.Op(field.DBName, filter.Val())
+			})
+		} else {
+			return nil, fmt.Errorf("invalid db op bind of %s", filter.ID)
+		}
+		return scope, nil
+	})
+}
+
 func (r *DBRepository[M, E]) applyRelations(scope Scope, relations []repository.RelationItem) Scope {
 	return Chain(relations, scope, func(item repository.RelationItem, scope Scope) Scope {
 		return scope.Preload(item.Association, item.Args...)
@@ -549,13 +611,6 @@ func (r *DBRepository[M, E]) applyUpdateColumns(scope Scope, opts *repository.Pu
 	return scope
 }
 
-func (r *DBRepository[M, E]) applyTotal(ctx context.Context, scope Scope) Scope {
-	var totals = &mysqlSelectTotals{tx: scope, Debug: IsDebug(ctx)}
-	scope = scope.WithContext(context.WithValue(scope.Statement.Context, selectTotalKey, totals))
-	return scope.Clauses(totals)
-	// return scope
-}
-
 func (r *DBRepository[M, E]) applySearchColumns(opts *repository.SearchOpt, scope Scope) Scope {
 	if len(opts.Select) > 0 {
 		if len(opts.Select) > 1 {
@@ -595,13 +650,18 @@ func (r *DBRepository[M, E]) getPrimaryValue(m any) (interface{}, error) {
 	return GetPrimaryValue(m)
 }
 
+// Delete 启用软删除时只标记删除，可以 Restore，ForceDelete 直接删除
 func (r *DBRepository[M, E]) Delete(ctx context.Context, entity E) error {
 	var (
-		scope = r.getScope()
+		scope = r.getScope(ctx)
 		g     M
 		m     = g.FromEntity(entity)
 	)
 
+	if ok, err := r.softDeleteModel(ctx, scope, m); ok || err != nil {
+		return err
+	}
+
 	return r.withDebug(ctx, scope, func(tx Scope) Scope {
 		return tx.Model(m).Delete(m)
 	})
@@ -798,23 +858,41 @@ func (r *DBRepository[M, E]) validFilters(filters []repository.FilterItem) error
 	var errs error
 
 	for _, filter := range filters {
-		if ok := r.extendsIds[utils.CamelCase(filter.ID)]; ok {
-			continue
-		}
-		id := utils.SnakeCase(filter.ID)
-		field, err := r.Field(id)
-		if err != nil {
-			errs = multierr.Append(errs, fmt.Errorf("invalid filter field %s because %w", filter.ID, err))
+		if filter.Expr != nil {
+			if err := filter.Expr.Validate(); err != nil {
+				errs = multierr.Append(errs, err)
+				continue
+			}
+
+			_ = filter.Expr.Walk(func(cond repository.FilterExpr) error {
+				errs = multierr.Append(errs, r.validFilter(cond.Field))
+				return nil
+			})
 			continue
 		}
 
-		if _, ok := r.filterOps[field.Name]; !ok {
-			errs = multierr.Append(errs, fmt.Errorf("no register filter ID %s", filter.ID))
-		}
+		errs = multierr.Append(errs, r.validFilter(filter.ID))
 	}
 	return errs
 }
 
+func (r *DBRepository[M, E]) validFilter(id string) error {
+	if ok := r.extendsIds[utils.CamelCase(id)]; ok {
+		return nil
+	}
+
+	field, err := r.Field(utils.SnakeCase(id))
+	if err != nil {
+		return fmt.Errorf("invalid filter field %s because %w", id, err)
+	}
+
+	if _, ok := r.filterOps[field.Name]; !ok {
+		return fmt.Errorf("no register filter ID %s", id)
+	}
+
+	return nil
+}
+
 func Chain[T any](list []T, scope Scope, fn func(e T, scope Scope) Scope) Scope {
 	for _, e := range list {
 		scope = fn(e, scope)
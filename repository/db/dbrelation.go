@@ -38,7 +38,7 @@ func NewDBRelationRepository[A repository.Model[E], E any, B repository.Model[T]
 
 func (r *DBRelationRepository[A, E, B, T]) Append(ctx context.Context, elem E, targets ...T) error {
 	var (
-		scope = r.getScope()
+		scope = r.getScope(ctx)
 		start A
 		m     = start.FromEntity(elem).(A)
 	)
@@ -52,7 +52,7 @@ func (r *DBRelationRepository[A, E, B, T]) Append(ctx context.Context, elem E, t
 
 func (r *DBRelationRepository[A, E, B, T]) Find(ctx context.Context, elem E, opts ...SearchOptFunc) ([]T, repository.SearchMetadata, error) {
 	var (
-		scope    = r.getScope()
+		scope    = r.getScope(ctx)
 		start    A
 		target   B
 		m        = start.FromEntity(elem).(A)
@@ -115,46 +115,15 @@ func (r *DBRelationRepository[A, E, B, T]) Find(ctx context.Context, elem E, opt
 		return nil, metadata, err
 	}
 
-	scope = scope.Limit(so.Page.PageSize)
-	if so.Page.Page > 0 {
+	scope = scope.Limit(pageLimit(so.Page))
+	if so.Page.Page > 0 && so.Page.AfterCursor == "" && so.Page.BeforeCursor == "" {
 		scope = scope.Offset((so.Page.Page - 1) * so.Page.PageSize)
 	}
 	metadata.Page = so.Page.Page
 	metadata.PageSize = so.Page.PageSize
 
 	// 载入过滤器阶段
-	if err := r.validFilters(so.Filters); err != nil {
-		return nil, metadata, err
-	}
-
-	if scope, err = ChainErr(so.Filters, scope, func(filter repository.FilterItem, scope Scope) (Scope, error) {
-		id := utils.SnakeCase(filter.ID)
-		field, err := r.Field(id)
-		if err != nil {
-			return nil, err
-		}
-		typeoper, ok := r.filterOps[field.Name]
-		if !ok {
-			return nil, fmt.Errorf("no register filter id %s", filter.ID)
-		}
-
-		// if bindOp, ok := op.(*BindOP); ok {
-		// 	scope = bindOp.WithScope(scope, func() {
-		// 		bindOp.Op(field.DBName, filter.Value)
-		// 	})
-		// } else {
-		// 	return nil, fmt.Errorf("invalid db op bind of %s", filter.ID)
-		// }
-		if bindOp, ok := typeoper.Oper.(ScopeWrap); ok {
-			filter.Type = typeoper.Type
-			scope = bindOp.WithScope(scope, func() {
-				typeoper.Oper.Op(field.DBName, filter.Val())
-			})
-		} else {
-			return nil, fmt.Errorf("invalid db op bind of %s", filter.ID)
-		}
-		return scope, nil
-	}); err != nil {
+	if scope, err = r.applyFilters(scope, so.Filters); err != nil {
 		return nil, metadata, err
 	}
 
@@ -164,10 +133,10 @@ func (r *DBRelationRepository[A, E, B, T]) Find(ctx context.Context, elem E, opt
 		return nil, metadata, err
 	}
 
-	scope = Chain(so.Sorts, scope, func(sort repository.SortMode, scope Scope) Scope {
-		name, _ := r.DBName(sort.Field)
-		return scope.Order(fmt.Sprintf("%s %s", name, sort.Direction))
-	})
+	var keyset []keysetColumn
+	if scope, keyset, err = r.applySorts(scope, so.Sorts, so.Page); err != nil {
+		return nil, metadata, err
+	}
 
 	// 处理字段列表
 	fields := slice.Filter(so.Fields, func(fi repository.FieldItem) bool {
@@ -176,11 +145,15 @@ func (r *DBRelationRepository[A, E, B, T]) Find(ctx context.Context, elem E, opt
 	fieldNames := slice.Map(fields, func(fi repository.FieldItem) string {
 		return fi.Name
 	})
-	scope = scope.Select(fieldNames)
 
-	if len(so.Select) > 0 {
-		scope = scope.Select(so.Select)
+	if keyset != nil {
+		fieldNames = keysetSelect(fieldNames, keyset)
+		so.Select = keysetSelect(so.Select, keyset)
+		so.Omit = keysetOmit(so.Omit, keyset)
 	}
+	scope = scope.Select(fieldNames)
+
+	scope = r.applySearchColumns(so, scope)
 
 	// 关联载入
 	if scope, err = ChainErr(so.Relations, scope, func(relation repository.RelationItem, scope Scope) (Scope, error) {
@@ -214,19 +187,13 @@ func (r *DBRelationRepository[A, E, B, T]) Find(ctx context.Context, elem E, opt
 		scope = dbScope(scope)
 	}
 
-	// 获取 total 数据
-	scope = r.applyTotal(ctx, scope)
-
-	if err := r.withDebug(ctx, scope, func(scope Scope) Scope {
-		return scope.Find(&models)
-	}); err != nil {
+	// 查询并获取 total 数据
+	if metadata.Total, err = r.findTotal(ctx, scope, so.Total, &models); err != nil {
 		return nil, metadata, err
 	}
 
-	if total, ok := GetScopeTotal(scope); ok {
-		if err := total.Total(&metadata.Total); err != nil {
-			return nil, metadata, err
-		}
+	if err := r.applyPage(ctx, &metadata, so.Page, keyset, &models); err != nil {
+		return nil, metadata, err
 	}
 
 	r.applyMetadata(&metadata, models)
@@ -237,7 +204,7 @@ func (r *DBRelationRepository[A, E, B, T]) Find(ctx context.Context, elem E, opt
 // FindMany find many
 func (r *DBRelationRepository[A, E, B, T]) FindMany(ctx context.Context, elems []E, opts ...SearchOptFunc) ([]T, repository.SearchMetadata, error) {
 	var (
-		scope = r.getScope()
+		scope = r.getScope(ctx)
 		// start    A
 		target B
 		// m        = start.FromEntity(elems[0]).(A)
@@ -305,46 +272,15 @@ func (r *DBRelationRepository[A, E, B, T]) FindMany(ctx context.Context, elems [
 		return nil, metadata, err
 	}
 
-	scope = scope.Limit(so.Page.PageSize)
-	if so.Page.Page > 0 {
+	scope = scope.Limit(pageLimit(so.Page))
+	if so.Page.Page > 0 && so.Page.AfterCursor == "" && so.Page.BeforeCursor == "" {
 		scope = scope.Offset((so.Page.Page - 1) * so.Page.PageSize)
 	}
 	metadata.Page = so.Page.Page
 	metadata.PageSize = so.Page.PageSize
 
 	// 载入过滤器阶段
-	if err := r.validFilters(so.Filters); err != nil {
-		return nil, metadata, err
-	}
-
-	if scope, err = ChainErr(so.Filters, scope, func(filter repository.FilterItem, scope Scope) (Scope, error) {
-		id := utils.SnakeCase(filter.ID)
-		field, err := r.Field(id)
-		if err != nil {
-			return nil, err
-		}
-		typeoper, ok := r.filterOps[field.Name]
-		if !ok {
-			return nil, fmt.Errorf("no register filter id %s", filter.ID)
-		}
-
-		// if bindOp, ok := op.(*BindOP); ok {
-		// 	scope = bindOp.WithScope(scope, func() {
-		// 		bindOp.Op(field.DBName, filter.Value)
-		// 	})
-		// } else {
-		// 	return nil, fmt.Errorf("invalid db op bind of %s", filter.ID)
-		// }
-		if bindOp, ok := typeoper.Oper.(ScopeWrap); ok {
-			filter.Type = typeoper.Type
-			scope = bindOp.WithScope(scope, func() {
-				typeoper.Oper.Op(field.DBName, filter.Val())
-			})
-		} else {
-			return nil, fmt.Errorf("invalid db op bind of %s", filter.ID)
-		}
-		return scope, nil
-	}); err != nil {
+	if scope, err = r.applyFilters(scope, so.Filters); err != nil {
 		return nil, metadata, err
 	}
 
@@ -354,10 +290,10 @@ func (r *DBRelationRepository[A, E, B, T]) FindMany(ctx context.Context, elems [
 		return nil, metadata, err
 	}
 
-	scope = Chain(so.Sorts, scope, func(sort repository.SortMode, scope Scope) Scope {
-		name, _ := r.DBName(sort.Field)
-		return scope.Order(fmt.Sprintf("%s %s", name, sort.Direction))
-	})
+	var keyset []keysetColumn
+	if scope, keyset, err = r.applySorts(scope, so.Sorts, so.Page); err != nil {
+		return nil, metadata, err
+	}
 
 	// 处理字段列表
 	fields := slice.Filter(so.Fields, func(fi repository.FieldItem) bool {
@@ -366,11 +302,15 @@ func (r *DBRelationRepository[A, E, B, T]) FindMany(ctx context.Context, elems [
 	fieldNames := slice.Map(fields, func(fi repository.FieldItem) string {
 		return fi.Name
 	})
-	scope = scope.Select(fieldNames)
 
-	if len(so.Select) > 0 {
-		scope = scope.Select(so.Select)
+	if keyset != nil {
+		fieldNames = keysetSelect(fieldNames, keyset)
+		so.Select = keysetSelect(so.Select, keyset)
+		so.Omit = keysetOmit(so.Omit, keyset)
 	}
+	scope = scope.Select(fieldNames)
+
+	scope = r.applySearchColumns(so, scope)
 
 	// 关联载入
 	if scope, err = ChainErr(so.Relations, scope, func(relation repository.RelationItem, scope Scope) (Scope, error) {
@@ -404,19 +344,13 @@ func (r *DBRelationRepository[A, E, B, T]) FindMany(ctx context.Context, elems [
 		scope = dbScope(scope)
 	}
 
-	// 获取 total 数据
-	scope = r.applyTotal(ctx, scope)
-
-	if err := r.withDebug(ctx, scope, func(scope Scope) Scope {
-		return scope.Find(&models)
-	}); err != nil {
+	// 查询并获取 total 数据
+	if metadata.Total, err = r.findTotal(ctx, scope, so.Total, &models); err != nil {
 		return nil, metadata, err
 	}
 
-	if total, ok := GetScopeTotal(scope); ok {
-		if err := total.Total(&metadata.Total); err != nil {
-			return nil, metadata, err
-		}
+	if err := r.applyPage(ctx, &metadata, so.Page, keyset, &models); err != nil {
+		return nil, metadata, err
 	}
 
 	r.applyMetadata(&metadata, models)
@@ -426,7 +360,7 @@ func (r *DBRelationRepository[A, E, B, T]) FindMany(ctx context.Context, elems [
 
 func (r *DBRelationRepository[A, E, B, T]) Replace(ctx context.Context, elem E, targets ...T) error {
 	var (
-		scope = r.getScope()
+		scope = r.getScope(ctx)
 		start A
 		m     = start.FromEntity(elem).(A)
 	)
@@ -441,7 +375,7 @@ func (r *DBRelationRepository[A, E, B, T]) Replace(ctx context.Context, elem E,
 
 func (r *DBRelationRepository[A, E, B, T]) Delete(ctx context.Context, elem E, targets ...T) error {
 	var (
-		scope = r.getScope()
+		scope = r.getScope(ctx)
 		start A
 		m     = start.FromEntity(elem).(A)
 	)
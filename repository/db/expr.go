@@ -0,0 +1,154 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hnhuaxi/domain/repository"
+	"github.com/hnhuaxi/domain/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// filterExpression 把过滤表达式编译为 gorm 的条件，字段必须用 AddFilter 或者 AddCustomFilter 注册过，
+// 比较方式由表达式指定，注册的类型用于转换值。没有条件时返回 nil
+func (r *DBRepository[M, E]) filterExpression(scope Scope, expr repository.FilterExpr) (clause.Expression, error) {
+	if err := expr.Validate(); err != nil {
+		return nil, err
+	}
+
+	return r.compileExpr(scope, expr)
+}
+
+func (r *DBRepository[M, E]) compileExpr(scope Scope, expr repository.FilterExpr) (clause.Expression, error) {
+	switch {
+	case expr.Field != "":
+		return r.condExpression(scope, expr)
+	case expr.Not != nil:
+		e, err := r.compileExpr(scope, *expr.Not)
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			// 总是成立的条件取反之后总是不成立
+			return clause.Expr{SQL: "1 = 0"}, nil
+		}
+		return clause.Not(e), nil
+	}
+
+	var (
+		children = expr.And
+		exprs    []clause.Expression
+		always   bool
+	)
+
+	if len(expr.Or) > 0 {
+		children = expr.Or
+	}
+
+	for _, child := range children {
+		e, err := r.compileExpr(scope, child)
+		if err != nil {
+			return nil, err
+		}
+
+		if e == nil {
+			always = true
+			continue
+		}
+		exprs = append(exprs, e)
+	}
+
+	switch {
+	case len(expr.And) > 0:
+		return clause.And(exprs...), nil
+	case always:
+		// OR 中有一个没有条件的分支时总是成立
+		return nil, nil
+	case len(exprs) == 1:
+		// gorm 把只有一个条件的 OrConditions 当作 OR 连接上一个条件
+		return exprs[0], nil
+	default:
+		return clause.Or(exprs...), nil
+	}
+}
+
+func (r *DBRepository[M, E]) condExpression(scope Scope, cond repository.FilterExpr) (clause.Expression, error) {
+	field, err := r.Field(utils.SnakeCase(cond.Field))
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter field %s because %w", cond.Field, err)
+	}
+
+	typeop, ok := r.filterOps[field.Name]
+	if !ok {
+		return nil, fmt.Errorf("no register filter id %s", cond.Field)
+	}
+
+	value := func(val interface{}) interface{} {
+		item := repository.FilterItem{Value: val, Type: typeop.Type}
+		return item.Val()
+	}
+
+	// 自定义过滤器只能用 eq，只取它加入的 Where 条件
+	if custom, ok := typeop.Oper.(*CustomOP); ok {
+		if cond.Operator() != repository.OpEq {
+			return nil, fmt.Errorf("custom filter %s only supports %s", cond.Field, repository.OpEq)
+		}
+
+		tx := custom.do(scope.Session(&gorm.Session{NewDB: true}), field.DBName, cond.Value)
+		where, _ := tx.Statement.Clauses["WHERE"].Expression.(clause.Where)
+		return clause.And(where.Exprs...), nil
+	}
+
+	column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+
+	switch cond.Operator() {
+	case repository.OpNe:
+		return clause.Neq{Column: column, Value: value(cond.Value)}, nil
+	case repository.OpGt:
+		return clause.Gt{Column: column, Value: value(cond.Value)}, nil
+	case repository.OpGe:
+		return clause.Gte{Column: column, Value: value(cond.Value)}, nil
+	case repository.OpLt:
+		return clause.Lt{Column: column, Value: value(cond.Value)}, nil
+	case repository.OpLe:
+		return clause.Lte{Column: column, Value: value(cond.Value)}, nil
+	case repository.OpBetween:
+		values, _ := cond.Values()
+		return clause.Expr{SQL: "? BETWEEN ? AND ?", Vars: []interface{}{column, value(values[0]), value(values[1])}}, nil
+	case repository.OpIn, repository.OpNotIn:
+		values, _ := cond.Values()
+		for i, val := range values {
+			values[i] = value(val)
+		}
+
+		if cond.Operator() == repository.OpIn {
+			return clause.IN{Column: column, Values: values}, nil
+		}
+
+		if len(values) == 0 {
+			return nil, nil
+		}
+		return clause.Not(clause.IN{Column: column, Values: values}), nil
+	case repository.OpLike:
+		return clause.Like{Column: column, Value: value(cond.Value)}, nil
+	case repository.OpPrefix:
+		return likeExpression(column, likeEscaper.Replace(fmt.Sprint(cond.Value))+"%"), nil
+	case repository.OpContains:
+		return likeExpression(column, "%"+likeEscaper.Replace(fmt.Sprint(cond.Value))+"%"), nil
+	case repository.OpIsNull:
+		if isNull, ok := cond.Value.(bool); ok && !isNull {
+			return clause.Neq{Column: column, Value: nil}, nil
+		}
+		return clause.Eq{Column: column, Value: nil}, nil
+	default:
+		return clause.Eq{Column: column, Value: value(cond.Value)}, nil
+	}
+}
+
+// likeExpression 使用 ! 转义，反斜杠在 MySQL 和 Postgres 的字符串中含义不同
+func likeExpression(column clause.Column, pattern string) clause.Expression {
+	return clause.Expr{SQL: "? LIKE ? ESCAPE '!'", Vars: []interface{}{column, pattern}}
+}
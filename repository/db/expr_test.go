@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hnhuaxi/domain/repository"
+	"github.com/hnhuaxi/platform/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBRepositoryFindWhere(t *testing.T) {
+	var (
+		db  = testDB()
+		ctx = context.Background()
+	)
+	assert.NoError(t, db.AutoMigrate(&Post{}))
+
+	r := NewDBRepository[*Post, *PPost](db, &logger.Logger{}).
+		AddFilter("ID", EQ).
+		AddFilter("Title", EQ).
+		AddCustomFilter("Keyword", func(scope Scope, key, value interface{}) Scope {
+			return scope.Where("title LIKE ?", fmt.Sprintf("%%%s%%", value))
+		})
+
+	for _, title := range []string{"hello", "world", "50% off", "500 off"} {
+		post := &PPost{Title: title}
+		assert.NoError(t, r.Insert(ctx, &post))
+	}
+
+	find := func(expr repository.FilterExpr) []uint {
+		posts, _, err := r.Find(ctx, repository.OptWhere(expr))
+		assert.NoError(t, err)
+
+		var ids []uint
+		for _, post := range posts {
+			ids = append(ids, post.Id)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []uint{1, 4}, find(repository.Or(
+		repository.Cond("Title", repository.OpEq, "hello"),
+		repository.Cond("ID", repository.OpGt, 3),
+	)))
+	assert.Equal(t, []uint{2, 3}, find(repository.And(
+		repository.Cond("ID", repository.OpBetween, []int{2, 4}),
+		repository.Not(repository.Cond("Title", repository.OpIn, []string{"500 off"})),
+	)))
+	assert.Equal(t, []uint{3}, find(repository.Cond("Title", repository.OpContains, "0%")))
+	assert.Equal(t, []uint{3, 4}, find(repository.Cond("Title", repository.OpPrefix, "50")))
+	assert.Equal(t, []uint{1, 2}, find(repository.Or(
+		repository.Cond("Keyword", repository.OpEq, "ell"),
+		repository.Cond("Title", repository.OpLike, "w%"),
+	)))
+
+	// 空的 not_in 总是成立，取反之后总是不成立
+	assert.Empty(t, find(repository.Not(repository.Cond("ID", repository.OpNotIn, []int{}))))
+	assert.Equal(t, []uint{1}, find(repository.Or(
+		repository.Not(repository.Cond("ID", repository.OpNotIn, []int{})),
+		repository.Cond("Title", repository.OpEq, "hello"),
+	)))
+
+	// 没有注册的字段
+	_, _, err := r.Find(ctx, repository.OptWhere(repository.Cond("DeletedAt", repository.OpIsNull, true)))
+	assert.Error(t, err)
+
+	// 结构不正确的表达式
+	_, _, err = r.Find(ctx, repository.OptWhere(repository.FilterExpr{Field: "ID", Or: []repository.FilterExpr{{Field: "ID"}}}))
+	assert.ErrorIs(t, err, repository.ErrInvalidFilter)
+}
@@ -1,52 +1,207 @@
 package db
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"log"
+	"reflect"
+	"strconv"
 
 	"github.com/hnhuaxi/domain/repository"
-	"github.com/hysios/log"
+	"golang.org/x/exp/slices"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
-var selectTotalKey = struct{}{}
+// windowTotalColumn TotalWindow 时 COUNT(*) OVER() 的列名
+const windowTotalColumn = "__total"
 
-type mysqlSelectTotals struct {
-	tx    *gorm.DB
-	Debug bool
+// findTotal 执行 scope 的查询，并按 mode 计算不分页时的总数
+func (r *DBRepository[M, E]) findTotal(ctx context.Context, scope Scope, mode repository.TotalMode, models *[]M) (int, error) {
+	// 在查询之前复制，Find 会修改 scope 的 Statement
+	countTx := r.countScope(scope)
+
+	if mode == repository.TotalWindow && windowable(scope) {
+		return r.findWindow(ctx, scope, countTx, models)
+	}
+
+	if err := r.withDebug(ctx, scope, func(scope Scope) Scope {
+		return scope.Find(models)
+	}); err != nil {
+		return 0, err
+	}
+
+	switch mode {
+	case repository.TotalSkip:
+		return 0, nil
+	case repository.TotalEstimate:
+		return r.estimateTotal(ctx, countTx)
+	default:
+		return r.countTotal(ctx, countTx)
+	}
 }
 
-func (*mysqlSelectTotals) ModifyStatement(stmt *gorm.Statement) {
-	selectClause := stmt.Clauses["SELECT"]
-	if selectClause.AfterExpression != nil {
-		stmt.Selects = append([]string{"SQL_CALC_FOUND_ROWS *,"}, stmt.Selects...)
-	} else {
-		stmt.Selects = append([]string{"SQL_CALC_FOUND_ROWS *"}, stmt.Selects...)
-	}
-	// selectClause := stmt.Clauses["SELECT"]
-	// if selectClause.AfterExpression == nil {
-	// 	selectClause.AfterExpression = clause.Select{
-	// 		Distinct: false,
-	// 		Columns: []clause.Column{
-	// 			{
-	// 				Name: "SQL_CALC_FOUND_ROWS *",
-	// 				Raw:  true,
-	// 			},
-	// 		},
-	// 		Expression: nil,
-	// 	}
-	// 	stmt.Clauses["SELECT"] = selectClause
-	// }
+// countScope 复制 scope 并去掉分页、Preload 和字段列表，只保留过滤条件
+func (r *DBRepository[M, E]) countScope(scope Scope) Scope {
+	tx := scope.Session(&gorm.Session{}).Limit(-1).Offset(-1)
+	tx.Statement.Preloads = map[string][]interface{}{}
+	tx.Statement.Selects = nil
+	tx.Statement.Omits = nil
+
+	if tx.Statement.Model == nil {
+		tx.Statement.Model = repository.FromEntity[M](r.instantE())
+	}
+
+	return tx
 }
 
-func (*mysqlSelectTotals) Build(builder clause.Builder) {
-	log.Infof("builder %v", builder)
+func (r *DBRepository[M, E]) countTotal(ctx context.Context, tx Scope) (int, error) {
+	var total int64
+	if err := r.withDebug(ctx, tx, func(tx Scope) Scope {
+		return tx.Count(&total)
+	}); err != nil {
+		return 0, err
+	}
+
+	return int(total), nil
 }
 
-func (totals *mysqlSelectTotals) Total(val any) error {
-	return DebugSQL(totals.Debug, totals.tx, func(scope repository.Scope) repository.Scope {
-		return totals.tx.Raw("SELECT FOUND_ROWS()").Scan(val)
+// estimateTotal 使用 EXPLAIN 估计的行数，Postgres 和 MySQL 以外的数据库使用 COUNT(*)
+func (r *DBRepository[M, E]) estimateTotal(ctx context.Context, tx Scope) (int, error) {
+	var (
+		dialect = tx.Dialector.Name()
+		models  []M
+	)
+
+	if dialect != "postgres" && dialect != "mysql" {
+		return r.countTotal(ctx, tx)
+	}
+
+	query := tx.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return tx.Find(&models)
 	})
+
+	if IsDebug(ctx) {
+		log.Printf("DEBUG SQL: EXPLAIN %s", query)
+		return 0, nil
+	}
+
+	conn := tx.Session(&gorm.Session{NewDB: true})
+
+	if dialect == "postgres" {
+		var plan string
+		if err := conn.Raw("EXPLAIN (FORMAT JSON) " + query).Row().Scan(&plan); err != nil {
+			return 0, err
+		}
+
+		var plans []struct {
+			Plan struct {
+				Rows float64 `json:"Plan Rows"`
+			}
+		}
+		if err := json.Unmarshal([]byte(plan), &plans); err != nil {
+			return 0, err
+		}
+
+		if len(plans) == 0 {
+			return r.countTotal(ctx, tx)
+		}
+		return int(plans[0].Plan.Rows), nil
+	}
+
+	// MySQL 使用第一个表扫描的行数乘以过滤的比例
+	var rows []map[string]interface{}
+	if err := conn.Raw("EXPLAIN " + query).Scan(&rows).Error; err != nil {
+		return 0, err
+	}
+
+	if len(rows) == 0 {
+		return r.countTotal(ctx, tx)
+	}
+
+	estimate, err := strconv.ParseFloat(fmt.Sprint(rows[0]["rows"]), 64)
+	if err != nil {
+		return r.countTotal(ctx, tx)
+	}
+
+	if filtered, err := strconv.ParseFloat(fmt.Sprint(rows[0]["filtered"]), 64); err == nil {
+		estimate = estimate * filtered / 100
+	}
+
+	return int(estimate), nil
+}
+
+// windowable 只有单表查询才能把结果从 map 转换为模型
+func windowable(scope Scope) bool {
+	_, grouped := scope.Statement.Clauses["GROUP BY"]
+	return !grouped && !scope.Statement.Distinct && len(scope.Statement.Preloads) == 0 && len(scope.Statement.Joins) == 0
+}
+
+// findWindow 使用 COUNT(*) OVER() 在同一次查询中得到总数，
+// 结果为空并且有 Offset 时不能得到总数，使用 COUNT(*)
+func (r *DBRepository[M, E]) findWindow(ctx context.Context, scope Scope, countTx Scope, models *[]M) (int, error) {
+	sch, err := r.getSchema()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		columns = slices.Clone(scope.Statement.Selects)
+		rows    []map[string]interface{}
+		total   int
+	)
+
+	if len(columns) == 0 {
+		for _, field := range sch.Fields {
+			if field.DBName == "" || !field.Readable ||
+				slices.Contains(scope.Statement.Omits, field.Name) || slices.Contains(scope.Statement.Omits, field.DBName) {
+				continue
+			}
+			columns = append(columns, field.DBName)
+		}
+	}
+
+	tx := scope.Model(repository.FromEntity[M](r.instantE())).
+		Select(append(columns, fmt.Sprintf("COUNT(*) OVER() AS %s", windowTotalColumn)))
+
+	if err := r.withDebug(ctx, tx, func(tx Scope) Scope {
+		return tx.Find(&rows)
+	}); err != nil {
+		return 0, err
+	}
+
+	if len(rows) == 0 {
+		if limit, ok := tx.Statement.Clauses["LIMIT"].Expression.(clause.Limit); ok && limit.Offset > 0 && !IsDebug(ctx) {
+			return r.countTotal(ctx, countTx)
+		}
+		return 0, nil
+	}
+
+	for _, row := range rows {
+		var (
+			m = repository.FromEntity[M](r.instantE())
+			v = reflect.ValueOf(m)
+		)
+
+		for _, field := range sch.Fields {
+			if val, ok := row[field.DBName]; ok && field.DBName != "" {
+				if err := field.Set(ctx, v, val); err != nil {
+					return 0, err
+				}
+			}
+		}
+
+		n, err := strconv.Atoi(fmt.Sprint(row[windowTotalColumn]))
+		if err != nil {
+			return 0, err
+		}
+		total = n
+
+		*models = append(*models, m)
+	}
+
+	return total, nil
 }
 
 func DebugSQL(debug bool, scope repository.Scope, fn func(scope repository.Scope) repository.Scope) error {
@@ -64,15 +219,3 @@ func DebugSQL(debug bool, scope repository.Scope, fn func(scope repository.Scope
 
 	return scope.Error
 }
-
-type GetTotal interface {
-	Total(any) error
-}
-
-func GetScopeTotal(scope repository.Scope) (GetTotal, bool) {
-	if totals, ok := scope.Statement.Context.Value(selectTotalKey).(GetTotal); ok {
-		return totals, ok
-	}
-
-	return nil, false
-}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hnhuaxi/domain/repository"
+	"github.com/hnhuaxi/platform/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBRepositoryFindTotal(t *testing.T) {
+	var (
+		db  = testDB()
+		ctx = context.Background()
+	)
+	assert.NoError(t, db.AutoMigrate(&Post{}))
+
+	r := NewDBRepository[*Post, *PPost](db, &logger.Logger{})
+	for i := 0; i < 5; i++ {
+		post := &PPost{Title: fmt.Sprintf("post %d", i)}
+		assert.NoError(t, r.Insert(ctx, &post))
+	}
+
+	post, _ := r.Get(ctx, repository.ID(5))
+	assert.NoError(t, r.Delete(ctx, post))
+
+	for _, mode := range []repository.TotalMode{repository.TotalCount, repository.TotalWindow, repository.TotalEstimate} {
+		posts, metadata, err := r.Find(ctx, repository.OptPageSize(2), repository.OptPage(2), repository.OptTotal(mode))
+		assert.NoError(t, err)
+		assert.Len(t, posts, 2)
+		assert.Equal(t, 4, metadata.Total)
+		assert.Equal(t, "post 2", posts[0].Title)
+
+		// 超过最后一页时也能得到总数
+		posts, metadata, err = r.Find(ctx, repository.OptPageSize(2), repository.OptPage(10), repository.OptTotal(mode))
+		assert.NoError(t, err)
+		assert.Len(t, posts, 0)
+		assert.Equal(t, 4, metadata.Total)
+	}
+
+	posts, metadata, err := r.Find(ctx, repository.OptPageSize(2), repository.OptSkipTotal())
+	assert.NoError(t, err)
+	assert.Len(t, posts, 2)
+	assert.Equal(t, 0, metadata.Total)
+}
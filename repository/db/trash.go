@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// SetSoftDeleteField 使用 name 列软删除，列必须可以为 NULL，Delete 时写入删除时间。
+// 模型有 gorm.DeletedAt 字段时不需要设置，直接使用 gorm 的软删除
+func (r *DBRepository[M, E]) SetSoftDeleteField(name string) *DBRepository[M, E] {
+	r.softDelete = name
+	return r
+}
+
+// softDeleteField 返回软删除的字段，native 表示是 gorm.DeletedAt，由 gorm 处理查询条件
+func (r *DBRepository[M, E]) softDeleteField() (field *schema.Field, native bool, err error) {
+	sch, err := r.getSchema()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if r.softDelete != "" {
+		if field = sch.LookUpField(r.softDelete); field == nil {
+			return nil, false, fmt.Errorf("invalid soft delete field %s", r.softDelete)
+		}
+		return field, field.FieldType == deletedAtType, nil
+	}
+
+	for _, field := range sch.Fields {
+		if field.FieldType == deletedAtType {
+			return field, true, nil
+		}
+	}
+
+	return nil, false, nil
+}
+
+func (r *DBRepository[M, E]) applyTrashed(scope Scope, mode repository.TrashedMode) (Scope, error) {
+	field, native, err := r.softDeleteField()
+	if err != nil {
+		return nil, err
+	}
+
+	if field == nil {
+		if mode == repository.TrashedOnly {
+			return nil, repository.ErrSoftDeleteDisabled
+		}
+		return scope, nil
+	}
+
+	column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+
+	switch mode {
+	case repository.TrashedWith:
+		if native {
+			scope = scope.Unscoped()
+		}
+	case repository.TrashedOnly:
+		if native {
+			scope = scope.Unscoped()
+		}
+		scope = scope.Where(clause.Neq{Column: column, Value: nil})
+	default:
+		if !native {
+			scope = scope.Where(clause.Eq{Column: column, Value: nil})
+		}
+	}
+
+	return scope, nil
+}
+
+// softDeleteModel 使用 SetSoftDeleteField 设置的列时写入删除时间，返回 false 时由 gorm 处理
+func (r *DBRepository[M, E]) softDeleteModel(ctx context.Context, scope Scope, m interface{}) (bool, error) {
+	field, native, err := r.softDeleteField()
+	if err != nil || field == nil || native {
+		return false, err
+	}
+
+	sch, err := r.getSchema()
+	if err != nil {
+		return false, err
+	}
+
+	pk := sch.PrioritizedPrimaryField
+	if pk == nil {
+		return false, domain.ErrCantPrimaryKey
+	}
+
+	id, zero := pk.ValueOf(ctx, reflect.ValueOf(m))
+	if zero {
+		return false, domain.ErrCantPrimaryKey
+	}
+
+	return true, r.withDebug(ctx, scope, func(tx Scope) Scope {
+		return tx.Model(repository.FromEntity[M](r.instantE())).
+			Where(fmt.Sprintf("%s = ?", pk.DBName), id).
+			Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: nil}).
+			Update(field.DBName, time.Now())
+	})
+}
+
+// Restore 恢复主键为 id 的已删除记录，没有已删除的记录时返回 domain.ErrNotFound
+func (r *DBRepository[M, E]) Restore(ctx context.Context, id repository.Key) error {
+	field, _, err := r.softDeleteField()
+	if err != nil {
+		return err
+	}
+
+	if field == nil {
+		return repository.ErrSoftDeleteDisabled
+	}
+
+	var rows int64
+	if err := r.withDebug(ctx, r.getScope(ctx).WithContext(ctx), func(tx Scope) Scope {
+		tx = tx.Unscoped().
+			Model(repository.FromEntity[M](r.instantE())).
+			Where(r.keyWhereString(id), id.Value()).
+			Where(clause.Neq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: nil}).
+			Update(field.DBName, nil)
+		rows = tx.RowsAffected
+		return tx
+	}); err != nil {
+		return err
+	}
+
+	if rows == 0 && !IsDebug(ctx) {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+// ForceDelete 直接删除记录，不论是否启用软删除
+func (r *DBRepository[M, E]) ForceDelete(ctx context.Context, entity E) error {
+	var (
+		scope = r.getScope(ctx)
+		g     M
+		m     = g.FromEntity(entity)
+	)
+
+	return r.withDebug(ctx, scope, func(tx Scope) Scope {
+		return tx.Unscoped().Model(m).Delete(m)
+	})
+}
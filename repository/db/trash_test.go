@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/repository"
+	"github.com/hnhuaxi/platform/logger"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type Post struct {
+	ID        uint `gorm:"primaryKey"`
+	Title     string
+	DeletedAt gorm.DeletedAt
+}
+
+type PPost struct {
+	Id    uint
+	Title string
+}
+
+func (p *Post) ToEntity() *PPost {
+	return &PPost{Id: p.ID, Title: p.Title}
+}
+
+func (p *Post) FromEntity(entity *PPost) interface{} {
+	return &Post{ID: entity.Id, Title: entity.Title}
+}
+
+type Comment struct {
+	ID        uint `gorm:"primaryKey"`
+	Body      string
+	RemovedAt *time.Time
+}
+
+type PComment struct {
+	Id   uint
+	Body string
+}
+
+func (c *Comment) ToEntity() *PComment {
+	return &PComment{Id: c.ID, Body: c.Body}
+}
+
+func (c *Comment) FromEntity(entity *PComment) interface{} {
+	return &Comment{ID: entity.Id, Body: entity.Body}
+}
+
+func TestDBRepositorySoftDelete(t *testing.T) {
+	var (
+		db  = testDB()
+		ctx = context.Background()
+	)
+	assert.NoError(t, db.AutoMigrate(&Post{}))
+
+	r := NewDBRepository[*Post, *PPost](db, &logger.Logger{})
+	for _, title := range []string{"a", "b"} {
+		post := &PPost{Title: title}
+		assert.NoError(t, r.Insert(ctx, &post))
+	}
+
+	post, _ := r.Get(ctx, repository.ID(1))
+	assert.NoError(t, r.Delete(ctx, post))
+
+	_, err := r.Get(ctx, repository.ID(1))
+	assert.True(t, domain.CheckNotFound(err))
+
+	_, err = r.Get(ctx, repository.ID(1), repository.OptWithTrashed())
+	assert.NoError(t, err)
+
+	_, err = r.Get(ctx, repository.ID(1), repository.OptOnlyTrashed())
+	assert.NoError(t, err)
+
+	_, err = r.Get(ctx, repository.ID(2), repository.OptOnlyTrashed())
+	assert.True(t, domain.CheckNotFound(err))
+
+	assert.NoError(t, r.Restore(ctx, repository.ID(1)))
+	assert.ErrorIs(t, r.Restore(ctx, repository.ID(1)), domain.ErrNotFound)
+
+	_, err = r.Get(ctx, repository.ID(1))
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.ForceDelete(ctx, post))
+	_, err = r.Get(ctx, repository.ID(1), repository.OptWithTrashed())
+	assert.True(t, domain.CheckNotFound(err))
+}
+
+func TestDBRepositorySoftDeleteField(t *testing.T) {
+	var (
+		db  = testDB()
+		ctx = context.Background()
+	)
+	assert.NoError(t, db.AutoMigrate(&Comment{}))
+
+	r := NewDBRepository[*Comment, *PComment](db, &logger.Logger{}).SetSoftDeleteField("RemovedAt")
+	comment := &PComment{Body: "hello"}
+	assert.NoError(t, r.Insert(ctx, &comment))
+
+	assert.NoError(t, r.Delete(ctx, comment))
+
+	_, err := r.Get(ctx, repository.ID(comment.Id))
+	assert.True(t, domain.CheckNotFound(err))
+
+	// 已删除的记录不能修改
+	_, err = r.Update(ctx, repository.ID(comment.Id), &PComment{Body: "world"})
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	// 软删除的条件不能代替 filters，没有 filters 时不修改全部记录
+	_, err = r.UpdateWhere(ctx, nil, &PComment{Body: "world"})
+	assert.ErrorIs(t, err, repository.ErrMissingFilter)
+
+	_, err = r.Get(ctx, repository.ID(comment.Id), repository.OptOnlyTrashed())
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.Restore(ctx, repository.ID(comment.Id)))
+	got, err := r.Get(ctx, repository.ID(comment.Id))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", got.Body)
+
+	// 没有软删除的模型不能只查询已删除的记录
+	items := NewDBRepository[*Item, *PItem](db, &logger.Logger{})
+	_, err = items.Get(ctx, repository.ID(1), repository.OptOnlyTrashed())
+	assert.ErrorIs(t, err, repository.ErrSoftDeleteDisabled)
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/repository"
+	"github.com/hnhuaxi/platform/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunInTx(t *testing.T) {
+	var (
+		db  = testDB()
+		ctx = context.Background()
+	)
+	assert.NoError(t, db.AutoMigrate(&Post{}, &Comment{}))
+
+	posts := NewDBRepository[*Post, *PPost](db, &logger.Logger{})
+	comments := NewDBRepository[*Comment, *PComment](db, &logger.Logger{})
+
+	var committed bool
+	err := repository.RunInTx(ctx, db, func(ctx context.Context) error {
+		repository.AfterCommit(ctx, func(ctx context.Context) { committed = true })
+
+		post := &PPost{Id: 1, Title: "hello"}
+		if err := posts.Insert(ctx, &post); err != nil {
+			return err
+		}
+		comment := &PComment{Id: 1, Body: "world"}
+		return comments.Insert(ctx, &comment)
+	})
+	assert.NoError(t, err)
+	assert.True(t, committed)
+
+	_, err = posts.Get(ctx, repository.ID(1))
+	assert.NoError(t, err)
+	_, err = comments.Get(ctx, repository.ID(1))
+	assert.NoError(t, err)
+
+	// fn 返回错误时两个 Repository 的写入都回滚，hook 不执行
+	committed = false
+	errFailed := errors.New("failed")
+	err = repository.RunInTx(ctx, db, func(ctx context.Context) error {
+		repository.AfterCommit(ctx, func(ctx context.Context) { committed = true })
+
+		post := &PPost{Id: 2, Title: "hello"}
+		if err := posts.Insert(ctx, &post); err != nil {
+			return err
+		}
+		comment := &PComment{Id: 2, Body: "world"}
+		if err := comments.Insert(ctx, &comment); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+	assert.False(t, committed)
+
+	_, err = posts.Get(ctx, repository.ID(2))
+	assert.True(t, domain.CheckNotFound(err))
+	_, err = comments.Get(ctx, repository.ID(2))
+	assert.True(t, domain.CheckNotFound(err))
+}
+
+func TestRunInTxSavePoint(t *testing.T) {
+	var (
+		db  = testDB()
+		ctx = context.Background()
+	)
+	assert.NoError(t, db.AutoMigrate(&Post{}))
+
+	posts := NewDBRepository[*Post, *PPost](db, &logger.Logger{})
+
+	var hooks []string
+	err := repository.RunInTx(ctx, db, func(ctx context.Context) error {
+		post := &PPost{Id: 1, Title: "outer"}
+		if err := posts.Insert(ctx, &post); err != nil {
+			return err
+		}
+
+		// 内层失败只回滚到 savepoint
+		err := repository.RunInTx(ctx, db, func(ctx context.Context) error {
+			repository.AfterCommit(ctx, func(ctx context.Context) { hooks = append(hooks, "failed") })
+			post := &PPost{Id: 2, Title: "inner"}
+			if err := posts.Insert(ctx, &post); err != nil {
+				return err
+			}
+			return errors.New("failed")
+		})
+		assert.Error(t, err)
+
+		return repository.RunInTx(ctx, db, func(ctx context.Context) error {
+			repository.AfterCommit(ctx, func(ctx context.Context) { hooks = append(hooks, "inner") })
+			post := &PPost{Id: 3, Title: "inner"}
+			return posts.Insert(ctx, &post)
+		})
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"inner"}, hooks)
+
+	_, err = posts.Get(ctx, repository.ID(1))
+	assert.NoError(t, err)
+	_, err = posts.Get(ctx, repository.ID(2))
+	assert.True(t, domain.CheckNotFound(err))
+	_, err = posts.Get(ctx, repository.ID(3))
+	assert.NoError(t, err)
+}
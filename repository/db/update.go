@@ -0,0 +1,275 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+func (r *DBRepository[M, E]) Update(ctx context.Context, id repository.Key, changes E, ops ...repository.PutOptFunc) (int64, error) {
+	var g M
+
+	opts, err := r.buildPutOpts(ops)
+	if err != nil {
+		return 0, err
+	}
+
+	m := g.FromEntity(changes)
+	columns, err := r.updateColumns(ctx, m, opts.Mask)
+	if err != nil {
+		return 0, err
+	}
+
+	version, err := r.versionColumns(ctx, m, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.updates(ctx, opts, columns, id, version, func(scope Scope) (Scope, error) {
+		return scope.Where(r.keyWhereString(id), id.Value()), nil
+	})
+}
+
+// Patch 先读取记录，合并 patch 之后只修改 patch 中出现的字段，
+// 读取和修改不是原子的，需要时在 Begin 之后的事务中调用
+func (r *DBRepository[M, E]) Patch(ctx context.Context, id repository.Key, patch []byte, ops ...repository.PutOptFunc) (int64, error) {
+	opts, err := r.buildPutOpts(ops)
+	if err != nil {
+		return 0, err
+	}
+
+	keys, err := repository.PatchKeys(patch)
+	if err != nil {
+		return 0, err
+	}
+
+	mask := make([]string, 0, len(keys))
+	for _, key := range keys {
+		field, err := r.jsonField(key)
+		if err != nil {
+			return 0, err
+		}
+		mask = append(mask, field.Name)
+	}
+
+	current, err := r.Get(ctx, id)
+	if err != nil {
+		if domain.CheckNotFound(err) {
+			return 0, domain.ErrNotFound
+		}
+		return 0, err
+	}
+
+	doc, err := json.Marshal(repository.FromEntity[M](current))
+	if err != nil {
+		return 0, err
+	}
+
+	if doc, err = repository.MergePatch(doc, patch); err != nil {
+		return 0, err
+	}
+
+	var m = repository.FromEntity[M](r.instantE())
+	if err := json.Unmarshal(doc, m); err != nil {
+		return 0, err
+	}
+
+	columns, err := r.updateColumns(ctx, m, mask)
+	if err != nil {
+		return 0, err
+	}
+
+	// patch 中有版本时使用它，否则使用读取时的版本
+	version, err := r.versionColumns(ctx, m, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.updates(ctx, opts, columns, id, version, func(scope Scope) (Scope, error) {
+		return scope.Where(r.keyWhereString(id), id.Value()), nil
+	})
+}
+
+// UpdateWhere 使用 AddFilter 注册的过滤器，没有 filters 时返回 repository.ErrMissingFilter，
+// 启用软删除时条件中总有软删除字段，不能依靠 gorm 拒绝没有条件的修改
+func (r *DBRepository[M, E]) UpdateWhere(ctx context.Context, filters []repository.FilterItem, changes E, ops ...repository.PutOptFunc) (int64, error) {
+	var g M
+
+	if len(filters) == 0 {
+		return 0, repository.ErrMissingFilter
+	}
+
+	opts, err := r.buildPutOpts(ops)
+	if err != nil {
+		return 0, err
+	}
+
+	columns, err := r.updateColumns(ctx, g.FromEntity(changes), opts.Mask)
+	if err != nil {
+		return 0, err
+	}
+
+	// 批量修改只把版本加一，不检查版本
+	if _, err := r.versionColumns(ctx, nil, columns); err != nil {
+		return 0, err
+	}
+
+	return r.updates(ctx, opts, columns, nil, nil, func(scope Scope) (Scope, error) {
+		return r.applyFilters(scope, filters)
+	})
+}
+
+// updates 修改 where 匹配的记录，version 不为 nil 时只修改版本相同的记录。
+// 没有修改任何记录时检查 where 是否匹配，不匹配时返回 domain.ErrNotFound，
+// 匹配但版本不同时返回 *repository.ErrConcurrentModification，
+// 匹配但值没有变化(例如 MySQL 默认只计算改变的行)时返回 0
+func (r *DBRepository[M, E]) updates(ctx context.Context, opts *repository.PutOption, columns map[string]interface{}, id repository.Key, version interface{}, where func(scope Scope) (Scope, error)) (int64, error) {
+	var (
+		scope = r.getScope(ctx).WithContext(ctx)
+		model = repository.FromEntity[M](r.instantE())
+		rows  int64
+	)
+
+	if opts.Scope != nil {
+		scope = opts.Scope
+	}
+
+	// 扩展 db scopes 处理
+	for _, dbScope := range opts.DBScopes {
+		scope = dbScope(scope)
+	}
+
+	if len(columns) == 0 {
+		return 0, domain.ErrNoChanges
+	}
+
+	// 已经软删除的记录不能修改
+	scope, err := r.applyTrashed(scope, repository.TrashedExclude)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := where(scope.Session(&gorm.Session{}).Model(model))
+	if err != nil {
+		return 0, err
+	}
+
+	vf, err := r.versionField()
+	if err != nil {
+		return 0, err
+	}
+
+	if version != nil {
+		tx = tx.Where(fmt.Sprintf("%s = ?", vf.DBName), version)
+	}
+
+	if err := r.withDebug(ctx, tx, func(tx Scope) Scope {
+		tx = tx.Updates(columns)
+		rows = tx.RowsAffected
+		return tx
+	}); err != nil {
+		return 0, err
+	}
+
+	if rows > 0 || IsDebug(ctx) {
+		return rows, nil
+	}
+
+	tx, err = where(scope.Session(&gorm.Session{}).Model(model))
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	if err := tx.Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	if count == 0 {
+		return 0, domain.ErrNotFound
+	}
+
+	if version != nil {
+		sch, _ := r.getSchema()
+		return 0, &repository.ErrConcurrentModification{Model: sch.Name, Key: id.Value(), Version: version}
+	}
+
+	return 0, nil
+}
+
+// updateColumns 返回 m 中要修改的列，mask 为空时取非零值的字段，主键不会被修改
+func (r *DBRepository[M, E]) updateColumns(ctx context.Context, m interface{}, mask []string) (map[string]interface{}, error) {
+	var (
+		v       = reflect.ValueOf(m)
+		columns = make(map[string]interface{})
+	)
+
+	sch, err := r.getSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(mask) > 0 {
+		for _, name := range mask {
+			field := sch.LookUpField(name)
+			if field == nil {
+				return nil, fmt.Errorf("invalid mask field %s", name)
+			}
+
+			if !updatable(field) {
+				return nil, fmt.Errorf("mask field %s can't be updated", name)
+			}
+
+			columns[field.DBName], _ = field.ValueOf(ctx, v)
+		}
+
+		return columns, nil
+	}
+
+	for _, field := range sch.Fields {
+		if !updatable(field) || field.AutoCreateTime > 0 {
+			continue
+		}
+
+		if val, zero := field.ValueOf(ctx, v); !zero {
+			columns[field.DBName] = val
+		}
+	}
+
+	return columns, nil
+}
+
+// jsonField 返回 JSON 序列化时名为 key 的字段
+func (r *DBRepository[M, E]) jsonField(key string) (*schema.Field, error) {
+	sch, err := r.getSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range sch.Fields {
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+
+		if name == key {
+			if !updatable(field) {
+				return nil, fmt.Errorf("patch field %s can't be updated", key)
+			}
+			return field, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid patch field %s", key)
+}
+
+func updatable(field *schema.Field) bool {
+	return field.DBName != "" && field.Updatable && !field.PrimaryKey
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/repository"
+	"github.com/hnhuaxi/platform/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type Item struct {
+	ID    uint   `gorm:"primaryKey"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	Note  string `json:"note"`
+}
+
+type PItem struct {
+	Id    uint
+	Name  string
+	Count int32
+	Note  string
+}
+
+func (item *Item) ToEntity() *PItem {
+	return &PItem{Id: item.ID, Name: item.Name, Count: int32(item.Count), Note: item.Note}
+}
+
+func (item *Item) FromEntity(entity *PItem) interface{} {
+	return &Item{ID: entity.Id, Name: entity.Name, Count: int(entity.Count), Note: entity.Note}
+}
+
+func testItems(t *testing.T) *DBRepository[*Item, *PItem] {
+	var (
+		db  = testDB()
+		ctx = context.Background()
+	)
+	assert.NoError(t, db.AutoMigrate(&Item{}))
+
+	r := NewDBRepository[*Item, *PItem](db, &logger.Logger{})
+	r.AddFilter("Name", EQ)
+
+	for _, name := range []string{"a", "b", "b"} {
+		item := &PItem{Name: name, Count: 1, Note: "note"}
+		assert.NoError(t, r.Insert(ctx, &item, OptCreate()))
+	}
+
+	return r
+}
+
+func TestDBRepositoryUpdate(t *testing.T) {
+	var (
+		ctx = context.Background()
+		r   = testItems(t)
+	)
+
+	// 零值字段不修改
+	rows, err := r.Update(ctx, repository.ID(1), &PItem{Name: "c"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rows)
+
+	item, err := r.Get(ctx, repository.ID(1))
+	assert.NoError(t, err)
+	assert.Equal(t, &PItem{Id: 1, Name: "c", Count: 1, Note: "note"}, item)
+
+	// mask 指定的字段修改为零值
+	_, err = r.Update(ctx, repository.ID(1), &PItem{Name: "d"}, repository.OptMask("Count", "note"))
+	assert.NoError(t, err)
+
+	item, _ = r.Get(ctx, repository.ID(1))
+	assert.Equal(t, &PItem{Id: 1, Name: "c", Count: 0, Note: ""}, item)
+
+	_, err = r.Update(ctx, repository.ID(10), &PItem{Name: "c"})
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	_, err = r.Update(ctx, repository.ID(1), &PItem{})
+	assert.ErrorIs(t, err, domain.ErrNoChanges)
+
+	_, err = r.Update(ctx, repository.ID(1), &PItem{Name: "c"}, repository.OptMask("Missing"))
+	assert.Error(t, err)
+}
+
+func TestDBRepositoryPatch(t *testing.T) {
+	var (
+		ctx = context.Background()
+		r   = testItems(t)
+	)
+
+	rows, err := r.Patch(ctx, repository.ID(2), []byte(`{"count": 0, "note": null}`))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rows)
+
+	item, _ := r.Get(ctx, repository.ID(2))
+	assert.Equal(t, &PItem{Id: 2, Name: "b", Count: 0, Note: ""}, item)
+
+	_, err = r.Patch(ctx, repository.ID(10), []byte(`{"count": 2}`))
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	_, err = r.Patch(ctx, repository.ID(2), []byte(`{"missing": 2}`))
+	assert.Error(t, err)
+
+	_, err = r.Patch(ctx, repository.ID(2), []byte(`[1]`))
+	assert.ErrorIs(t, err, repository.ErrInvalidPatch)
+}
+
+func TestDBRepositoryUpdateWhere(t *testing.T) {
+	var (
+		ctx = context.Background()
+		r   = testItems(t)
+	)
+
+	rows, err := r.UpdateWhere(ctx, []repository.FilterItem{{ID: "Name", Value: "b"}}, &PItem{Count: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), rows)
+
+	item, _ := r.Get(ctx, repository.ID(3))
+	assert.Equal(t, int32(5), item.Count)
+
+	_, err = r.UpdateWhere(ctx, []repository.FilterItem{{ID: "Name", Value: "z"}}, &PItem{Count: 5})
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	_, err = r.UpdateWhere(ctx, nil, &PItem{Count: 5})
+	assert.ErrorIs(t, err, repository.ErrMissingFilter)
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/akrennmair/slice"
+	"github.com/hnhuaxi/domain/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// SetVersionField 启用乐观锁，name 为版本字段，也可以在模型上使用 `gorm:"version"` tag 启用。
+// 启用之后 Insert、Update、Patch 和 BatchUpdate 只修改版本相同的记录，并把版本加一，
+// 版本不同时返回 *repository.ErrConcurrentModification。
+// Update 和 BatchUpdate 的 changes 中版本为零值时不检查版本，只把版本加一，需要检查时 changes 要带上读取到的版本
+func (r *DBRepository[M, E]) SetVersionField(name string) *DBRepository[M, E] {
+	r.version = name
+	return r
+}
+
+func (r *DBRepository[M, E]) versionField() (*schema.Field, error) {
+	sch, err := r.getSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	vf := repository.VersionField(sch, r.version)
+	if vf == nil && r.version != "" {
+		return nil, fmt.Errorf("invalid version field %s", r.version)
+	}
+
+	return vf, nil
+}
+
+// saveVersioned 代替 Save，主键为零值时创建版本为 1 的记录，
+// 否则只修改版本相同的记录，记录不存在时和 Save 一样创建，
+// scope 上已经应用了 Insert 的选项，OptSelect 时只修改选择的字段和版本
+func (r *DBRepository[M, E]) saveVersioned(ctx context.Context, scope Scope, m interface{}, vf *schema.Field, opts *PutOption) error {
+	var v = reflect.ValueOf(m)
+
+	sch, err := r.getSchema()
+	if err != nil {
+		return err
+	}
+
+	pk := sch.PrioritizedPrimaryField
+	if pk == nil {
+		return fmt.Errorf("model %s must have primary key to use version", sch.Name)
+	}
+
+	id, zero := pk.ValueOf(ctx, v)
+	if zero || opts.ForceCreate {
+		if _, zero := vf.ValueOf(ctx, v); zero {
+			if err := vf.Set(ctx, v, 1); err != nil {
+				return err
+			}
+		}
+
+		return r.withDebug(ctx, scope, func(tx Scope) Scope {
+			return tx.Model(m).Create(m)
+		})
+	}
+
+	version, _ := vf.ValueOf(ctx, v)
+	current, err := repository.VersionValue(version)
+	if err != nil {
+		return err
+	}
+
+	if err := vf.Set(ctx, v, current+1); err != nil {
+		return err
+	}
+
+	// 和 Save 一样修改全部字段，包括零值
+	var columns = []interface{}{"*"}
+	if len(opts.Select) > 0 {
+		columns = append(slice.Map(opts.Select, func(s string) interface{} { return s }), vf.DBName)
+	}
+
+	var rows int64
+	err = r.withDebug(ctx, scope, func(tx Scope) Scope {
+		tx = tx.Model(m).Where(fmt.Sprintf("%s = ?", vf.DBName), current).Select(columns[0], columns[1:]...).Updates(m)
+		rows = tx.RowsAffected
+		return tx
+	})
+
+	if err == nil && (rows > 0 || IsDebug(ctx)) {
+		return nil
+	}
+
+	// 没有修改时恢复实体的版本
+	vf.Set(ctx, v, current)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	if err := scope.Session(&gorm.Session{}).
+		Model(repository.FromEntity[M](r.instantE())).
+		Where(fmt.Sprintf("%s = ?", pk.DBName), id).
+		Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return &repository.ErrConcurrentModification{Model: sch.Name, Key: id, Version: version}
+	}
+
+	return r.withDebug(ctx, scope, func(tx Scope) Scope {
+		return tx.Model(m).Create(m)
+	})
+}
+
+// versionColumns 把版本字段改为加一，changes 中版本不为零值时返回它，修改时要求版本相同
+func (r *DBRepository[M, E]) versionColumns(ctx context.Context, m interface{}, columns map[string]interface{}) (interface{}, error) {
+	vf, err := r.versionField()
+	if err != nil || vf == nil {
+		return nil, err
+	}
+
+	delete(columns, vf.DBName)
+	if len(columns) > 0 {
+		columns[vf.DBName] = gorm.Expr(fmt.Sprintf("%s + 1", vf.DBName))
+	}
+
+	if m == nil {
+		return nil, nil
+	}
+
+	if version, zero := vf.ValueOf(ctx, reflect.ValueOf(m)); !zero {
+		return version, nil
+	}
+
+	return nil, nil
+}
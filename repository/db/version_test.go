@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hnhuaxi/domain/repository"
+	"github.com/hnhuaxi/platform/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type Account2 struct {
+	ID      uint `gorm:"primaryKey"`
+	Balance int
+	Version int `gorm:"version"`
+}
+
+type PAccount2 struct {
+	Id      uint
+	Balance int32
+	Version int32
+}
+
+func (a *Account2) ToEntity() *PAccount2 {
+	return &PAccount2{Id: a.ID, Balance: int32(a.Balance), Version: int32(a.Version)}
+}
+
+func (a *Account2) FromEntity(entity *PAccount2) interface{} {
+	return &Account2{ID: entity.Id, Balance: int(entity.Balance), Version: int(entity.Version)}
+}
+
+func TestDBRepositoryVersion(t *testing.T) {
+	var (
+		db  = testDB()
+		ctx = context.Background()
+	)
+	assert.NoError(t, db.AutoMigrate(&Account2{}))
+
+	r := NewDBRepository[*Account2, *PAccount2](db, &logger.Logger{})
+
+	account := &PAccount2{Balance: 100}
+	assert.NoError(t, r.Insert(ctx, &account))
+	assert.Equal(t, int32(1), account.Version)
+
+	// 两个处理器读取了同一个版本
+	first, _ := r.Get(ctx, repository.ID(account.Id))
+	second, _ := r.Get(ctx, repository.ID(account.Id))
+
+	first.Balance = 50
+	assert.NoError(t, r.Insert(ctx, &first))
+	assert.Equal(t, int32(2), first.Version)
+
+	second.Balance = 80
+	err := r.Insert(ctx, &second)
+	assert.True(t, repository.IsConcurrentModification(err))
+	assert.Equal(t, int32(1), second.Version)
+
+	got, _ := r.Get(ctx, repository.ID(account.Id))
+	assert.Equal(t, &PAccount2{Id: account.Id, Balance: 50, Version: 2}, got)
+
+	// Update 中有版本时检查，并把版本加一
+	_, err = r.Update(ctx, repository.ID(account.Id), &PAccount2{Balance: 10, Version: 1})
+	assert.True(t, repository.IsConcurrentModification(err))
+
+	rows, err := r.Update(ctx, repository.ID(account.Id), &PAccount2{Balance: 10, Version: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rows)
+
+	got, _ = r.Get(ctx, repository.ID(account.Id))
+	assert.Equal(t, int32(3), got.Version)
+
+	// BatchUpdate 任何一条冲突都回滚
+	batch := &DBBatchRepository[*Account2, *PAccount2]{DBRepository: r}
+	other := &PAccount2{Balance: 1}
+	assert.NoError(t, r.Insert(ctx, &other))
+
+	entities := []*PAccount2{{Id: account.Id, Balance: 0, Version: 3}, {Id: other.Id, Balance: 2, Version: 5}}
+	err = batch.BatchUpdate(ctx, &entities, []string{"Balance"})
+	assert.True(t, repository.IsConcurrentModification(err))
+
+	got, _ = r.Get(ctx, repository.ID(account.Id))
+	assert.Equal(t, int32(10), got.Balance)
+
+	entities[1].Version = 1
+	assert.NoError(t, batch.BatchUpdate(ctx, &entities, []string{"Balance"}))
+	assert.Equal(t, int32(4), entities[0].Version)
+
+	got, _ = r.Get(ctx, repository.ID(account.Id))
+	assert.Equal(t, &PAccount2{Id: account.Id, Balance: 0, Version: 4}, got)
+}
+
+func TestDBRepositoryVersionPutOptions(t *testing.T) {
+	var (
+		db  = testDB()
+		ctx = context.Background()
+	)
+	assert.NoError(t, db.AutoMigrate(&Account2{}))
+
+	r := NewDBRepository[*Account2, *PAccount2](db, &logger.Logger{})
+
+	account := &PAccount2{Balance: 100}
+	assert.NoError(t, r.Insert(ctx, &account))
+
+	// 有版本时 Insert 的 OptOmit/OptSelect 仍然生效，版本照常加一
+	account.Balance = 50
+	assert.NoError(t, r.Insert(ctx, &account, OptOmit("Balance")))
+	assert.Equal(t, int32(2), account.Version)
+
+	got, _ := r.Get(ctx, repository.ID(account.Id))
+	assert.Equal(t, &PAccount2{Id: account.Id, Balance: 100, Version: 2}, got)
+
+	got.Balance = 0
+	assert.NoError(t, r.Insert(ctx, &got, OptSelect("Balance")))
+
+	got, _ = r.Get(ctx, repository.ID(account.Id))
+	assert.Equal(t, &PAccount2{Id: account.Id, Balance: 0, Version: 3}, got)
+}
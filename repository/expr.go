@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrInvalidFilter 过滤表达式的结构或者值不正确
+var ErrInvalidFilter = errors.New("repository: invalid filter expression")
+
+// Operator 过滤表达式中条件的比较方式
+type Operator string
+
+const (
+	OpEq       Operator = "eq"
+	OpNe       Operator = "ne"
+	OpGt       Operator = "gt"
+	OpGe       Operator = "ge"
+	OpLt       Operator = "lt"
+	OpLe       Operator = "le"
+	OpBetween  Operator = "between"  // 值是 [min, max]，包括两端
+	OpIn       Operator = "in"       // 值是数组
+	OpNotIn    Operator = "not_in"   // 值是数组
+	OpLike     Operator = "like"     // 值是 LIKE 的模式，由调用方写 % 和 _
+	OpPrefix   Operator = "prefix"   // 以值开头，值中的 % 和 _ 不是通配符
+	OpContains Operator = "contains" // 包括值，值中的 % 和 _ 不是通配符
+	OpIsNull   Operator = "is_null"  // 值为 false 时是 IS NOT NULL
+)
+
+// FilterExpr 过滤表达式树，每个节点只能是 And、Or、Not 或者 Field 条件中的一种。
+// JSON 形式例如 {"or": [{"field": "status", "op": "eq", "value": "active"}, {"field": "owner", "op": "eq", "value": "me"}]}
+type FilterExpr struct {
+	And   []FilterExpr `json:"and,omitempty"`
+	Or    []FilterExpr `json:"or,omitempty"`
+	Not   *FilterExpr  `json:"not,omitempty"`
+	Field string       `json:"field,omitempty"`
+	Op    Operator     `json:"op,omitempty"`
+	Value interface{}  `json:"value,omitempty"`
+}
+
+func And(exprs ...FilterExpr) FilterExpr {
+	return FilterExpr{And: exprs}
+}
+
+func Or(exprs ...FilterExpr) FilterExpr {
+	return FilterExpr{Or: exprs}
+}
+
+func Not(expr FilterExpr) FilterExpr {
+	return FilterExpr{Not: &expr}
+}
+
+// Cond 字段条件，op 为空时是 OpEq
+func Cond(field string, op Operator, value interface{}) FilterExpr {
+	return FilterExpr{Field: field, Op: op, Value: value}
+}
+
+// IsZero 没有任何条件
+func (expr FilterExpr) IsZero() bool {
+	return expr.Field == "" && len(expr.And) == 0 && len(expr.Or) == 0 && expr.Not == nil
+}
+
+// Validate 检查表达式的结构和值，不检查字段是否可以过滤
+func (expr FilterExpr) Validate() error {
+	var kinds int
+	for _, set := range []bool{len(expr.And) > 0, len(expr.Or) > 0, expr.Not != nil, expr.Field != ""} {
+		if set {
+			kinds++
+		}
+	}
+
+	if kinds != 1 {
+		return fmt.Errorf("%w: node must have exactly one of and, or, not, field", ErrInvalidFilter)
+	}
+
+	switch {
+	case expr.Not != nil:
+		return expr.Not.Validate()
+	case expr.Field != "":
+		return expr.validateCond()
+	}
+
+	for _, child := range expr.children() {
+		if err := child.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (expr FilterExpr) validateCond() error {
+	switch expr.Operator() {
+	case OpEq, OpNe, OpGt, OpGe, OpLt, OpLe, OpLike, OpPrefix, OpContains:
+		if expr.Value == nil && expr.Operator() != OpEq && expr.Operator() != OpNe {
+			return fmt.Errorf("%w: %s %s requires a value", ErrInvalidFilter, expr.Field, expr.Op)
+		}
+	case OpBetween:
+		if values, ok := expr.Values(); !ok || len(values) != 2 {
+			return fmt.Errorf("%w: %s between requires [min, max]", ErrInvalidFilter, expr.Field)
+		}
+	case OpIn, OpNotIn:
+		if _, ok := expr.Values(); !ok {
+			return fmt.Errorf("%w: %s %s requires an array", ErrInvalidFilter, expr.Field, expr.Op)
+		}
+	case OpIsNull:
+		if _, ok := expr.Value.(bool); expr.Value != nil && !ok {
+			return fmt.Errorf("%w: %s is_null value must be a bool", ErrInvalidFilter, expr.Field)
+		}
+	default:
+		return fmt.Errorf("%w: unknown operator %s", ErrInvalidFilter, expr.Op)
+	}
+
+	return nil
+}
+
+// Operator 返回条件的比较方式，默认是 OpEq
+func (expr FilterExpr) Operator() Operator {
+	if expr.Op == "" {
+		return OpEq
+	}
+
+	return expr.Op
+}
+
+// Values 把数组或者切片的值展开，用于 between、in 和 not_in
+func (expr FilterExpr) Values() ([]interface{}, bool) {
+	v := reflect.ValueOf(expr.Value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+
+	return values, true
+}
+
+// Walk 按深度优先遍历全部的字段条件
+func (expr FilterExpr) Walk(fn func(cond FilterExpr) error) error {
+	switch {
+	case expr.Field != "":
+		return fn(expr)
+	case expr.Not != nil:
+		return expr.Not.Walk(fn)
+	}
+
+	for _, child := range expr.children() {
+		if err := child.Walk(fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (expr FilterExpr) children() []FilterExpr {
+	if len(expr.And) > 0 {
+		return expr.And
+	}
+
+	return expr.Or
+}
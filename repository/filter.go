@@ -1,5 +1,10 @@
 package repository
 
+import "errors"
+
+// ErrMissingFilter UpdateWhere 没有 filters 时返回，避免修改全部记录，和 gorm 的 ErrMissingWhereClause 对应
+var ErrMissingFilter = errors.New("repository: missing filters")
+
 type Oper interface {
 	Op(key, value interface{})
 }
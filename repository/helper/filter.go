@@ -7,15 +7,22 @@ import (
 	"github.com/hnhuaxi/domain/repository"
 )
 
+// ParseFilters 解析请求查询参数中的过滤器，格式参见 ParseQuery
 func ParseFilters(r *http.Request) ([]repository.FilterItem, error) {
-	panic("nonimplement")
+	opt, err := ParseRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return opt.Filters, nil
 }
 
+// BuildFilters 每一项是 FilterItem 的 JSON，或者 repository.FilterExpr 的 JSON 表达式，
+// 例如 {"or": [{"field": "status", "value": "active"}, {"field": "owner", "value": "me"}]}
 func BuildFilters(filter []string) ([]repository.FilterItem, error) {
 	var filters = make([]repository.FilterItem, 0)
 	for _, e := range filter {
-		var filter repository.FilterItem
-		err := json.Unmarshal([]byte(e), &filter)
+		filter, err := parseFilter(e)
 		if err != nil {
 			return nil, err
 		}
@@ -25,6 +32,27 @@ func BuildFilters(filter []string) ([]repository.FilterItem, error) {
 	return filters, nil
 }
 
+func parseFilter(s string) (repository.FilterItem, error) {
+	var (
+		filter repository.FilterItem
+		expr   repository.FilterExpr
+	)
+
+	if err := json.Unmarshal([]byte(s), &expr); err != nil {
+		return filter, err
+	}
+
+	if !expr.IsZero() {
+		if err := expr.Validate(); err != nil {
+			return filter, err
+		}
+		return repository.FilterItem{Expr: &expr}, nil
+	}
+
+	err := json.Unmarshal([]byte(s), &filter)
+	return filter, err
+}
+
 func BuildSort(sorts []string) ([]repository.SortMode, error) {
 	var sortModes = make([]repository.SortMode, 0)
 	for _, e := range sorts {
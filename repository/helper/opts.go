@@ -88,8 +88,8 @@ func BuildSearchOpts(req interface{}) (*repository.SearchOpt, error) {
 				return len(f) > 0
 			})
 			filterOpts := slice.Map(filters, func(flt string) repository.FilterItem {
-				var filterItem repository.FilterItem
-				if err := json.Unmarshal([]byte(flt), &filterItem); err != nil {
+				filterItem, err := parseFilter(flt)
+				if err != nil {
 					errs = multierr.Append(errs, err)
 				}
 
@@ -0,0 +1,398 @@
+package helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hnhuaxi/domain/repository"
+)
+
+var (
+	filterParam = regexp.MustCompile(`^filter\[([^\[\]]+)\](?:\[([^\[\]]+)\])?$`)
+	pageParam   = regexp.MustCompile(`^page\[([^\[\]]+)\]$`)
+
+	operatorAliases = map[string]repository.Operator{
+		"gte": repository.OpGe,
+		"lte": repository.OpLe,
+		"nin": repository.OpNotIn,
+	}
+
+	totalModes = map[string]repository.TotalMode{
+		"count":    repository.TotalCount,
+		"window":   repository.TotalWindow,
+		"estimate": repository.TotalEstimate,
+		"skip":     repository.TotalSkip,
+	}
+)
+
+// QueryError 查询参数不正确，Param 是出错的参数名
+type QueryError struct {
+	Param string
+	Value string
+	Err   error
+}
+
+func (err *QueryError) Error() string {
+	return fmt.Sprintf("helper: invalid query parameter %s=%q: %s", err.Param, err.Value, err.Err)
+}
+
+func (err *QueryError) Unwrap() error {
+	return err.Err
+}
+
+// ParseQuery 解析查询参数，例如
+//
+//	?filter[status]=active&filter[age][gte]=18&sort=-created_at,name&page[size]=20&page[after]=...
+//
+// filter[field]=value 使用 AddFilter 注册的比较方式，filter[field][op]=value 使用指定的比较方式，
+// in、not_in 的值用逗号分隔，between 的值是 min,max。filter=<json> 是 repository.FilterExpr 的 JSON，
+// 用于 and/or/not 的组合。sort 用逗号分隔，- 开头是降序。page 支持 size、number、after、before，
+// total 是 count、window、estimate 或者 skip。其他参数被忽略
+func ParseQuery(values url.Values) (*repository.SearchOpt, error) {
+	var (
+		searchOpt repository.SearchOpt
+		opts      []repository.SearchOptFunc
+		keys      = make([]string, 0, len(values))
+	)
+
+	for key := range values {
+		keys = append(keys, key)
+	}
+	// url.Values 是 map，排序之后过滤器的顺序是确定的
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		opt, err := parseParam(key, values[key])
+		if err != nil {
+			return nil, err
+		}
+
+		if opt != nil {
+			opts = append(opts, opt)
+		}
+	}
+
+	for _, op := range opts {
+		if err := op(&searchOpt); err != nil {
+			return nil, err
+		}
+	}
+
+	return &searchOpt, nil
+}
+
+// ParseRequest 解析请求的查询参数，参见 ParseQuery
+func ParseRequest(r *http.Request) (*repository.SearchOpt, error) {
+	return ParseQuery(r.URL.Query())
+}
+
+func parseParam(key string, vals []string) (repository.SearchOptFunc, error) {
+	var (
+		value   = vals[len(vals)-1]
+		invalid = func(err error) error {
+			return &QueryError{Param: key, Value: value, Err: err}
+		}
+		wrap = func(opt repository.SearchOptFunc) repository.SearchOptFunc {
+			return func(so *repository.SearchOpt) error {
+				if err := opt(so); err != nil {
+					return invalid(err)
+				}
+				return nil
+			}
+		}
+	)
+
+	switch {
+	case key == "filter":
+		filters := make([]repository.FilterItem, 0, len(vals))
+		for _, val := range vals {
+			filter, err := parseFilter(val)
+			if err != nil {
+				value = val
+				return nil, invalid(err)
+			}
+			filters = append(filters, filter)
+		}
+		return repository.OptFilter(filters...), nil
+	case key == "sort":
+		sorts, err := parseSorts(value)
+		if err != nil {
+			return nil, invalid(err)
+		}
+		return repository.OptSort(sorts...), nil
+	case key == "total":
+		mode, ok := totalModes[value]
+		if !ok {
+			return nil, invalid(fmt.Errorf("unknown total mode"))
+		}
+		return repository.OptTotal(mode), nil
+	}
+
+	if m := filterParam.FindStringSubmatch(key); m != nil {
+		field, op := m[1], m[2]
+		if op == "" {
+			if len(vals) > 1 {
+				return nil, invalid(fmt.Errorf("repeated filter, use %s[in]", key))
+			}
+			return repository.OptFilter(repository.FilterItem{ID: field, Value: value}), nil
+		}
+
+		// 同一个条件出现多次时都要满足，例如 filter[name][contains]=a&filter[name][contains]=b
+		opts := make([]repository.SearchOptFunc, 0, len(vals))
+		for _, val := range vals {
+			cond, err := parseCond(field, op, val)
+			if err != nil {
+				value = val
+				return nil, invalid(err)
+			}
+			opts = append(opts, repository.OptWhere(cond))
+		}
+
+		return wrap(func(so *repository.SearchOpt) error {
+			for _, opt := range opts {
+				if err := opt(so); err != nil {
+					return err
+				}
+			}
+			return nil
+		}), nil
+	}
+
+	if m := pageParam.FindStringSubmatch(key); m != nil {
+		switch m[1] {
+		case "size", "number":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, invalid(fmt.Errorf("must be a non-negative integer"))
+			}
+
+			if m[1] == "size" {
+				return repository.OptPageSize(n), nil
+			}
+			return repository.OptPage(n), nil
+		case "after":
+			return wrap(repository.OptAfterCursor(value)), nil
+		case "before":
+			return wrap(repository.OptBeforeCursor(value)), nil
+		default:
+			return nil, invalid(fmt.Errorf("unknown page parameter"))
+		}
+	}
+
+	return nil, nil
+}
+
+func parseCond(field, op, value string) (repository.FilterExpr, error) {
+	operator, ok := operatorAliases[op]
+	if !ok {
+		operator = repository.Operator(op)
+	}
+
+	cond := repository.Cond(field, operator, value)
+
+	switch operator {
+	case repository.OpIn, repository.OpNotIn:
+		cond.Value = splitValues(value)
+	case repository.OpBetween:
+		values := splitValues(value)
+		if len(values) != 2 {
+			return cond, fmt.Errorf("%w: between requires min,max", repository.ErrInvalidFilter)
+		}
+		cond.Value = values
+	case repository.OpIsNull:
+		isNull := true
+		if value != "" {
+			var err error
+			if isNull, err = strconv.ParseBool(value); err != nil {
+				return cond, fmt.Errorf("%w: is_null requires true or false", repository.ErrInvalidFilter)
+			}
+		}
+		cond.Value = isNull
+	}
+
+	return cond, cond.Validate()
+}
+
+func splitValues(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+
+	return strings.Split(value, ",")
+}
+
+func parseSorts(value string) ([]repository.SortMode, error) {
+	var sorts []repository.SortMode
+	for _, field := range strings.Split(value, ",") {
+		direction := repository.OrderAsc
+		if strings.HasPrefix(field, "-") {
+			direction = repository.OrderDesc
+			field = field[1:]
+		}
+
+		if field = strings.TrimPrefix(field, "+"); field == "" {
+			return nil, fmt.Errorf("empty sort field")
+		}
+
+		sorts = append(sorts, repository.SortMode{Field: field, Direction: direction})
+	}
+
+	return sorts, nil
+}
+
+// EncodeQuery 把 SearchOpt 编码为 ParseQuery 可以解析的查询参数，
+// 没有 Field 的过滤表达式编码为 filter=<json>
+func EncodeQuery(opt *repository.SearchOpt) (url.Values, error) {
+	values := make(url.Values)
+
+	for _, filter := range opt.Filters {
+		if filter.Expr == nil {
+			values.Add(fmt.Sprintf("filter[%s]", filter.ID), fmt.Sprint(filter.Value))
+			continue
+		}
+
+		if key, value, ok := encodeCond(*filter.Expr); ok {
+			values.Add(key, value)
+			continue
+		}
+
+		b, err := json.Marshal(filter.Expr)
+		if err != nil {
+			return nil, err
+		}
+		values.Add("filter", string(b))
+	}
+
+	if len(opt.Sorts) > 0 {
+		sorts := make([]string, len(opt.Sorts))
+		for i, sort := range opt.Sorts {
+			sorts[i] = sort.Field
+			if sort.Direction == repository.OrderDesc {
+				sorts[i] = "-" + sort.Field
+			}
+		}
+		values.Set("sort", strings.Join(sorts, ","))
+	}
+
+	if opt.Page.PageSize > 0 {
+		values.Set("page[size]", strconv.Itoa(opt.Page.PageSize))
+	}
+
+	switch {
+	case opt.Page.AfterCursor != "":
+		values.Set("page[after]", opt.Page.AfterCursor)
+	case opt.Page.BeforeCursor != "":
+		values.Set("page[before]", opt.Page.BeforeCursor)
+	case opt.Page.Page > 0:
+		values.Set("page[number]", strconv.Itoa(opt.Page.Page))
+	}
+
+	for name, mode := range totalModes {
+		if mode == opt.Total && mode != repository.TotalCount {
+			values.Set("total", name)
+		}
+	}
+
+	return values, nil
+}
+
+// encodeCond 只有一个字段条件，并且值可以用逗号分隔表示时编码为 filter[field][op]=value
+func encodeCond(cond repository.FilterExpr) (string, string, bool) {
+	if cond.Field == "" {
+		return "", "", false
+	}
+
+	var (
+		key   = fmt.Sprintf("filter[%s][%s]", cond.Field, cond.Operator())
+		value = fmt.Sprint(cond.Value)
+	)
+
+	if values, ok := cond.Values(); ok {
+		strs := make([]string, len(values))
+		for i, val := range values {
+			if strs[i] = fmt.Sprint(val); strings.Contains(strs[i], ",") {
+				return "", "", false
+			}
+		}
+		value = strings.Join(strs, ",")
+	}
+
+	if cond.Operator() == repository.OpIsNull {
+		isNull, ok := cond.Value.(bool)
+		value = strconv.FormatBool(isNull || !ok)
+	}
+
+	return key, value, cond.Value != nil || cond.Operator() == repository.OpIsNull
+}
+
+// PageLinks 返回前一页和后一页的 URL，没有时为空。有游标时使用游标，否则使用页码。
+// base 中的其他查询参数被保留，filter、sort、page 和 total 被替换
+func PageLinks(base *url.URL, opt *repository.SearchOpt, metadata repository.SearchMetadata) (prev, next string, err error) {
+	var (
+		backward      = opt.Page.BeforeCursor != ""
+		hasPrev       bool
+		hasNext       bool
+		prevOpt       = *opt
+		nextOpt       = *opt
+		cursorEnabled = metadata.NextCursor != "" || metadata.PrevCursor != ""
+	)
+
+	if cursorEnabled {
+		hasNext = backward || metadata.HasMore
+		hasPrev = (backward && metadata.HasMore) || (!backward && opt.Page.AfterCursor != "")
+
+		prevOpt.Page.AfterCursor, prevOpt.Page.BeforeCursor = "", metadata.PrevCursor
+		nextOpt.Page.AfterCursor, nextOpt.Page.BeforeCursor = metadata.NextCursor, ""
+	} else {
+		page := opt.Page.Page
+		if page < 1 {
+			page = 1
+		}
+
+		hasNext = metadata.HasMore
+		hasPrev = page > 1
+		prevOpt.Page.Page, nextOpt.Page.Page = page-1, page+1
+	}
+
+	link := func(opt *repository.SearchOpt) (string, error) {
+		values, err := EncodeQuery(opt)
+		if err != nil {
+			return "", err
+		}
+
+		query := base.Query()
+		for key := range query {
+			if key == "filter" || key == "sort" || key == "total" || strings.HasPrefix(key, "filter[") || strings.HasPrefix(key, "page[") {
+				query.Del(key)
+			}
+		}
+
+		for key, vals := range values {
+			query[key] = vals
+		}
+
+		u := *base
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+
+	if hasPrev {
+		if prev, err = link(&prevOpt); err != nil {
+			return "", "", err
+		}
+	}
+
+	if hasNext {
+		if next, err = link(&nextOpt); err != nil {
+			return "", "", err
+		}
+	}
+
+	return prev, next, nil
+}
@@ -0,0 +1,91 @@
+package helper
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/hnhuaxi/domain/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuery(t *testing.T) {
+	values, err := url.ParseQuery("filter[status]=active&filter[age][gte]=18&filter[role][in]=admin,owner&sort=-created_at,name&page[size]=20&total=skip&other=1")
+	assert.NoError(t, err)
+
+	opt, err := ParseQuery(values)
+	assert.NoError(t, err)
+
+	age := repository.Cond("age", repository.OpGe, "18")
+	role := repository.Cond("role", repository.OpIn, []string{"admin", "owner"})
+	assert.Equal(t, []repository.FilterItem{
+		{Expr: &age},
+		{Expr: &role},
+		{ID: "status", Value: "active"},
+	}, opt.Filters)
+	assert.Equal(t, []repository.SortMode{
+		{Field: "created_at", Direction: repository.OrderDesc},
+		{Field: "name", Direction: repository.OrderAsc},
+	}, opt.Sorts)
+	assert.Equal(t, 20, opt.Page.PageSize)
+	assert.Equal(t, repository.TotalSkip, opt.Total)
+}
+
+func TestParseQueryError(t *testing.T) {
+	for param, value := range map[string]string{
+		"filter[age][around]":  "18",
+		"filter[age][between]": "18",
+		"page[size]":           "-1",
+		"sort":                 "name,",
+		"total":                "all",
+	} {
+		_, err := ParseQuery(url.Values{param: {value}})
+
+		var qerr *QueryError
+		if assert.True(t, errors.As(err, &qerr), param) {
+			assert.Equal(t, param, qerr.Param)
+			assert.Equal(t, value, qerr.Value)
+		}
+	}
+}
+
+func TestEncodeQuery(t *testing.T) {
+	opt, err := ParseQuery(url.Values{
+		"filter[age][between]": {"18,30"},
+		"filter[name]":         {"bob"},
+		"sort":                 {"-age"},
+		"page[size]":           {"10"},
+		"page[number]":         {"2"},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, repository.OptWhere(repository.Or(
+		repository.Cond("status", repository.OpEq, "active"),
+		repository.Cond("owner", repository.OpEq, "me"),
+	))(opt))
+
+	values, err := EncodeQuery(opt)
+	assert.NoError(t, err)
+
+	decoded, err := ParseQuery(values)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, opt.Filters, decoded.Filters)
+	assert.Equal(t, opt.Sorts, decoded.Sorts)
+	assert.Equal(t, opt.Page, decoded.Page)
+}
+
+func TestPageLinks(t *testing.T) {
+	base, _ := url.Parse("https://example.com/users?lang=zh&page[number]=2")
+
+	opt, err := ParseQuery(base.Query())
+	assert.NoError(t, err)
+
+	prev, next, err := PageLinks(base, opt, repository.SearchMetadata{HasMore: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/users?lang=zh&page%5Bnumber%5D=1", prev)
+	assert.Equal(t, "https://example.com/users?lang=zh&page%5Bnumber%5D=3", next)
+
+	prev, next, err = PageLinks(base, opt, repository.SearchMetadata{NextCursor: "n", PrevCursor: "p"})
+	assert.NoError(t, err)
+	assert.Empty(t, prev)
+	assert.Empty(t, next)
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Cache 是 CacheRepository 使用的缓存存储，expiration 为 0 时不过期
+type Cache[E any] interface {
+	Get(ctx context.Context, key string) (E, bool, error)
+	Set(ctx context.Context, key string, entity E, expiration time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// LRUCache 是进程内带过期时间的 LRU 缓存，超过 size 时淘汰最久没有使用的条目，
+// E 是结构体指针时 Set 和 Get 都浅拷贝一份，调用方修改返回的实体不会改变缓存中的值，
+// 实体中的切片、map 和指针字段仍然和缓存共用，需要当作只读
+type LRUCache[E any] struct {
+	mu    sync.Mutex
+	size  int
+	items map[string]*list.Element
+	order *list.List
+}
+
+type lruEntry[E any] struct {
+	key      string
+	entity   E
+	expireAt time.Time
+}
+
+func NewLRUCache[E any](size int) (*LRUCache[E], error) {
+	if size <= 0 {
+		return nil, errors.New("must provide a positive size")
+	}
+
+	return &LRUCache[E]{
+		size:  size,
+		items: make(map[string]*list.Element, size),
+		order: list.New(),
+	}, nil
+}
+
+func (lru *LRUCache[E]) Get(ctx context.Context, key string) (E, bool, error) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	var z E
+	elem, ok := lru.items[key]
+	if !ok {
+		return z, false, nil
+	}
+
+	entry := elem.Value.(*lruEntry[E])
+	if !entry.expireAt.IsZero() && time.Now().After(entry.expireAt) {
+		lru.removeElement(elem)
+		return z, false, nil
+	}
+
+	lru.order.MoveToFront(elem)
+	return cloneEntity(entry.entity), true, nil
+}
+
+func (lru *LRUCache[E]) Set(ctx context.Context, key string, entity E, expiration time.Duration) error {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	var expireAt time.Time
+	entity = cloneEntity(entity)
+	if expiration > 0 {
+		expireAt = time.Now().Add(expiration)
+	}
+
+	if elem, ok := lru.items[key]; ok {
+		entry := elem.Value.(*lruEntry[E])
+		entry.entity, entry.expireAt = entity, expireAt
+		lru.order.MoveToFront(elem)
+		return nil
+	}
+
+	lru.items[key] = lru.order.PushFront(&lruEntry[E]{key: key, entity: entity, expireAt: expireAt})
+	if lru.order.Len() > lru.size {
+		lru.removeElement(lru.order.Back())
+	}
+
+	return nil
+}
+
+func (lru *LRUCache[E]) Delete(ctx context.Context, keys ...string) error {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	for _, key := range keys {
+		if elem, ok := lru.items[key]; ok {
+			lru.removeElement(elem)
+		}
+	}
+
+	return nil
+}
+
+// Len 返回缓存中的条目数，包括已经过期但还没有被清除的条目
+func (lru *LRUCache[E]) Len() int {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	return lru.order.Len()
+}
+
+func (lru *LRUCache[E]) removeElement(elem *list.Element) {
+	lru.order.Remove(elem)
+	delete(lru.items, elem.Value.(*lruEntry[E]).key)
+}
+
+// cloneEntity 浅拷贝结构体指针，其他类型按值保存不需要拷贝
+func cloneEntity[E any](entity E) E {
+	v := reflect.ValueOf(entity)
+	if !v.IsValid() || v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return entity
+	}
+
+	clone := reflect.New(v.Elem().Type())
+	clone.Elem().Set(v.Elem())
+	return clone.Interface().(E)
+}
@@ -7,4 +7,26 @@ type SearchMetadata struct {
 	PageSize int
 	PrevID   string
 	NextID   string
+	// PrevCursor 和 NextCursor 是第一条和最后一条记录的游标，
+	// 传给 OptBeforeCursor 和 OptAfterCursor 读取前一页和后一页
+	PrevCursor string
+	NextCursor string
+	// HasMore 按读取的方向还有更多记录
+	HasMore bool
 }
+
+// TotalMode Find 时如何计算 SearchMetadata.Total
+type TotalMode int
+
+const (
+	// TotalCount 默认使用相同的过滤条件执行一次 COUNT(*)
+	TotalCount TotalMode = iota
+	// TotalWindow 在查询中加入 COUNT(*) OVER()，只需要一次查询，
+	// 有 Preload、Joins、Group 或者 Distinct 时使用 TotalCount
+	TotalWindow
+	// TotalEstimate 使用数据库的查询计划估计总数，不精确但是不需要扫描，
+	// 数据库不支持时使用 TotalCount
+	TotalEstimate
+	// TotalSkip 不计算总数，Total 为 0，用于无限滚动
+	TotalSkip
+)
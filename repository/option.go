@@ -22,6 +22,8 @@ type SearchOpt struct {
 	Expiration time.Duration
 	Customs    CustomOption
 	SkipCache  bool
+	Trashed    TrashedMode
+	Total      TotalMode
 	Scope      Scope
 
 	validKeys []string
@@ -40,6 +42,7 @@ type PutOption struct {
 	DBScopes            []ScopeFunc
 	LoadKeys            map[string]KeyFunc
 	ForceCreate         bool
+	Mask                []string // Update 修改的字段，包括零值
 	Expires             time.Duration
 	Scope               Scope
 }
@@ -53,11 +56,13 @@ type KeyFunc func(model interface{}) interface{}
 type PutOptFunc func(opt *PutOption) error
 
 type PageOption struct {
-	AfterId    Key
-	BeforeId   Key
-	PageSize   int
-	PageOffset int
-	Page       int
+	AfterId      Key
+	BeforeId     Key
+	AfterCursor  string // SearchMetadata.NextCursor，按排序读取之后的记录
+	BeforeCursor string // SearchMetadata.PrevCursor，按排序读取之前的记录
+	PageSize     int
+	PageOffset   int
+	Page         int
 }
 
 type SearchOptFunc func(*SearchOpt) error
@@ -117,6 +122,31 @@ func OptBefore(key Key) SearchOptFunc {
 	}
 }
 
+// OptAfterCursor 读取游标之后的一页，使用游标时忽略 OptPage，
+// 排序列中不能有 NULL，行值比较遇到 NULL 时结果为 NULL，这些记录会被跳过
+func OptAfterCursor(cursor string) SearchOptFunc {
+	return func(so *SearchOpt) error {
+		if _, err := DecodeCursor(cursor); err != nil {
+			return err
+		}
+		so.Page.AfterCursor = cursor
+		so.Page.BeforeCursor = ""
+		return nil
+	}
+}
+
+// OptBeforeCursor 读取游标之前的一页，结果仍然按排序的顺序返回
+func OptBeforeCursor(cursor string) SearchOptFunc {
+	return func(so *SearchOpt) error {
+		if _, err := DecodeCursor(cursor); err != nil {
+			return err
+		}
+		so.Page.BeforeCursor = cursor
+		so.Page.AfterCursor = ""
+		return nil
+	}
+}
+
 func OptPageSize(size int) SearchOptFunc {
 	return func(so *SearchOpt) error {
 		so.Page.PageSize = size
@@ -159,6 +189,19 @@ func OptFilter(item ...FilterItem) SearchOptFunc {
 	}
 }
 
+// OptWhere 加入过滤表达式，和其他过滤器是 AND 的关系。
+// DBRepository 的字段必须用 AddFilter 注册过；RedisRepository 扫描之后在内存中过滤，
+// 可以使用模型的任何字段，不检查 AddFilter
+func OptWhere(expr FilterExpr) SearchOptFunc {
+	return func(so *SearchOpt) error {
+		if err := expr.Validate(); err != nil {
+			return err
+		}
+		so.Filters = append(so.Filters, FilterItem{Expr: &expr})
+		return nil
+	}
+}
+
 func OptSort(item ...SortMode) SearchOptFunc {
 	return func(so *SearchOpt) error {
 		so.Sorts = append(so.Sorts, item...)
@@ -211,6 +254,14 @@ func OptExpires(duration time.Duration) PutOptFunc {
 	}
 }
 
+// OptMask 指定 Update 和 UpdateWhere 修改的字段，字段为零值时也会被修改
+func OptMask(fields ...string) PutOptFunc {
+	return func(opt *PutOption) error {
+		opt.Mask = append(opt.Mask, fields...)
+		return nil
+	}
+}
+
 func OptExpiration(duration time.Duration) SearchOptFunc {
 	return func(so *SearchOpt) error {
 		so.Expiration = duration
@@ -225,6 +276,35 @@ func OptWithoutCache() SearchOptFunc {
 	}
 }
 
+// OptWithTrashed 查询包括已经软删除的记录
+func OptWithTrashed() SearchOptFunc {
+	return func(so *SearchOpt) error {
+		so.Trashed = TrashedWith
+		return nil
+	}
+}
+
+// OptOnlyTrashed 只查询已经软删除的记录
+func OptOnlyTrashed() SearchOptFunc {
+	return func(so *SearchOpt) error {
+		so.Trashed = TrashedOnly
+		return nil
+	}
+}
+
+// OptTotal 指定 Find 计算总数的方式
+func OptTotal(mode TotalMode) SearchOptFunc {
+	return func(so *SearchOpt) error {
+		so.Total = mode
+		return nil
+	}
+}
+
+// OptSkipTotal 不计算总数
+func OptSkipTotal() SearchOptFunc {
+	return OptTotal(TotalSkip)
+}
+
 func OptDB(db Scope) SearchOptFunc {
 	return func(so *SearchOpt) error {
 		so.Scope = db
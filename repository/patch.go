@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidPatch JSON merge patch 不是对象
+var ErrInvalidPatch = errors.New("repository: patch must be a json object")
+
+// MergePatch 按 JSON merge patch(RFC 7386) 把 patch 合并到 doc，
+// patch 中为 null 的字段被删除，对象递归合并，其他值直接替换
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, changes map[string]interface{}
+
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(patch, &changes); err != nil || changes == nil {
+		return nil, ErrInvalidPatch
+	}
+
+	return json.Marshal(mergeObject(target, changes))
+}
+
+// PatchKeys 返回 patch 第一层的字段，Patch 只修改这些字段
+func PatchKeys(patch []byte) ([]string, error) {
+	var changes map[string]json.RawMessage
+
+	if err := json.Unmarshal(patch, &changes); err != nil || changes == nil {
+		return nil, ErrInvalidPatch
+	}
+
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func mergeObject(target, changes map[string]interface{}) map[string]interface{} {
+	if target == nil {
+		target = make(map[string]interface{}, len(changes))
+	}
+
+	for key, val := range changes {
+		switch val := val.(type) {
+		case nil:
+			delete(target, key)
+		case map[string]interface{}:
+			sub, _ := target[key].(map[string]interface{})
+			target[key] = mergeObject(sub, val)
+		default:
+			target[key] = val
+		}
+	}
+
+	return target
+}
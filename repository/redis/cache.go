@@ -0,0 +1,164 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/go-redis/redis/v8"
+	"github.com/hnhuaxi/domain/repository"
+	"github.com/hnhuaxi/platform/logger"
+)
+
+// AsCache 把 RedisRepository 作为 repository.Cache 使用，key 加上 NS 前缀，
+// 值和 Insert 写入的格式相同，所以 CacheRepository 的 key 不带 Namespace 时，
+// 两者读写的是同一个 redis key
+func (rredis *RedisRepository[M, E]) AsCache() repository.Cache[E] {
+	return &redisCache[M, E]{rredis: rredis}
+}
+
+type redisCache[M repository.Model[E], E any] struct {
+	rredis *RedisRepository[M, E]
+}
+
+func (cache *redisCache[M, E]) Get(ctx context.Context, key string) (E, bool, error) {
+	var (
+		z E
+		m = cache.rredis.instantM()
+	)
+
+	b, err := cache.rredis.redis.Get(ctx, cache.rredis.getKey(key)).Bytes()
+	switch err {
+	case redis.Nil:
+		return z, false, nil
+	case nil:
+	default:
+		return z, false, err
+	}
+
+	if err := json.Unmarshal(b, m); err != nil {
+		return z, false, err
+	}
+
+	return m.ToEntity(), true, nil
+}
+
+func (cache *redisCache[M, E]) Set(ctx context.Context, key string, entity E, expiration time.Duration) error {
+	b, err := json.Marshal(repository.FromEntity[M](entity))
+	if err != nil {
+		return err
+	}
+
+	return cache.rredis.redis.Set(ctx, cache.rredis.getKey(key), b, expiration).Err()
+}
+
+func (cache *redisCache[M, E]) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	fullkeys := make([]string, len(keys))
+	for i, key := range keys {
+		fullkeys[i] = cache.rredis.getKey(key)
+	}
+
+	return cache.rredis.redis.Del(ctx, fullkeys...).Err()
+}
+
+// Invalidator 通过 redis pub/sub 在实例之间广播失效的 key，忽略自己发布的消息
+type Invalidator struct {
+	id       string
+	channel  string
+	rediscli *redis.Client
+	logger   *logger.Logger
+}
+
+type invalidation struct {
+	Source string   `json:"source"`
+	Keys   []string `json:"keys"`
+}
+
+var _ repository.Invalidator = (*Invalidator)(nil)
+
+func NewInvalidator(channel string, rediscli *redis.Client, logger *logger.Logger) *Invalidator {
+	return &Invalidator{
+		id:       watermill.NewShortUUID(),
+		channel:  channel,
+		rediscli: rediscli,
+		logger:   logger,
+	}
+}
+
+func (inv *Invalidator) Publish(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(invalidation{Source: inv.id, Keys: keys})
+	if err != nil {
+		return err
+	}
+
+	return inv.rediscli.Publish(ctx, inv.channel, b).Err()
+}
+
+// Subscribe 等待订阅成功后返回，之后在后台接收消息直到 ctx 结束
+func (inv *Invalidator) Subscribe(ctx context.Context, fn func(keys []string)) error {
+	pubsub := inv.rediscli.Subscribe(ctx, inv.channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+
+	go func() {
+		defer pubsub.Close()
+
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+
+				var inval invalidation
+				if err := json.Unmarshal([]byte(msg.Payload), &inval); err != nil {
+					inv.logger.Sugar().Warnf("decode invalidation on %s failed: %s", inv.channel, err)
+					continue
+				}
+
+				if inval.Source == inv.id {
+					continue
+				}
+
+				fn(inval.Keys)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// NewTieredCacheRepository 组合进程内 LRU(L1，和 NewCacheRepository 使用的 repository.LRUCache 相同)、
+// rredis(L2) 和 repos 的缓存，L1 的失效通过 rredis.NS 对应的 channel 通知其他实例，订阅直到 ctx 结束，
+// opts 设置 CacheRepository 的选项，例如 OptCacheExpiration、OptSingleflight
+func NewTieredCacheRepository[M repository.Model[E], E any](ctx context.Context, repos repository.Repository[M, E], rredis *RedisRepository[M, E], size int, logger *logger.Logger, tieredOpts []repository.TieredOptFunc, opts ...repository.CacheOptFunc) (*repository.CacheRepository[M, E], error) {
+	l1, err := repository.NewLRUCache[E](size)
+	if err != nil {
+		return nil, err
+	}
+
+	tieredOpts = append([]repository.TieredOptFunc{
+		repository.OptInvalidator(NewInvalidator(rredis.getKey("invalidate"), rredis.redis, logger)),
+	}, tieredOpts...)
+
+	tiered, err := repository.NewTieredCache[E](ctx, l1, rredis.AsCache(), tieredOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.NewCacheRepositoryWith[M](repos, tiered, logger, opts...), nil
+}
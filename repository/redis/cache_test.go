@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/hnhuaxi/domain/repository"
+	"github.com/hnhuaxi/platform/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisCache(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		s      = miniredis.RunT(t)
+		client = redis.NewClient(&redis.Options{Addr: s.Addr()})
+		rredis = NewRedisRepository[*TestUser, *PTestUser]("tests", client, logger.ProviderLog())
+		cache  = rredis.AsCache()
+	)
+	defer client.Close()
+
+	_, ok, err := cache.Get(ctx, "test_user:10")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// 和 RedisRepository 读写同一个 key
+	assert.NoError(t, cache.Set(ctx, "test_user:10", &PTestUser{Id: 10, Name: "bob"}, time.Minute))
+	u, err := rredis.Get(ctx, repository.ID(10))
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", u.Name)
+
+	assert.NoError(t, cache.Delete(ctx, "test_user:10"))
+	assert.False(t, s.Exists("tests$$test_user:10"))
+}
+
+func TestInvalidator(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		s           = miniredis.RunT(t)
+		client      = redis.NewClient(&redis.Options{Addr: s.Addr()})
+		a           = NewInvalidator("tests$$invalidate", client, logger.ProviderLog())
+		b           = NewInvalidator("tests$$invalidate", client, logger.ProviderLog())
+		received    = make(chan []string, 2)
+	)
+	defer client.Close()
+	defer cancel()
+
+	for _, inv := range []*Invalidator{a, b} {
+		assert.NoError(t, inv.Subscribe(ctx, func(keys []string) {
+			received <- keys
+		}))
+	}
+
+	// 只有 b 收到 a 发布的消息
+	assert.NoError(t, a.Publish(ctx, "test_user:10"))
+
+	select {
+	case keys := <-received:
+		assert.Equal(t, []string{"test_user:10"}, keys)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting invalidation")
+	}
+
+	select {
+	case keys := <-received:
+		t.Fatalf("unexpected invalidation %v", keys)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
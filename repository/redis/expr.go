@@ -0,0 +1,188 @@
+package redis
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hnhuaxi/domain/repository"
+)
+
+// matchExpr 在读取的实体上计算过滤表达式，Redis 没有二级索引，Find 和 UpdateWhere 扫描之后过滤，
+// 字段是模型上的任何字段，没有 DBRepository 的 AddFilter 注册检查。
+// like、prefix 和 contains 不区分大小写，和 MySQL 默认的排序规则一致
+func matchExpr(v reflect.Value, expr repository.FilterExpr) (bool, error) {
+	switch {
+	case expr.Field != "":
+		return matchCond(v, expr)
+	case expr.Not != nil:
+		ok, err := matchExpr(v, *expr.Not)
+		return !ok, err
+	}
+
+	for _, child := range expr.And {
+		if ok, err := matchExpr(v, child); err != nil || !ok {
+			return false, err
+		}
+	}
+
+	for _, child := range expr.Or {
+		if ok, err := matchExpr(v, child); err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return len(expr.And) > 0, nil
+}
+
+func matchCond(v reflect.Value, cond repository.FilterExpr) (bool, error) {
+	field, ok := lookupField(v.Type(), cond.Field)
+	if !ok {
+		return false, fmt.Errorf("invalid filter field %s", cond.Field)
+	}
+
+	val := v.FieldByIndex(field.Index)
+	isNull := (val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface || val.Kind() == reflect.Map || val.Kind() == reflect.Slice) && val.IsNil()
+	actual := reflect.Indirect(val)
+
+	switch cond.Operator() {
+	case repository.OpIsNull:
+		want, ok := cond.Value.(bool)
+		return isNull == (want || !ok), nil
+	case repository.OpEq:
+		if cond.Value == nil {
+			return isNull, nil
+		}
+	case repository.OpNe:
+		if cond.Value == nil {
+			return !isNull, nil
+		}
+	}
+
+	// SQL 中和 NULL 比较总是不成立
+	if isNull {
+		return false, nil
+	}
+
+	switch cond.Operator() {
+	case repository.OpEq:
+		return equalValue(actual, cond.Value), nil
+	case repository.OpNe:
+		return !equalValue(actual, cond.Value), nil
+	case repository.OpGt, repository.OpGe, repository.OpLt, repository.OpLe:
+		n, err := compareValue(actual, cond.Value)
+		if err != nil {
+			return false, err
+		}
+
+		switch cond.Operator() {
+		case repository.OpGt:
+			return n > 0, nil
+		case repository.OpGe:
+			return n >= 0, nil
+		case repository.OpLt:
+			return n < 0, nil
+		default:
+			return n <= 0, nil
+		}
+	case repository.OpBetween:
+		values, _ := cond.Values()
+		lower, err := compareValue(actual, values[0])
+		if err != nil {
+			return false, err
+		}
+		upper, err := compareValue(actual, values[1])
+		return lower >= 0 && upper <= 0, err
+	case repository.OpIn, repository.OpNotIn:
+		values, _ := cond.Values()
+		in := false
+		for _, value := range values {
+			if equalValue(actual, value) {
+				in = true
+				break
+			}
+		}
+		return in == (cond.Operator() == repository.OpIn), nil
+	case repository.OpLike:
+		re, err := likePattern(fmt.Sprint(cond.Value))
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(fmt.Sprint(actual.Interface())), nil
+	case repository.OpPrefix:
+		return strings.HasPrefix(strings.ToLower(fmt.Sprint(actual.Interface())), strings.ToLower(fmt.Sprint(cond.Value))), nil
+	case repository.OpContains:
+		return strings.Contains(strings.ToLower(fmt.Sprint(actual.Interface())), strings.ToLower(fmt.Sprint(cond.Value))), nil
+	default:
+		return false, fmt.Errorf("%w: unknown operator %s", repository.ErrInvalidFilter, cond.Op)
+	}
+}
+
+func equalValue(actual reflect.Value, value interface{}) bool {
+	if n, err := compareValue(actual, value); err == nil {
+		return n == 0
+	}
+
+	return fmt.Sprint(actual.Interface()) == fmt.Sprint(value)
+}
+
+// compareValue 数字按数值比较，时间按时间比较，其他按字符串比较
+func compareValue(actual reflect.Value, value interface{}) (int, error) {
+	switch actual.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		a, _ := strconv.ParseFloat(fmt.Sprint(actual.Interface()), 64)
+		b, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v is not a number", repository.ErrInvalidFilter, value)
+		}
+		return compareOrdered(a, b), nil
+	}
+
+	if t, ok := actual.Interface().(time.Time); ok {
+		other, ok := value.(time.Time)
+		if !ok {
+			var err error
+			if other, err = time.Parse(time.RFC3339Nano, fmt.Sprint(value)); err != nil {
+				return 0, fmt.Errorf("%w: %v is not a time", repository.ErrInvalidFilter, value)
+			}
+		}
+		return t.Compare(other), nil
+	}
+
+	return strings.Compare(fmt.Sprint(actual.Interface()), fmt.Sprint(value)), nil
+}
+
+func compareOrdered(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// likePattern 把 LIKE 的模式转换为正则表达式，% 匹配任意字符串，_ 匹配一个字符
+func likePattern(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/hnhuaxi/domain/repository"
+	"github.com/hnhuaxi/platform/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisFindWhere(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		s      = miniredis.RunT(t)
+		client = redis.NewClient(&redis.Options{Addr: s.Addr()})
+		rredis = NewRedisRepository[*TestUser, *PTestUser]("tests", client, logger.ProviderLog())
+	)
+	defer client.Close()
+
+	for _, u := range []*PTestUser{{Id: 1, Name: "bob", Age: 18}, {Id: 2, Name: "alice", Age: 25}, {Id: 3, Name: "carol", Age: 40}} {
+		assert.NoError(t, rredis.Insert(ctx, u))
+	}
+
+	find := func(expr repository.FilterExpr) []uint {
+		users, _, err := rredis.Find(ctx, repository.OptWhere(expr))
+		assert.NoError(t, err)
+
+		var ids []uint
+		for _, u := range users {
+			ids = append(ids, uint(u.Id))
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		return ids
+	}
+
+	assert.Equal(t, []uint{1, 3}, find(repository.Or(
+		repository.Cond("name", repository.OpEq, "bob"),
+		repository.Cond("age", repository.OpGt, 30),
+	)))
+	assert.Equal(t, []uint{2}, find(repository.And(
+		repository.Cond("age", repository.OpBetween, []int{20, 40}),
+		repository.Not(repository.Cond("name", repository.OpPrefix, "C")),
+	)))
+	assert.Equal(t, []uint{2, 3}, find(repository.Cond("name", repository.OpLike, "%a%")))
+	assert.Equal(t, []uint{3}, find(repository.Cond("id", repository.OpNotIn, []uint{1, 2})))
+
+	rows, err := rredis.UpdateWhere(ctx, []repository.FilterItem{{Expr: &repository.FilterExpr{Field: "age", Op: repository.OpGe, Value: 25}}}, &PTestUser{Name: "dave"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), rows)
+}
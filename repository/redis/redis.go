@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/hnhuaxi/domain"
@@ -28,6 +29,8 @@ type RedisRepository[M repository.Model[E], E any] struct {
 	defaults  map[string]repository.SearchOpt
 	schema    *schema.Schema
 	validKeys []string
+	version   string
+	tombstone time.Duration
 }
 
 func NewRedisRepository[M repository.Model[E], E any](namespace string, redis *redis.Client, logger *logger.Logger) *RedisRepository[M, E] {
@@ -120,6 +123,15 @@ func (rredis *RedisRepository[M, E]) Insert(ctx context.Context, entity E, ops .
 		return err
 	}
 
+	vf, err := rredis.versionField()
+	if err != nil {
+		return err
+	}
+
+	if vf != nil {
+		return rredis.insertVersioned(ctx, rredis.getKey(fmt.Sprintf("%s:%v", modelName, key.Value())), entity, m, vf, opts.Expires)
+	}
+
 	if err := rredis.redis.Set(ctx, rredis.getKey(fmt.Sprintf("%s:%v", modelName, key.Value())), b, opts.Expires).Err(); err != nil {
 		return err
 	}
@@ -140,7 +152,16 @@ func (rredis *RedisRepository[M, E]) Get(ctx context.Context, key repository.Key
 		}
 	}
 
-	b, err := rredis.redis.GetEx(ctx, rredis.fullkey(key), opts.Expiration).Result()
+	var fullkey = rredis.fullkey(key)
+	if opts.Trashed == repository.TrashedOnly {
+		fullkey = rredis.trashKey(key)
+	}
+
+	b, err := rredis.redis.GetEx(ctx, fullkey, opts.Expiration).Result()
+	if err == redis.Nil && opts.Trashed == repository.TrashedWith {
+		b, err = rredis.redis.Get(ctx, rredis.trashKey(key)).Result()
+	}
+
 	switch err {
 	case redis.Nil:
 		return z, domain.ErrNotFound
@@ -195,6 +216,10 @@ func (rredis *RedisRepository[M, E]) Find(ctx context.Context, ops ...repository
 		cursor, _ = convert.Uint64(opts.Page.AfterId.Value())
 	}
 
+	if opts.Trashed == repository.TrashedOnly {
+		match = rredis.getKey(rredis.getModel(m)+trashedSegment) + "*"
+	}
+
 	if opts.Page.PageSize == 0 {
 		opts.Page.PageSize = 20
 	}
@@ -203,6 +228,7 @@ func (rredis *RedisRepository[M, E]) Find(ctx context.Context, ops ...repository
 	if err != nil {
 		return nil, metadata, err
 	}
+	keys = rredis.filterTrashed(keys, opts.Trashed)
 
 	if cursor > 0 {
 
@@ -212,7 +238,7 @@ func (rredis *RedisRepository[M, E]) Find(ctx context.Context, ops ...repository
 				return nil, metadata, err
 			}
 
-			keys = append(keys, _keys...)
+			keys = append(keys, rredis.filterTrashed(_keys, opts.Trashed)...)
 			if cursor == 0 {
 				break
 			}
@@ -242,6 +268,17 @@ func (rredis *RedisRepository[M, E]) Find(ctx context.Context, ops ...repository
 		if err := json.Unmarshal([]byte(cmd.Val()), m); err != nil {
 			errs = multierr.Append(errs, err)
 		}
+
+		// 没有二级索引，读取之后过滤，一页的数量可能少于 PageSize
+		if len(opts.Filters) > 0 {
+			ok, err := matchFilters(reflect.Indirect(reflect.ValueOf(m)), opts.Filters)
+			if err != nil {
+				return nil, metadata, err
+			}
+			if !ok {
+				continue
+			}
+		}
 		results = append(results, m)
 	}
 
@@ -257,6 +294,7 @@ func min(a, b int) int {
 	return a
 }
 
+// Delete 设置了 SetTombstoneTTL 时把记录移动到墓碑 key，过期之前可以 Restore
 func (rredis *RedisRepository[M, E]) Delete(ctx context.Context, entity E) error {
 	var (
 		m = repository.FromEntity[M](entity)
@@ -267,6 +305,10 @@ func (rredis *RedisRepository[M, E]) Delete(ctx context.Context, entity E) error
 		return domain.ErrCantPrimaryKey
 	}
 
+	if rredis.tombstone > 0 {
+		return rredis.trash(ctx, key)
+	}
+
 	_, err := rredis.redis.Del(ctx, rredis.fullkey(key)).Result()
 	if err != nil {
 		return err
@@ -276,6 +318,10 @@ func (rredis *RedisRepository[M, E]) Delete(ctx context.Context, entity E) error
 }
 
 func (rredis *RedisRepository[M, E]) DeleteKey(ctx context.Context, key repository.Key) error {
+	if rredis.tombstone > 0 {
+		return rredis.trash(ctx, key)
+	}
+
 	_, err := rredis.redis.Del(ctx, rredis.fullkey(key)).Result()
 	if err != nil {
 		return err
@@ -0,0 +1,118 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/repository"
+)
+
+// trashedSegment 墓碑 key 为 NS$$model:trashed:id，和记录使用相同的前缀
+const trashedSegment = ":trashed:"
+
+// SetTombstoneTTL 启用软删除，Delete 把记录移动到墓碑 key，墓碑在 ttl 之后过期
+func (rredis *RedisRepository[M, E]) SetTombstoneTTL(ttl time.Duration) *RedisRepository[M, E] {
+	rredis.tombstone = ttl
+	return rredis
+}
+
+func (rredis *RedisRepository[M, E]) trashKey(key repository.Key) string {
+	var m M
+	return rredis.getKey(fmt.Sprintf("%s%s%v", rredis.getModel(m), trashedSegment, key.Value()))
+}
+
+func (rredis *RedisRepository[M, E]) filterTrashed(keys []string, mode repository.TrashedMode) []string {
+	if mode == repository.TrashedWith {
+		return keys
+	}
+
+	var (
+		m        M
+		prefix   = rredis.getKey(rredis.getModel(m) + trashedSegment)
+		filtered = keys[:0]
+	)
+
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) == (mode == repository.TrashedOnly) {
+			filtered = append(filtered, key)
+		}
+	}
+
+	return filtered
+}
+
+// trash 记录不存在时什么也不做，和 DEL 相同
+func (rredis *RedisRepository[M, E]) trash(ctx context.Context, key repository.Key) error {
+	var (
+		fullkey  = rredis.fullkey(key)
+		trashKey = rredis.trashKey(key)
+	)
+
+	return rredis.watch(ctx, func(tx *redis.Tx) error {
+		n, err := tx.Exists(ctx, fullkey).Result()
+		if err != nil || n == 0 {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Rename(ctx, fullkey, trashKey)
+			pipe.Expire(ctx, trashKey, rredis.tombstone)
+			return nil
+		})
+		return err
+	}, fullkey)
+}
+
+// Restore 把墓碑移动回记录，记录已经重新写入时返回错误
+func (rredis *RedisRepository[M, E]) Restore(ctx context.Context, key repository.Key) error {
+	var (
+		fullkey  = rredis.fullkey(key)
+		trashKey = rredis.trashKey(key)
+	)
+
+	if rredis.tombstone == 0 {
+		return repository.ErrSoftDeleteDisabled
+	}
+
+	return rredis.watch(ctx, func(tx *redis.Tx) error {
+		n, err := tx.Exists(ctx, trashKey).Result()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return domain.ErrNotFound
+		}
+
+		if n, err = tx.Exists(ctx, fullkey).Result(); err != nil {
+			return err
+		}
+
+		if n > 0 {
+			return fmt.Errorf("repository: restore %s failed, key already exists", fullkey)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Rename(ctx, trashKey, fullkey)
+			pipe.Persist(ctx, fullkey)
+			return nil
+		})
+		return err
+	}, fullkey, trashKey)
+}
+
+// ForceDelete 同时删除记录和墓碑
+func (rredis *RedisRepository[M, E]) ForceDelete(ctx context.Context, entity E) error {
+	var m = repository.FromEntity[M](entity)
+
+	key, ok := rredis.getModelId(m)
+	if !ok {
+		return domain.ErrCantPrimaryKey
+	}
+
+	return rredis.redis.Del(ctx, rredis.fullkey(key), rredis.trashKey(key)).Err()
+}
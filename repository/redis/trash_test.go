@@ -0,0 +1,53 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/repository"
+	"github.com/hnhuaxi/platform/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisTombstone(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		s      = miniredis.RunT(t)
+		client = redis.NewClient(&redis.Options{Addr: s.Addr()})
+		rredis = NewRedisRepository[*TestUser, *PTestUser]("tests", client, logger.ProviderLog()).
+			SetTombstoneTTL(time.Hour)
+		user = &PTestUser{Id: 1, Name: "bob"}
+	)
+	defer client.Close()
+
+	assert.NoError(t, rredis.Insert(ctx, user))
+	assert.NoError(t, rredis.Insert(ctx, &PTestUser{Id: 2, Name: "alice"}))
+	assert.NoError(t, rredis.Delete(ctx, user))
+
+	_, err := rredis.Get(ctx, repository.ID(1))
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+	assert.Equal(t, time.Hour, s.TTL("tests$$test_user:trashed:1"))
+
+	got, err := rredis.Get(ctx, repository.ID(1), repository.OptWithTrashed())
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", got.Name)
+
+	users, _, err := rredis.Find(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+
+	users, _, _ = rredis.Find(ctx, repository.OptOnlyTrashed())
+	assert.Len(t, users, 1)
+
+	assert.NoError(t, rredis.Restore(ctx, repository.ID(1)))
+	assert.ErrorIs(t, rredis.Restore(ctx, repository.ID(1)), domain.ErrNotFound)
+	assert.Equal(t, time.Duration(0), s.TTL("tests$$test_user:1"))
+
+	assert.NoError(t, rredis.ForceDelete(ctx, user))
+	_, err = rredis.Get(ctx, repository.ID(1), repository.OptWithTrashed())
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+}
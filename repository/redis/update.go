@@ -0,0 +1,313 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/repository"
+)
+
+// maxTxRetries key 在 WATCH 之后被其他客户端修改时重试的次数
+const maxTxRetries = 3
+
+var errSkip = errors.New("skip")
+
+func (rredis *RedisRepository[M, E]) Update(ctx context.Context, key repository.Key, changes E, ops ...repository.PutOptFunc) (int64, error) {
+	opts, err := rredis.buildPutOpts(ops)
+	if err != nil {
+		return 0, err
+	}
+
+	src := reflect.Indirect(reflect.ValueOf(repository.FromEntity[M](changes)))
+
+	vf, err := rredis.versionField()
+	if err != nil {
+		return 0, err
+	}
+
+	return rredis.modify(ctx, rredis.fullkey(key), opts, func(m M) error {
+		dst := reflect.Indirect(reflect.ValueOf(m))
+		if err := copyFields(dst, src, opts.Mask); err != nil {
+			return err
+		}
+
+		// changes 中有版本时要求和记录的版本相同，否则不检查
+		if vf != nil {
+			if version := src.FieldByIndex(vf.StructField.Index); !version.IsZero() {
+				dst.FieldByIndex(vf.StructField.Index).Set(version)
+			}
+		}
+		return nil
+	})
+}
+
+func (rredis *RedisRepository[M, E]) Patch(ctx context.Context, key repository.Key, patch []byte, ops ...repository.PutOptFunc) (int64, error) {
+	opts, err := rredis.buildPutOpts(ops)
+	if err != nil {
+		return 0, err
+	}
+
+	return rredis.modify(ctx, rredis.fullkey(key), opts, func(m M) error {
+		doc, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+
+		if doc, err = repository.MergePatch(doc, patch); err != nil {
+			return err
+		}
+
+		// 主键决定了 redis key，不允许被 patch 修改
+		v := reflect.Indirect(reflect.ValueOf(m))
+		id, ok := rredis.getModelId(m)
+		if !ok {
+			return domain.ErrCantPrimaryKey
+		}
+		idv := reflect.ValueOf(id.Value())
+
+		v.Set(reflect.Zero(v.Type()))
+		if err := json.Unmarshal(doc, m); err != nil {
+			return err
+		}
+
+		v.FieldByName(id.Name()).Set(idv)
+		return nil
+	})
+}
+
+// UpdateWhere 遍历模型的全部 key，filters 中的 FilterItem 是等值比较，也可以是过滤表达式，
+// 各个 key 分别修改，不是原子的，没有 filters 时返回 repository.ErrMissingFilter
+func (rredis *RedisRepository[M, E]) UpdateWhere(ctx context.Context, filters []repository.FilterItem, changes E, ops ...repository.PutOptFunc) (int64, error) {
+	if len(filters) == 0 {
+		return 0, repository.ErrMissingFilter
+	}
+
+	var (
+		m      M
+		match  = rredis.getKey(rredis.getModel(m)) + ":*"
+		cursor uint64
+		rows   int64
+		keys   []string
+	)
+
+	opts, err := rredis.buildPutOpts(ops)
+	if err != nil {
+		return 0, err
+	}
+
+	src := reflect.Indirect(reflect.ValueOf(repository.FromEntity[M](changes)))
+
+	vf, err := rredis.versionField()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		keys, cursor, err = rredis.redis.Scan(ctx, cursor, match, 0).Result()
+		if err != nil {
+			return rows, err
+		}
+		keys = rredis.filterTrashed(keys, repository.TrashedExclude)
+
+		for _, key := range keys {
+			n, err := rredis.modify(ctx, key, opts, func(m M) error {
+				v := reflect.Indirect(reflect.ValueOf(m))
+
+				ok, err := matchFilters(v, filters)
+				if err != nil {
+					return err
+				}
+
+				if !ok {
+					return errSkip
+				}
+
+				// 批量修改只把版本加一，不检查版本
+				if vf != nil {
+					version := reflect.New(vf.FieldType).Elem()
+					version.Set(v.FieldByIndex(vf.StructField.Index))
+					defer v.FieldByIndex(vf.StructField.Index).Set(version)
+				}
+
+				return copyFields(v, src, opts.Mask)
+			})
+
+			switch {
+			case err == nil:
+				rows += n
+			case errors.Is(err, errSkip), errors.Is(err, domain.ErrNotFound):
+			default:
+				return rows, err
+			}
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if rows == 0 {
+		return 0, domain.ErrNotFound
+	}
+
+	return rows, nil
+}
+
+// modify 在 WATCH 事务中读取 key，修改之后写回，保留原来的过期时间，除非指定了 OptExpires。
+// 启用版本字段时，fn 修改之后的版本必须和读取的版本相同，写入时版本加一
+func (rredis *RedisRepository[M, E]) modify(ctx context.Context, key string, opts *repository.PutOption, fn func(m M) error) (int64, error) {
+	var expiration = opts.Expires
+	if expiration == 0 {
+		expiration = redis.KeepTTL
+	}
+
+	vf, err := rredis.versionField()
+	if err != nil {
+		return 0, err
+	}
+
+	err = rredis.watch(ctx, func(tx *redis.Tx) error {
+		b, err := tx.Get(ctx, key).Bytes()
+		switch err {
+		case redis.Nil:
+			return domain.ErrNotFound
+		case nil:
+		default:
+			return err
+		}
+
+		m := rredis.instantM()
+		if err := json.Unmarshal(b, m); err != nil {
+			return err
+		}
+
+		var stored int64
+		if vf != nil {
+			version, _ := vf.ValueOf(ctx, reflect.ValueOf(m))
+			if stored, err = repository.VersionValue(version); err != nil {
+				return err
+			}
+		}
+
+		if err := fn(m); err != nil {
+			return err
+		}
+
+		if vf != nil {
+			v := reflect.ValueOf(m)
+			version, _ := vf.ValueOf(ctx, v)
+			expected, err := repository.VersionValue(version)
+			if err != nil {
+				return err
+			}
+
+			if expected != stored {
+				return &repository.ErrConcurrentModification{Model: rredis.getModel(m), Key: key, Version: expected}
+			}
+
+			if err := vf.Set(ctx, v, stored+1); err != nil {
+				return err
+			}
+		}
+
+		if b, err = json.Marshal(m); err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, b, expiration)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return 0, err
+	}
+
+	return 1, nil
+}
+
+func (rredis *RedisRepository[M, E]) buildPutOpts(ops []repository.PutOptFunc) (*repository.PutOption, error) {
+	var opts repository.PutOption
+	for _, op := range ops {
+		if err := op(&opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return &opts, nil
+}
+
+// copyFields 把 src 中 mask 指定的字段复制到 dst，mask 为空时复制非零值的字段，不复制主键
+func copyFields(dst, src reflect.Value, mask []string) error {
+	if len(mask) > 0 {
+		for _, name := range mask {
+			field, ok := lookupField(dst.Type(), name)
+			if !ok {
+				return fmt.Errorf("invalid mask field %s", name)
+			}
+
+			if isPrimary(field) {
+				return fmt.Errorf("mask field %s can't be updated", name)
+			}
+
+			dst.FieldByIndex(field.Index).Set(src.FieldByIndex(field.Index))
+		}
+
+		return nil
+	}
+
+	for i := 0; i < src.NumField(); i++ {
+		field := src.Type().Field(i)
+		if !field.IsExported() || isPrimary(field) {
+			continue
+		}
+
+		if val := src.Field(i); !val.IsZero() {
+			dst.Field(i).Set(val)
+		}
+	}
+
+	return nil
+}
+
+func matchFilters(v reflect.Value, filters []repository.FilterItem) (bool, error) {
+	for _, filter := range filters {
+		if filter.Expr != nil {
+			if ok, err := matchExpr(v, *filter.Expr); err != nil || !ok {
+				return false, err
+			}
+			continue
+		}
+
+		field, ok := lookupField(v.Type(), filter.ID)
+		if !ok {
+			return false, fmt.Errorf("invalid filter field %s", filter.ID)
+		}
+
+		if fmt.Sprint(v.FieldByIndex(field.Index).Interface()) != fmt.Sprint(filter.Val()) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// lookupField 按字段名查找，忽略大小写和下划线，name 可以是 snake_case
+func lookupField(t reflect.Type, name string) (reflect.StructField, bool) {
+	name = strings.ReplaceAll(name, "_", "")
+
+	return t.FieldByNameFunc(func(field string) bool {
+		return strings.EqualFold(field, name)
+	})
+}
+
+func isPrimary(field reflect.StructField) bool {
+	return field.Name == "ID" || field.Name == "Id"
+}
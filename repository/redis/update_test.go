@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/hnhuaxi/domain"
+	"github.com/hnhuaxi/domain/repository"
+	"github.com/hnhuaxi/platform/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisUpdate(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		s      = miniredis.RunT(t)
+		client = redis.NewClient(&redis.Options{Addr: s.Addr()})
+		rredis = NewRedisRepository[*TestUser, *PTestUser]("tests", client, logger.ProviderLog())
+	)
+	defer client.Close()
+
+	for _, u := range []*PTestUser{{Id: 1, Name: "bob", Age: 18}, {Id: 2, Name: "alice", Age: 18}} {
+		assert.NoError(t, rredis.Insert(ctx, u, repository.OptExpires(time.Hour)))
+	}
+
+	rows, err := rredis.Update(ctx, repository.ID(1), &PTestUser{Name: "carol"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rows)
+	// 保留原来的过期时间，Get 会重新设置过期时间，需要在 Get 之前检查
+	assert.Equal(t, time.Hour, s.TTL("tests$$test_user:1"))
+
+	u, _ := rredis.Get(ctx, repository.ID(1))
+	assert.Equal(t, &PTestUser{Id: 1, Name: "carol", Age: 18}, u)
+
+	_, err = rredis.Update(ctx, repository.ID(1), &PTestUser{}, repository.OptMask("age"))
+	assert.NoError(t, err)
+	u, _ = rredis.Get(ctx, repository.ID(1))
+	assert.Equal(t, uint32(0), u.Age)
+
+	_, err = rredis.Update(ctx, repository.ID(10), &PTestUser{Name: "carol"})
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	_, err = rredis.Patch(ctx, repository.ID(2), []byte(`{"Name": null, "ID": 5}`))
+	assert.NoError(t, err)
+	u, _ = rredis.Get(ctx, repository.ID(2))
+	assert.Equal(t, &PTestUser{Id: 2, Age: 18}, u)
+
+	rows, err = rredis.UpdateWhere(ctx, []repository.FilterItem{{ID: "age", Value: 18}}, &PTestUser{Name: "dave"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rows)
+
+	_, err = rredis.UpdateWhere(ctx, []repository.FilterItem{{ID: "age", Value: 30}}, &PTestUser{Name: "dave"})
+	assert.ErrorIs(t, err, domain.ErrNotFound)
+
+	// 没有 filters 时不修改全部记录
+	_, err = rredis.UpdateWhere(ctx, nil, &PTestUser{Name: "dave"})
+	assert.ErrorIs(t, err, repository.ErrMissingFilter)
+}
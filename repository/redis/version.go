@@ -0,0 +1,117 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hnhuaxi/domain/repository"
+	"gorm.io/gorm/schema"
+)
+
+// SetVersionField 启用乐观锁，name 为版本字段，也可以在模型上使用 `gorm:"version"` tag 启用。
+// 启用之后 Insert、Update 和 Patch 在 WATCH 事务中比较版本并把版本加一，
+// 版本不同时返回 *repository.ErrConcurrentModification
+func (rredis *RedisRepository[M, E]) SetVersionField(name string) *RedisRepository[M, E] {
+	rredis.version = name
+	return rredis
+}
+
+func (rredis *RedisRepository[M, E]) versionField() (*schema.Field, error) {
+	sch, err := rredis.getSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	vf := repository.VersionField(sch, rredis.version)
+	if vf == nil && rredis.version != "" {
+		return nil, fmt.Errorf("invalid version field %s", rredis.version)
+	}
+
+	return vf, nil
+}
+
+// insertVersioned 已经存在的记录版本必须和 m 相同，写入之后把新的版本写回 entity
+func (rredis *RedisRepository[M, E]) insertVersioned(ctx context.Context, key string, entity E, m M, vf *schema.Field, expiration time.Duration) error {
+	var v = reflect.ValueOf(m)
+
+	version, _ := vf.ValueOf(ctx, v)
+	current, err := repository.VersionValue(version)
+	if err != nil {
+		return err
+	}
+
+	err = rredis.watch(ctx, func(tx *redis.Tx) error {
+		b, err := tx.Get(ctx, key).Bytes()
+		switch err {
+		case redis.Nil:
+		case nil:
+			stored := rredis.instantM()
+			if err := json.Unmarshal(b, stored); err != nil {
+				return err
+			}
+
+			if err := rredis.checkVersion(ctx, key, vf, stored, current); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		if err := vf.Set(ctx, v, current+1); err != nil {
+			return err
+		}
+
+		if b, err = json.Marshal(m); err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, b, expiration)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		vf.Set(ctx, v, current)
+		return err
+	}
+
+	if ev := reflect.ValueOf(entity); ev.Kind() == reflect.Ptr && !ev.IsNil() {
+		ev.Elem().Set(reflect.ValueOf(m.ToEntity()).Elem())
+	}
+
+	return nil
+}
+
+// checkVersion stored 的版本不等于 version 时返回 *repository.ErrConcurrentModification
+func (rredis *RedisRepository[M, E]) checkVersion(ctx context.Context, key string, vf *schema.Field, stored M, version int64) error {
+	val, _ := vf.ValueOf(ctx, reflect.ValueOf(stored))
+	current, err := repository.VersionValue(val)
+	if err != nil {
+		return err
+	}
+
+	if current != version {
+		return &repository.ErrConcurrentModification{Model: rredis.getModel(stored), Key: key, Version: version}
+	}
+
+	return nil
+}
+
+// watch 执行 WATCH 事务，keys 在 EXEC 之前被其他客户端修改时重试
+func (rredis *RedisRepository[M, E]) watch(ctx context.Context, fn func(tx *redis.Tx) error, keys ...string) error {
+	for i := 0; i < maxTxRetries; i++ {
+		err := rredis.redis.Watch(ctx, fn, keys...)
+		if err == redis.TxFailedErr {
+			continue
+		}
+
+		return err
+	}
+
+	return redis.TxFailedErr
+}
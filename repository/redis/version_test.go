@@ -0,0 +1,68 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/hnhuaxi/domain/repository"
+	"github.com/hnhuaxi/platform/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestAccount struct {
+	ID      uint
+	Balance int
+	Version int `gorm:"version"`
+}
+
+type PTestAccount struct {
+	Id      uint32
+	Balance int32
+	Version int32
+}
+
+func (a *TestAccount) ToEntity() *PTestAccount {
+	return &PTestAccount{Id: uint32(a.ID), Balance: int32(a.Balance), Version: int32(a.Version)}
+}
+
+func (a *TestAccount) FromEntity(entity *PTestAccount) interface{} {
+	return &TestAccount{ID: uint(entity.Id), Balance: int(entity.Balance), Version: int(entity.Version)}
+}
+
+func TestRedisVersion(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		s      = miniredis.RunT(t)
+		client = redis.NewClient(&redis.Options{Addr: s.Addr()})
+		rredis = NewRedisRepository[*TestAccount, *PTestAccount]("tests", client, logger.ProviderLog())
+	)
+	defer client.Close()
+
+	account := &PTestAccount{Id: 1, Balance: 100}
+	assert.NoError(t, rredis.Insert(ctx, account))
+	assert.Equal(t, int32(1), account.Version)
+
+	first, _ := rredis.Get(ctx, repository.ID(1))
+	second, _ := rredis.Get(ctx, repository.ID(1))
+
+	first.Balance = 50
+	assert.NoError(t, rredis.Insert(ctx, first))
+	assert.Equal(t, int32(2), first.Version)
+
+	second.Balance = 80
+	assert.True(t, repository.IsConcurrentModification(rredis.Insert(ctx, second)))
+
+	_, err := rredis.Update(ctx, repository.ID(1), &PTestAccount{Balance: 10, Version: 1})
+	assert.True(t, repository.IsConcurrentModification(err))
+
+	_, err = rredis.Update(ctx, repository.ID(1), &PTestAccount{Balance: 10}, repository.OptMask("Balance"))
+	assert.NoError(t, err)
+
+	_, err = rredis.Patch(ctx, repository.ID(1), []byte(`{"Balance": 20, "Version": 3}`))
+	assert.NoError(t, err)
+
+	got, _ := rredis.Get(ctx, repository.ID(1))
+	assert.Equal(t, &PTestAccount{Id: 1, Balance: 20, Version: 4}, got)
+}
@@ -22,6 +22,13 @@ type Repository[M Model[E], E any] interface {
 	Get(ctx context.Context, id Key, opts ...SearchOptFunc) (E, error)
 	Find(ctx context.Context, opts ...SearchOptFunc) ([]E, SearchMetadata, error)
 	Delete(ctx context.Context, entity E) error
+	// Update 修改主键为 id 的记录，只修改 changes 中非零值的字段，
+	// 使用 OptMask 指定字段时修改这些字段，包括零值
+	Update(ctx context.Context, id Key, changes E, opts ...PutOptFunc) (int64, error)
+	// Patch 按 JSON merge patch 修改主键为 id 的记录，只修改 patch 中出现的字段
+	Patch(ctx context.Context, id Key, patch []byte, opts ...PutOptFunc) (int64, error)
+	// UpdateWhere 按 filters 批量修改，changes 的规则和 Update 相同，filters 不能为空
+	UpdateWhere(ctx context.Context, filters []FilterItem, changes E, opts ...PutOptFunc) (int64, error)
 }
 
 type Builder[M Model[E], E any] interface {
@@ -50,6 +57,8 @@ type FilterItem struct {
 	ID    string
 	Value interface{}
 	Type  FTType
+	// Expr 不为 nil 时是一个过滤表达式，忽略 ID、Value 和 Type
+	Expr *FilterExpr `json:",omitempty"`
 }
 
 type SortMode struct {
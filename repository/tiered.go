@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// Invalidator 在多个实例之间广播失效的缓存 key，实例收到后删除自己的一级缓存
+type Invalidator interface {
+	Publish(ctx context.Context, keys ...string) error
+	// Subscribe 在后台接收其他实例发布的 key，直到 ctx 结束
+	Subscribe(ctx context.Context, fn func(keys []string)) error
+}
+
+// CacheFiller 由区分回填和写入的缓存实现，CacheRepository 读取未命中后用 Fill 回填，
+// 回填的是 Repository 中已有的值，不需要通知其他实例
+type CacheFiller[E any] interface {
+	Fill(ctx context.Context, key string, entity E, expiration time.Duration) error
+}
+
+// DefaultL1Expiration 未设置 L1Expiration 时一级缓存的过期时间，
+// redis pub/sub 最多投递一次，丢失的失效通知最多在这段时间之后恢复
+const DefaultL1Expiration = time.Minute
+
+// TieredCache 两级缓存，读取时 L1 未命中读 L2 并回填 L1，写入和删除同时作用于两级，
+// 设置 Invalidator 时写入和删除会通知其他实例删除它们的 L1，回填不通知
+type TieredCache[E any] struct {
+	l1  Cache[E]
+	l2  Cache[E]
+	opt TieredOption
+}
+
+type TieredOption struct {
+	// L1Expiration 一级缓存的过期时间，默认 DefaultL1Expiration，写入时的过期时间更短时使用写入的，
+	// 限制其他实例修改后读到旧值的时间
+	L1Expiration time.Duration
+	Invalidator  Invalidator
+}
+
+type TieredOptFunc func(opt *TieredOption)
+
+func OptL1Expiration(expiration time.Duration) TieredOptFunc {
+	return func(opt *TieredOption) {
+		opt.L1Expiration = expiration
+	}
+}
+
+func OptInvalidator(invalidator Invalidator) TieredOptFunc {
+	return func(opt *TieredOption) {
+		opt.Invalidator = invalidator
+	}
+}
+
+// NewTieredCache 设置了 Invalidator 时订阅其他实例的失效通知，直到 ctx 结束
+func NewTieredCache[E any](ctx context.Context, l1, l2 Cache[E], opts ...TieredOptFunc) (*TieredCache[E], error) {
+	var opt TieredOption
+	for _, op := range opts {
+		op(&opt)
+	}
+
+	if opt.L1Expiration <= 0 {
+		opt.L1Expiration = DefaultL1Expiration
+	}
+
+	tiered := &TieredCache[E]{
+		l1:  l1,
+		l2:  l2,
+		opt: opt,
+	}
+
+	if opt.Invalidator != nil {
+		if err := opt.Invalidator.Subscribe(ctx, func(keys []string) {
+			l1.Delete(ctx, keys...)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return tiered, nil
+}
+
+func (tiered *TieredCache[E]) Get(ctx context.Context, key string) (E, bool, error) {
+	if entity, ok, err := tiered.l1.Get(ctx, key); err == nil && ok {
+		return entity, true, nil
+	}
+
+	entity, ok, err := tiered.l2.Get(ctx, key)
+	if err != nil || !ok {
+		return entity, false, err
+	}
+
+	if err := tiered.l1.Set(ctx, key, entity, tiered.l1Expiration(0)); err != nil {
+		return entity, true, err
+	}
+
+	return entity, true, nil
+}
+
+// Set 写入两级并通知其他实例
+func (tiered *TieredCache[E]) Set(ctx context.Context, key string, entity E, expiration time.Duration) error {
+	if err := tiered.Fill(ctx, key, entity, expiration); err != nil {
+		return err
+	}
+
+	return tiered.invalidate(ctx, key)
+}
+
+// Fill 写入两级，不通知其他实例
+func (tiered *TieredCache[E]) Fill(ctx context.Context, key string, entity E, expiration time.Duration) error {
+	if err := tiered.l2.Set(ctx, key, entity, expiration); err != nil {
+		return err
+	}
+
+	return tiered.l1.Set(ctx, key, entity, tiered.l1Expiration(expiration))
+}
+
+func (tiered *TieredCache[E]) Delete(ctx context.Context, keys ...string) error {
+	if err := tiered.l2.Delete(ctx, keys...); err != nil {
+		return err
+	}
+
+	if err := tiered.l1.Delete(ctx, keys...); err != nil {
+		return err
+	}
+
+	return tiered.invalidate(ctx, keys...)
+}
+
+func (tiered *TieredCache[E]) invalidate(ctx context.Context, keys ...string) error {
+	if tiered.opt.Invalidator == nil {
+		return nil
+	}
+
+	return tiered.opt.Invalidator.Publish(ctx, keys...)
+}
+
+func (tiered *TieredCache[E]) l1Expiration(expiration time.Duration) time.Duration {
+	if expiration > 0 && expiration < tiered.opt.L1Expiration {
+		return expiration
+	}
+
+	return tiered.opt.L1Expiration
+}
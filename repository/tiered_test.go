@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hnhuaxi/platform/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// memInvalidator 在同一个进程中模拟多个实例之间的广播
+type memInvalidator struct {
+	subs map[*memInvalidator][]func(keys []string)
+}
+
+func (inv *memInvalidator) instance() *memInvalidator {
+	return &memInvalidator{subs: inv.subs}
+}
+
+func (inv *memInvalidator) Publish(ctx context.Context, keys ...string) error {
+	for sub, fns := range inv.subs {
+		if sub == inv {
+			continue
+		}
+		for _, fn := range fns {
+			fn(keys)
+		}
+	}
+	return nil
+}
+
+func (inv *memInvalidator) Subscribe(ctx context.Context, fn func(keys []string)) error {
+	inv.subs[inv] = append(inv.subs[inv], fn)
+	return nil
+}
+
+func TestTieredCache(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		l2, _  = NewLRUCache[*PUser](10)
+		bus    = &memInvalidator{subs: make(map[*memInvalidator][]func(keys []string))}
+		caches []*TieredCache[*PUser]
+		l1s    []*LRUCache[*PUser]
+	)
+
+	// 两个实例共用 L2
+	for i := 0; i < 2; i++ {
+		l1, _ := NewLRUCache[*PUser](10)
+		tiered, err := NewTieredCache[*PUser](ctx, l1, l2, OptInvalidator(bus.instance()))
+		assert.NoError(t, err)
+
+		caches = append(caches, tiered)
+		l1s = append(l1s, l1)
+	}
+
+	// L1 未命中时读取 L2 并回填
+	assert.NoError(t, l2.Set(ctx, "user:1", &PUser{ID: 1, Name: "bob"}, 0))
+	got, ok, err := caches[0].Get(ctx, "user:1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "bob", got.Name)
+	assert.Equal(t, 1, l1s[0].Len())
+
+	_, _, _ = caches[1].Get(ctx, "user:1")
+	assert.Equal(t, 1, l1s[1].Len())
+
+	// 回填不通知其他实例
+	assert.NoError(t, caches[0].Fill(ctx, "user:1", &PUser{ID: 1, Name: "bob"}, 0))
+	assert.Equal(t, 1, l1s[1].Len())
+
+	// 写入使其他实例的 L1 失效，自己的 L1 保留
+	assert.NoError(t, caches[0].Set(ctx, "user:1", &PUser{ID: 1, Name: "alice"}, 0))
+	assert.Equal(t, 1, l1s[0].Len())
+	assert.Equal(t, 0, l1s[1].Len())
+
+	got, _, _ = caches[1].Get(ctx, "user:1")
+	assert.Equal(t, "alice", got.Name)
+
+	// 删除作用于两级和其他实例
+	assert.NoError(t, caches[1].Delete(ctx, "user:1"))
+	assert.Equal(t, 0, l1s[0].Len())
+	_, ok, _ = caches[0].Get(ctx, "user:1")
+	assert.False(t, ok)
+}
+
+func TestTieredCacheRepository(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		repos     = &memRepository{users: make(map[uint]PUser)}
+		l1, _     = NewLRUCache[*PUser](10)
+		l2, _     = NewLRUCache[*PUser](10)
+		tiered, _ = NewTieredCache[*PUser](ctx, l1, l2)
+		cache     = NewCacheRepositoryWith[*User](repos, tiered, &logger.Logger{})
+		user      = &PUser{Name: "bob"}
+	)
+
+	assert.NoError(t, cache.Insert(ctx, &user))
+
+	_, err := cache.Get(ctx, ID(1))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, l1.Len())
+	assert.Equal(t, 1, l2.Len())
+
+	// L1 被淘汰后从 L2 读取，不读取 Repository
+	assert.NoError(t, l1.Delete(ctx, "user:1"))
+	got, err := cache.Get(ctx, ID(1))
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", got.Name)
+	assert.Equal(t, 1, repos.getCount())
+
+	assert.NoError(t, cache.Delete(ctx, got))
+	assert.Equal(t, 0, l1.Len())
+	assert.Equal(t, 0, l2.Len())
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrSoftDeleteDisabled 模型没有启用软删除
+var ErrSoftDeleteDisabled = errors.New("repository: soft delete is not enabled")
+
+// TrashedMode 查询时如何处理已经软删除的记录
+type TrashedMode int
+
+const (
+	// TrashedExclude 默认不包括已删除的记录
+	TrashedExclude TrashedMode = iota
+	// TrashedWith 包括已删除的记录
+	TrashedWith
+	// TrashedOnly 只查询已删除的记录
+	TrashedOnly
+)
+
+// SoftDeleter 支持软删除的 Repository，Delete 之后可以 Restore，ForceDelete 直接删除
+type SoftDeleter[E any] interface {
+	Restore(ctx context.Context, id Key) error
+	ForceDelete(ctx context.Context, entity E) error
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/multierr"
+	"gorm.io/gorm"
+)
+
+type txContextKey struct{}
+
+// txState 一层事务，嵌套的事务使用 savepoint，提交之后的 hook 在最外层提交之后执行
+type txState struct {
+	tx     *gorm.DB
+	depth  int
+	hooks  []func(ctx context.Context)
+	parent *txState
+}
+
+// UnitOfWork 在同一个数据库事务中执行多个 Repository 的操作
+type UnitOfWork struct {
+	db *gorm.DB
+}
+
+func NewUnitOfWork(db *gorm.DB) *UnitOfWork {
+	return &UnitOfWork{db: db}
+}
+
+// Run 等同于 RunInTx(ctx, uow.db, fn)
+func (uow *UnitOfWork) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	return RunInTx(ctx, uow.db, fn)
+}
+
+// RunInTx 在事务中执行 fn，事务保存在传给 fn 的 ctx 中，使用这个 ctx 的 DBRepository 操作自动加入事务。
+// fn 返回错误或者 panic 时回滚，否则提交并执行 AfterCommit 注册的 hook。
+// ctx 中已经有事务时使用 savepoint，fn 返回错误只回滚到 savepoint。
+// 事务不能在多个 goroutine 中同时使用
+func RunInTx(ctx context.Context, db *gorm.DB, fn func(ctx context.Context) error) error {
+	if parent, ok := ctx.Value(txContextKey{}).(*txState); ok {
+		return runSavePoint(ctx, parent, fn)
+	}
+
+	tx := db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	state := &txState{tx: tx}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txContextKey{}, state)); err != nil {
+		return multierr.Append(err, tx.Rollback().Error)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	for _, hook := range state.hooks {
+		hook(ctx)
+	}
+
+	return nil
+}
+
+func runSavePoint(ctx context.Context, parent *txState, fn func(ctx context.Context) error) error {
+	var (
+		state = &txState{tx: parent.tx, depth: parent.depth + 1, parent: parent}
+		name  = fmt.Sprintf("sp%d", state.depth)
+	)
+
+	if err := parent.tx.SavePoint(name).Error; err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			parent.tx.RollbackTo(name)
+			panic(r)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txContextKey{}, state)); err != nil {
+		return multierr.Append(err, parent.tx.RollbackTo(name).Error)
+	}
+
+	// 回滚到 savepoint 时丢弃这一层的 hook，否则交给上一层
+	parent.hooks = append(parent.hooks, state.hooks...)
+	return nil
+}
+
+// TxFromContext 返回 RunInTx 保存在 ctx 中的事务
+func TxFromContext(ctx context.Context) (*gorm.DB, bool) {
+	if state, ok := ctx.Value(txContextKey{}).(*txState); ok {
+		return state.tx, true
+	}
+
+	return nil, false
+}
+
+// AfterCommit 注册在事务提交之后执行的 hook，例如发布领域事件、清理缓存，
+// 事务回滚时不会执行，ctx 中没有事务时立即执行
+func AfterCommit(ctx context.Context, hook func(ctx context.Context)) {
+	if state, ok := ctx.Value(txContextKey{}).(*txState); ok {
+		state.hooks = append(state.hooks, hook)
+		return
+	}
+
+	hook(ctx)
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+// ErrConcurrentModification 启用版本字段时，记录在读取之后已经被其他人修改，
+// 调用方应该重新读取之后再修改
+type ErrConcurrentModification struct {
+	Model   string
+	Key     interface{}
+	Version interface{}
+}
+
+func (err *ErrConcurrentModification) Error() string {
+	return fmt.Sprintf("repository: %s %v modified concurrently, version %v is stale", err.Model, err.Key, err.Version)
+}
+
+func IsConcurrentModification(err error) bool {
+	var cm *ErrConcurrentModification
+	return errors.As(err, &cm)
+}
+
+// VersionField 返回模型的版本字段，name 为空时查找 tag 为 `gorm:"version"` 的字段，没有时返回 nil
+func VersionField(sch *schema.Schema, name string) *schema.Field {
+	if name != "" {
+		return sch.LookUpField(name)
+	}
+
+	for _, field := range sch.Fields {
+		if _, ok := field.TagSettings["VERSION"]; ok {
+			return field
+		}
+	}
+
+	return nil
+}
+
+// VersionValue 把整数类型的版本转换为 int64
+func VersionValue(version interface{}) (int64, error) {
+	v := reflect.Indirect(reflect.ValueOf(version))
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), nil
+	default:
+		return 0, fmt.Errorf("repository: version must be an integer, got %T", version)
+	}
+}